@@ -7,11 +7,13 @@
 package mloader
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
-	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/wup364/pakku/internal/mloader/mutils"
@@ -24,60 +26,258 @@ import (
 
 // Loader 模块加载器, 实例化后可实现统一管理模板
 type Loader struct {
-	instanceID string                                          // 加载器实例ID
-	events     *utypes.SafeMap[string, []ipakku.OnModuleEvent] // 模块生命周期事件
-	modules    *utypes.SafeMap[string, ipakku.Module]          // 模块Map表
-	mparams    *utypes.SafeMap[string, any]                    // 保存在模块对象中共享的字段key-value
-	mrecord    ipakku.ModuleInfoRecorder                       // 模块信息记录器
+	instanceID  string                                          // 加载器实例ID
+	events      *utypes.SafeMap[string, []ipakku.OnModuleEvent] // 模块生命周期事件
+	modules     *utypes.SafeMap[string, ipakku.Module]          // 模块Map表
+	mparams     *utypes.SafeMap[string, any]                    // 保存在模块对象中共享的字段key-value
+	mrecord     ipakku.ModuleInfoRecorder                       // 模块信息记录器
+	loaded      []string                                        // 已加载的模块名, 按加载顺序
+	locker      *sync.Mutex                                     // loaded 读写锁
+	elocker     *sync.Mutex                                     // 并行加载时串行执行事件监听函数
+	parallelism int                                             // 并行加载的最大并发数, 小于等于1时顺序加载
 }
 
 // Loads 初始化模块(自动分析模块依赖), 初始化顺序: doReady -> doSetup -> doCheckVersion -> doInit -> doEnd
 func (loader *Loader) Loads(mts ...ipakku.Module) {
-	newMts := loader.dependencySort(mts...)
-	for i := 0; i < len(newMts); i++ {
-		loader.Load(newMts[i])
+	if err := loader.loads(false, mts...); nil != err {
+		logs.Panic(err)
 	}
 }
 
+// TryLoads 初始化模块(自动分析模块依赖), 失败时返回 *ipakku.BootError,
+// 并按逆序卸载本次已加载的模块(执行 OnShutdown)
+func (loader *Loader) TryLoads(mts ...ipakku.Module) error {
+	return loader.loads(true, mts...)
+}
+
 // Load 初始化模块, 初始化顺序: doReady -> doSetup -> doCheckVersion -> doInit -> doEnd
 func (loader *Loader) Load(mt ipakku.Module) {
-	moduleOpts := mt.AsModule()
+	if err := loader.tryLoad(mt); nil != err {
+		logs.Panic(err)
+	}
+}
+
+// loads 依赖排序后加载模块, rollback 为 true 时失败后卸载本次已加载的模块
+func (loader *Loader) loads(rollback bool, mts ...ipakku.Module) (err error) {
+	newMts, deps, err := loader.dependencySort(mts...)
+	if nil != err {
+		return
+	}
+
+	loader.locker.Lock()
+	start := len(loader.loaded)
+	loader.locker.Unlock()
+
+	if loader.parallelism > 1 {
+		err = loader.loadsParallel(newMts, deps)
+	} else {
+		for i := 0; i < len(newMts); i++ {
+			if err = loader.tryLoad(newMts[i]); nil != err {
+				break
+			}
+		}
+	}
+
+	if nil != err && rollback {
+		loader.rollback(start)
+	}
+	return
+}
+
+// tryLoad 初始化模块, 失败时返回 *ipakku.BootError
+func (loader *Loader) tryLoad(mt ipakku.Module) (err error) {
 	moduleName := loader.getModuleName(mt)
+
+	// 构造函数模块, 先生成实例
+	if pm, ok := mt.(*providerModule); ok {
+		if err = loader.doPhase(moduleName, ipakku.BootPhaseProvider, func() error {
+			return pm.provide(loader)
+		}); nil != err {
+			return
+		}
+	}
+
+	moduleOpts := mt.AsModule()
 	logs.Infof("> Loading %s Start ", moduleName)
 
-	// doready 模块准备开始加载
-	loader.doHandleModuleEvent(mt, ipakku.ModuleEventOnReady)
-	loader.doReady(moduleName, moduleOpts)
+	var version utypes.SemVer
+	if err = loader.doPhase(moduleName, ipakku.BootPhaseVersion, func() (err error) {
+		version, err = moduleOpts.GetSemVer()
+		return
+	}); nil != err {
+		return
+	}
 
-	// doSetup 模块安装
-	var isSetup bool
-	if isSetup = len(loader.GetModuleVersion(moduleName)) == 0; isSetup {
-		loader.doHandleModuleEvent(mt, ipakku.ModuleEventOnSetup)
-		loader.doSetup(moduleName, moduleOpts)
-		loader.doHandleModuleEvent(mt, ipakku.ModuleEventOnSetupSucced)
+	// doready 模块准备开始加载
+	if err = loader.doPhase(moduleName, string(ipakku.ModuleEventOnReady), func() error {
+		loader.doHandleModuleEvent(mt, ipakku.ModuleEventOnReady)
+		return loader.doReady(moduleName, moduleOpts)
+	}); nil != err {
+		return
 	}
 
-	// doCheckVersion 模块升级
-	if !isSetup && loader.GetModuleVersion(moduleName) != strconv.FormatFloat(mt.AsModule().Version, 'f', 2, 64) {
-		loader.doHandleModuleEvent(mt, ipakku.ModuleEventOnUpdate)
-		loader.doUpdate(moduleName, moduleOpts)
-		loader.doHandleModuleEvent(mt, ipakku.ModuleEventOnUpdateSucced)
+	// doSetup 模块安装 & doCheckVersion 模块升级
+	if err = loader.doSetupOrUpdate(mt, moduleName, moduleOpts, version); nil != err {
+		return
 	}
 
 	// doInit 模块初始化
-	loader.doHandleModuleEvent(mt, ipakku.ModuleEventOnInit)
-	loader.doInit(moduleName, moduleOpts)
+	if err = loader.doPhase(moduleName, string(ipakku.ModuleEventOnInit), func() error {
+		loader.doHandleModuleEvent(mt, ipakku.ModuleEventOnInit)
+		return loader.doInit(moduleName, moduleOpts)
+	}); nil != err {
+		return
+	}
 
 	// doEnd 模块加载结束
 	loader.modules.Put(moduleName, mt)
+	loader.locker.Lock()
+	loader.loaded = append(loader.loaded, moduleName)
+	loader.locker.Unlock()
 	logs.Infof("> Loading %s Complete ", moduleName)
-	loader.doHandleModuleEvent(mt, ipakku.ModuleEventOnLoaded)
+	return loader.doPhase(moduleName, string(ipakku.ModuleEventOnLoaded), func() error {
+		loader.doHandleModuleEvent(mt, ipakku.ModuleEventOnLoaded)
+		return nil
+	})
+}
+
+// doSetupOrUpdate 模块安装或升级. 模块信息记录器实现了 ipakku.ModuleInfoLocker 时,
+// 安装和升级在锁内执行, 获得锁后重新读取版本号, 避免多个实例重复执行
+func (loader *Loader) doSetupOrUpdate(mt ipakku.Module, moduleName string, moduleOpts ipakku.Opts, version utypes.SemVer) (err error) {
+	var recorded string
+	if err = loader.doPhase(moduleName, ipakku.BootPhaseVersion, func() (err error) {
+		recorded, err = loader.getRecord(moduleName + ".SetupVer")
+		return
+	}); nil != err {
+		return
+	}
+	if _, legacy := parseLegacyVersion(recorded); !legacy && len(recorded) > 0 && loader.isVersionRecorded(recorded, version) {
+		return
+	}
+	if mlocker, ok := loader.mrecord.(ipakku.ModuleInfoLocker); ok {
+		if err = loader.doPhase(moduleName, ipakku.BootPhaseLock, func() error {
+			return mlocker.Lock(moduleName)
+		}); nil != err {
+			return
+		}
+		defer func() {
+			if uerr := mlocker.Unlock(moduleName); nil != uerr {
+				logs.Error(uerr)
+			}
+		}()
+	}
+
+	// 重新读取版本号, 旧的两位小数版本号记录转换为语义化版本号并保存
+	if err = loader.doPhase(moduleName, ipakku.BootPhaseVersion, func() (err error) {
+		if recorded, err = loader.getRecord(moduleName + ".SetupVer"); nil == err {
+			recorded, err = loader.migrateLegacyVersion(moduleName, moduleOpts, recorded)
+		}
+		return
+	}); nil != err {
+		return
+	}
+
+	// doSetup 模块安装
+	if len(recorded) == 0 {
+		return loader.doPhase(moduleName, string(ipakku.ModuleEventOnSetup), func() error {
+			loader.doHandleModuleEvent(mt, ipakku.ModuleEventOnSetup)
+			if err := loader.doSetup(moduleName, moduleOpts, version); nil != err {
+				return err
+			}
+			loader.doHandleModuleEvent(mt, ipakku.ModuleEventOnSetupSucced)
+			return nil
+		})
+	}
+
+	// doCheckVersion 模块升级
+	if !loader.isVersionRecorded(recorded, version) {
+		return loader.doPhase(moduleName, string(ipakku.ModuleEventOnUpdate), func() error {
+			loader.doHandleModuleEvent(mt, ipakku.ModuleEventOnUpdate)
+			if err := loader.doUpdate(moduleName, moduleOpts, recorded, version); nil != err {
+				return err
+			}
+			loader.doHandleModuleEvent(mt, ipakku.ModuleEventOnUpdateSucced)
+			return nil
+		})
+	}
+	return
+}
+
+// doPhase 执行模块加载的某个阶段, 返回的错误和 panic 均转换为 *ipakku.BootError
+func (loader *Loader) doPhase(moduleName, phase string, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); nil != r {
+			if rerr, ok := r.(error); ok {
+				err = rerr
+			} else {
+				err = errors.New(strings.TrimSpace(fmt.Sprint(r)))
+			}
+		}
+		if nil != err {
+			var berr *ipakku.BootError
+			if !errors.As(err, &berr) {
+				err = &ipakku.BootError{Module: moduleName, Phase: phase, Err: err}
+			}
+		}
+	}()
+	return fn()
+}
+
+// rollback 按逆序卸载 start 之后加载的模块
+func (loader *Loader) rollback(start int) {
+	loader.locker.Lock()
+	var loaded []string
+	if start < len(loader.loaded) {
+		loaded = loader.loaded[start:]
+		loader.loaded = loader.loaded[:start:start]
+	}
+	loader.locker.Unlock()
+
+	for i := len(loaded) - 1; i >= 0; i-- {
+		if mt, ok := loader.modules.Get(loaded[i]); ok {
+			logs.Infof("> Rollback %s ", loaded[i])
+			loader.doShutdownModule(loaded[i], mt)
+			loader.modules.Delete(loaded[i])
+		}
+	}
+}
+
+// Shutdown 卸载模块, 按照加载顺序的逆序执行 OnShutdown. ctx 结束时立即返回, 执行中的 OnShutdown 在后台继续执行直到结束, 尚未开始的模块不再执行
+func (loader *Loader) Shutdown(ctx context.Context) error {
+	loader.locker.Lock()
+	loaded := loader.loaded
+	loader.loaded = nil
+	loader.locker.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		for i := len(loaded) - 1; i >= 0; i-- {
+			if nil != ctx.Err() {
+				logs.Errorf("> Shutdown canceled, skip %d module(s): %s ", i+1, ctx.Err().Error())
+				break
+			}
+			if mt, ok := loader.modules.Get(loaded[i]); ok {
+				if serr := loader.doShutdownModule(loaded[i], mt); nil != serr && nil == err {
+					err = serr
+				}
+			}
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 // Invoke 模块调用, 返回 []reflect.Value, 返回值暂时无法处理
 func (loader *Loader) Invoke(name string, method string, params ...any) ([]reflect.Value, error) {
 	if module, ok := loader.modules.Get(name); ok {
-		val := reflect.ValueOf(module)
+		val := reflect.ValueOf(unwrapModule(module))
 		fun := val.MethodByName(method)
 		logs.Infof("> Invoke: "+name+"."+method+", %v, %+v ", fun, &fun)
 		args := make([]reflect.Value, len(params))
@@ -99,9 +299,14 @@ func (loader *Loader) GetInstanceID() string {
 	return loader.instanceID
 }
 
-// SetParam 设置变量, 保存在模板加载器实例内部
+// SetParam 设置变量, 保存在模板加载器实例内部. 设置配置目录时重新初始化模块信息记录器
 func (loader *Loader) SetParam(key string, val any) {
 	loader.mparams.Put(key, val)
+	if key == ipakku.PARAMS_KEY_CONFIG_DIR && nil != loader.mrecord {
+		if _, ok := loader.mrecord.(ipakku.ConfigDirSetter); ok {
+			loader.SetModuleInfoRecorder(loader.mrecord)
+		}
+	}
 }
 
 // GetParam 模板加载器实例上的变量
@@ -114,6 +319,9 @@ func (loader *Loader) GetParam(key string) utypes.Object {
 
 // OnModuleEvent 监听模块生命周期事件
 func (loader *Loader) OnModuleEvent(name string, event ipakku.ModuleEvent, val ipakku.OnModuleEvent) {
+	loader.locker.Lock()
+	defer loader.locker.Unlock()
+
 	var events []ipakku.OnModuleEvent
 	eventKey := loader.getModuleEventKey(name, event)
 	if val, ok := loader.events.Get(eventKey); ok {
@@ -127,7 +335,7 @@ func (loader *Loader) OnModuleEvent(name string, event ipakku.ModuleEvent, val i
 // GetModuleByName 根据模块Name获取模块指针记录, 可以获取一个已经实例化的模块
 func (loader *Loader) GetModuleByName(name string, val any) error {
 	if tmp, ok := loader.modules.Get(name); ok {
-		return reflectutil.SetInterfaceValueUnSafe(val, tmp)
+		return reflectutil.SetInterfaceValueUnSafe(val, unwrapModule(tmp))
 	}
 	return fmt.Errorf(ipakku.ERR_MSG_MODULE_NOT_FOUND, name)
 }
@@ -148,10 +356,36 @@ func (loader *Loader) GetModules(val ...any) error {
 	return nil
 }
 
+// GetModulesByInterface 获取所有实现了该接口的已加载模块, 按加载顺序, val 须为接口切片指针, 如: *[]ICache
+func (loader *Loader) GetModulesByInterface(val any) error {
+	valType := reflect.TypeOf(val)
+	if nil == valType || valType.Kind() != reflect.Ptr ||
+		valType.Elem().Kind() != reflect.Slice || valType.Elem().Elem().Kind() != reflect.Interface {
+		return errors.New("the input object must be pointer of interface slice")
+	}
+	sliceType := valType.Elem()
+
+	loader.locker.Lock()
+	loaded := append([]string{}, loader.loaded...)
+	loader.locker.Unlock()
+
+	res := reflect.MakeSlice(sliceType, 0, len(loaded))
+	for i := 0; i < len(loaded); i++ {
+		if mt, ok := loader.modules.Get(loaded[i]); ok && reflect.TypeOf(unwrapModule(mt)).Implements(sliceType.Elem()) {
+			res = reflect.Append(res, reflect.ValueOf(unwrapModule(mt)))
+		}
+	}
+	reflect.ValueOf(val).Elem().Set(res)
+	return nil
+}
+
 // SetModuleInfoRecorder 设置模块信息记录器, 会自动调用init
 func (loader *Loader) SetModuleInfoRecorder(mrecord ipakku.ModuleInfoRecorder) {
 	if nil != mrecord {
 		loader.mrecord = mrecord
+		if setter, ok := mrecord.(ipakku.ConfigDirSetter); ok {
+			setter.SetConfigDir(ipakku.GetConfigDir(loader))
+		}
 		err := loader.mrecord.Init(loader.GetParam(ipakku.PARAMS_KEY_APPNAME).ToString(ipakku.DEFT_VAL_APPNAME))
 		if nil != err {
 			panic(err)
@@ -159,9 +393,39 @@ func (loader *Loader) SetModuleInfoRecorder(mrecord ipakku.ModuleInfoRecorder) {
 	}
 }
 
-// GetModuleVersion 获取模块版本号
+// GetModuleVersion 获取模块版本号, 旧的两位小数版本号记录按 Version 的规则转换后返回, 如: 1.10 => 1.10.0, 不修改记录
 func (loader *Loader) GetModuleVersion(name string) string {
-	return loader.mrecord.GetValue(name + ".SetupVer")
+	ver, err := loader.getModuleVersion(name)
+	if nil != err {
+		logs.Error(err)
+	}
+	return ver
+}
+
+// getModuleVersion 同 GetModuleVersion, 返回读取记录的错误
+func (loader *Loader) getModuleVersion(name string) (string, error) {
+	ver, err := loader.getRecord(name + ".SetupVer")
+	if fv, ok := parseLegacyVersion(ver); ok {
+		return utypes.FloatToSemVer(fv).String(), nil
+	}
+	return ver, err
+}
+
+// getRecord 读取模块信息记录, 记录器实现了 ipakku.ModuleInfoValueGetter 时返回读取失败的错误
+func (loader *Loader) getRecord(key string) (string, error) {
+	if getter, ok := loader.mrecord.(ipakku.ModuleInfoValueGetter); ok {
+		return getter.GetValueE(key)
+	}
+	return loader.mrecord.GetValue(key), nil
+}
+
+// parseLegacyVersion 解析旧的两位小数版本号记录, 如: 1.10
+func parseLegacyVersion(ver string) (float64, bool) {
+	if len(ver) == 0 || strings.Count(ver, ".") != 1 {
+		return 0, false
+	}
+	fv, err := strconv.ParseFloat(ver, 64)
+	return fv, nil == err
 }
 
 // GetApplication 获取当前实例
@@ -184,14 +448,25 @@ func (loader *Loader) Utils() ipakku.Utils {
 	return loader
 }
 
-// setVersion 设置模块版本号 - 模块保留小数两位
-func (loader *Loader) setVersion(moduleName string, version float64) {
-	loader.mrecord.SetValue(moduleName+".SetupVer", strconv.FormatFloat(version, 'f', 2, 64))
-	loader.mrecord.SetValue(moduleName+".SetupDate", strconv.FormatInt(time.Now().UnixNano(), 10))
+// setVersion 设置模块版本号
+func (loader *Loader) setVersion(moduleName string, version utypes.SemVer) error {
+	if err := loader.mrecord.SetValue(moduleName+".SetupVer", version.String()); nil != err {
+		return err
+	}
+	return loader.mrecord.SetValue(moduleName+".SetupDate", strconv.FormatInt(time.Now().UnixNano(), 10))
 }
 
-// doHandleModuleEvent 执行监听模块生命周期事件
+// doHandleModuleEvent 执行监听模块生命周期事件, 并行加载时串行执行
 func (loader *Loader) doHandleModuleEvent(mt ipakku.Module, event ipakku.ModuleEvent) {
+	if loader.parallelism > 1 {
+		loader.elocker.Lock()
+		defer loader.elocker.Unlock()
+	}
+	loader.fireModuleEvent(mt, event)
+}
+
+// fireModuleEvent 执行模块事件的监听函数
+func (loader *Loader) fireModuleEvent(mt ipakku.Module, event ipakku.ModuleEvent) {
 	var events []ipakku.OnModuleEvent
 	if val, ok := loader.events.Get(loader.getModuleEventKey("*", event)); ok {
 		events = val
@@ -201,77 +476,68 @@ func (loader *Loader) doHandleModuleEvent(mt ipakku.Module, event ipakku.ModuleE
 	}
 	if len(events) > 0 {
 		for i := 0; i < len(events); i++ {
-			events[i](mt, loader)
+			events[i](eventTarget(mt), loader)
 		}
 	}
 }
 
 // doReady 模块准备
-func (loader *Loader) doReady(moduleId string, opts ipakku.Opts) {
+func (loader *Loader) doReady(moduleId string, opts ipakku.Opts) error {
 	if nil != opts.OnReady {
 		logs.Infof("> Execute %s.OnReady ", moduleId)
 		opts.OnReady(loader)
 	}
+	if nil != opts.OnReadyE {
+		logs.Infof("> Execute %s.OnReadyE ", moduleId)
+		return opts.OnReadyE(loader)
+	}
+	return nil
 }
 
 // doSetup 模块安装
-func (loader *Loader) doSetup(moduleId string, opts ipakku.Opts) {
+func (loader *Loader) doSetup(moduleId string, opts ipakku.Opts, version utypes.SemVer) error {
 	if nil != opts.OnSetup {
 		logs.Infof("> Execute %s.OnSetup ", moduleId)
 		opts.OnSetup()
 	}
-	loader.setVersion(moduleId, opts.Version)
-}
-
-// doUpdate 模块升级
-func (loader *Loader) doUpdate(moduleId string, opts ipakku.Opts) {
-	if nil == opts.Updaters {
-		loader.setVersion(moduleId, opts.Version)
-		return
-	}
-
-	var updaters []ipakku.Updater
-	if updaters = opts.Updaters(loader); len(updaters) == 0 {
-		loader.setVersion(moduleId, opts.Version)
-		return
-	}
-
-	var execList ipakku.Updaters = make([]ipakku.Updater, 0)
-	if hv, err := strconv.ParseFloat(loader.GetModuleVersion(moduleId), 64); nil != err {
-		logs.Panic(err)
-	} else {
-		for i := 0; i < len(updaters); i++ {
-			if upv := updaters[i].Version(); upv > hv && upv <= opts.Version {
-				execList = append(execList, updaters[i])
-			}
-		}
-	}
-
-	if len(execList) == 0 {
-		loader.setVersion(moduleId, opts.Version)
-		return
-	}
-
-	sort.Sort(execList)
-	for i := 0; i < len(execList); i++ {
-		logs.Infof("> Execute %s.Update ver=%.3f ", moduleId, execList[i].Version())
-		if err := execList[i].Execute(loader); nil == err {
-			loader.setVersion(moduleId, execList[i].Version())
-			logs.Infof("> Completed %s.Update ver=%.3f ", moduleId, execList[i].Version())
-		} else {
-			logs.Panic(err)
+	if nil != opts.OnSetupE {
+		logs.Infof("> Execute %s.OnSetupE ", moduleId)
+		if err := opts.OnSetupE(); nil != err {
+			return err
 		}
 	}
-
-	loader.setVersion(moduleId, opts.Version)
+	return loader.setVersion(moduleId, version)
 }
 
 // doInit 模块初始化
-func (loader *Loader) doInit(moduleId string, opts ipakku.Opts) {
+func (loader *Loader) doInit(moduleId string, opts ipakku.Opts) error {
 	if nil != opts.OnInit {
 		logs.Infof("> Execute %s.OnInit ", moduleId)
 		opts.OnInit()
 	}
+	if nil != opts.OnInitE {
+		logs.Infof("> Execute %s.OnInitE ", moduleId)
+		return opts.OnInitE()
+	}
+	return nil
+}
+
+// doShutdownModule 卸载单个模块, OnShutdown 中的 panic 会被转换为错误返回
+func (loader *Loader) doShutdownModule(moduleId string, mt ipakku.Module) (err error) {
+	defer func() {
+		if r := recover(); nil != r {
+			err = fmt.Errorf("module %s shutdown failed: %v", moduleId, r)
+			logs.Error(err)
+		}
+	}()
+
+	loader.doHandleModuleEvent(mt, ipakku.ModuleEventOnShutdown)
+	if opts := mt.AsModule(); nil != opts.OnShutdown {
+		logs.Infof("> Execute %s.OnShutdown ", moduleId)
+		opts.OnShutdown()
+	}
+	loader.doHandleModuleEvent(mt, ipakku.ModuleEventOnShutdownSucced)
+	return
 }
 
 // getModuleEventKey getModuleEventKey
@@ -292,21 +558,71 @@ func (loader *Loader) getModuleName(mt ipakku.Module) string {
 	}
 }
 
-// dependencySort 依赖排序
-func (loader *Loader) dependencySort(mts ...ipakku.Module) (res []ipakku.Module) {
+// dependencySort 依赖排序, 存在循环依赖或依赖的模块不存在时返回 *ipakku.BootError
+// deps 为每个模块在本批次中的直接依赖
+func (loader *Loader) dependencySort(mts ...ipakku.Module) (res []ipakku.Module, deps map[string][]string, err error) {
+	names := make(map[string]bool, len(mts))
+	for i := 0; i < len(mts); i++ {
+		names[loader.getModuleName(mts[i])] = true
+	}
+
 	modules := []strutil.DS_M{}
 	for i := 0; i < len(mts); i++ {
-		if module, err := mutils.GetAutoWiredDependencies(mts[i]); nil != err {
-			logs.Panic(err)
+		var module mutils.AutoWiredDependencies
+		if pm, ok := mts[i].(*providerModule); ok {
+			module = pm.dependencies()
+		} else {
+			module, err = mutils.GetAutoWiredDependencies(mts[i])
+		}
+		if nil != err {
+			return nil, nil, &ipakku.BootError{Module: loader.getModuleName(mts[i]), Phase: ipakku.BootPhaseDependency, Err: err}
 		} else {
 			if len(module.Name) == 0 {
 				module.Name = loader.getModuleName(mts[i])
 			}
-			modules = append(modules, module)
+			// 可选依赖仅在同批加载时参与排序
+			for _, name := range module.Optionals {
+				if names[name] {
+					module.Dependencies = append(module.Dependencies, name)
+				}
+			}
+			// 切片注入依赖同批加载中所有实现了该接口的模块
+			for _, itype := range module.Interfaces {
+				for j := 0; j < len(mts); j++ {
+					if name := loader.getModuleName(mts[j]); i != j && moduleType(mts[j]).Implements(itype) {
+						module.Dependencies = append(module.Dependencies, name)
+						module.Requesters[name] = module.Requesters[itype.Name()]
+					}
+				}
+			}
+			modules = append(modules, module.DS_M)
 		}
 	}
 
-	sorted := strutil.DependencySorter(modules...)
+	deps = make(map[string][]string, len(modules))
+	for i := 0; i < len(modules); i++ {
+		for _, name := range modules[i].Dependencies {
+			if names[name] && name != modules[i].Name {
+				deps[modules[i].Name] = append(deps[modules[i].Name], name)
+			}
+		}
+	}
+
+	// 不在本次加载列表中的依赖, 需已加载或存在于 Params 中
+	sorted, err := strutil.SortDependencies(func(name string) bool {
+		return loader.modules.ContainsKey(name) || loader.mparams.ContainsKey(name)
+	}, modules...)
+	if nil != err {
+		var module string
+		var cycle *strutil.DependencyCycleError
+		var missing *strutil.DependencyMissingError
+		if errors.As(err, &cycle) {
+			module = cycle.Path[0]
+		} else if errors.As(err, &missing) {
+			module = missing.Name
+		}
+		return nil, nil, &ipakku.BootError{Module: module, Phase: ipakku.BootPhaseDependency, Err: err}
+	}
 	for i := 0; i < len(sorted); i++ {
 		for j := 0; j < len(mts); j++ {
 			if loader.getModuleName(mts[j]) == sorted[i] {
@@ -7,7 +7,15 @@
 package mloader
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/wup364/pakku/ipakku"
 	"github.com/wup364/pakku/pkg/logs"
@@ -41,10 +49,796 @@ func (t *DemoModule) Hello() {
 	logs.Info("DemoModule -> Hello")
 }
 
+// newTestLoader 创建模块信息记录在 dir 目录下的加载器
+func newTestLoader(name, dir string) *Loader {
+	loader := NewDefault(name).(*Loader)
+	loader.SetParam(ipakku.PARAMS_KEY_CONFIG_DIR, dir)
+	return loader
+}
+
 // 在 mian 中调用
 func TestLoader(t *testing.T) {
-	loader := NewDefault("Test")
+	loader := newTestLoader("Test", t.TempDir())
 	// loader.SetModuleInfoRecorder(xxx)
 	loader.Loads(new(DemoModule))
 	loader.GetApplication().Utils().Invoke("DemoModule", "Hello")
 }
+
+// shutdownModule 用于测试卸载顺序的模块
+type shutdownModule struct {
+	name  string
+	order *[]string
+}
+
+// AsModule 作为一个模块加载
+func (t *shutdownModule) AsModule() ipakku.Opts {
+	return ipakku.Opts{
+		Name:    t.name,
+		Version: 1.0,
+		OnShutdown: func() {
+			*t.order = append(*t.order, t.name)
+		},
+	}
+}
+
+func TestLoaderShutdown(t *testing.T) {
+	order := make([]string, 0)
+	loader := newTestLoader("TestShutdown", t.TempDir())
+	loader.Load(&shutdownModule{name: "ShutdownA", order: &order})
+	loader.Load(&shutdownModule{name: "ShutdownB", order: &order})
+	loader.Load(&shutdownModule{name: "ShutdownC", order: &order})
+
+	if err := loader.Shutdown(context.Background()); nil != err {
+		t.Fatal(err)
+	}
+	if len(order) != 3 || order[0] != "ShutdownC" || order[1] != "ShutdownB" || order[2] != "ShutdownA" {
+		t.Fatalf("unexpected shutdown order: %v", order)
+	}
+
+	// 重复调用不会再次执行
+	if err := loader.Shutdown(context.Background()); nil != err || len(order) != 3 {
+		t.Fatalf("shutdown executed twice: %v, %v", order, err)
+	}
+}
+
+func TestLoaderShutdownCanceled(t *testing.T) {
+	order := make([]string, 0)
+	loader := newTestLoader("TestShutdownCanceled", t.TempDir())
+	loader.Load(&shutdownModule{name: "ShutdownA", order: &order})
+
+	// ctx 已结束时尚未开始的模块不再执行
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	loader.Shutdown(ctx)
+	time.Sleep(50 * time.Millisecond)
+	if len(order) != 0 {
+		t.Fatalf("unexpected shutdown order: %v", order)
+	}
+}
+
+// cycleModuleA 与 cycleModuleB 相互依赖
+type cycleModuleA struct {
+	b ipakku.Module `@autowired:"CycleB"`
+}
+
+// AsModule 作为一个模块加载
+func (t *cycleModuleA) AsModule() ipakku.Opts {
+	return ipakku.Opts{Name: "CycleA", Version: 1.0}
+}
+
+// cycleModuleB 与 cycleModuleA 相互依赖
+type cycleModuleB struct {
+	a ipakku.Module `@autowired:"CycleA"`
+}
+
+// AsModule 作为一个模块加载
+func (t *cycleModuleB) AsModule() ipakku.Opts {
+	return ipakku.Opts{Name: "CycleB", Version: 1.0}
+}
+
+// missingModule 依赖一个不存在的模块
+type missingModule struct {
+	x ipakku.Module `@autowired:"NotExists"`
+}
+
+// AsModule 作为一个模块加载
+func (t *missingModule) AsModule() ipakku.Opts {
+	return ipakku.Opts{Name: "Missing", Version: 1.0}
+}
+
+func TestLoaderDependencyError(t *testing.T) {
+	loadsPanic := func(mts ...ipakku.Module) (msg string) {
+		defer func() {
+			msg = fmt.Sprint(recover())
+		}()
+		newTestLoader("TestDependencyError", t.TempDir()).Loads(mts...)
+		return
+	}
+
+	if msg := loadsPanic(new(cycleModuleA), new(cycleModuleB)); !strings.Contains(msg, "CycleA -(mloader.cycleModuleA.b)-> CycleB -(mloader.cycleModuleB.a)-> CycleA") {
+		t.Fatalf("unexpected panic: %s", msg)
+	}
+	if msg := loadsPanic(new(missingModule)); !strings.Contains(msg, "'NotExists' (requested by mloader.missingModule.x)") {
+		t.Fatalf("unexpected panic: %s", msg)
+	}
+}
+
+// greeter 用于测试切片注入的接口
+type greeter interface {
+	Greet() string
+}
+
+// greeterModule 实现 greeter 的模块
+type greeterModule struct {
+	name string
+}
+
+// AsModule 作为一个模块加载
+func (t *greeterModule) AsModule() ipakku.Opts {
+	return ipakku.Opts{Name: t.name, Version: 1.0}
+}
+
+// Greet Greet
+func (t *greeterModule) Greet() string {
+	return t.name
+}
+
+// greeterOwner 初始化 PakkuConf 中注册的 greeter 实现
+type greeterOwner struct {
+	impl greeter
+}
+
+// AsModule 作为一个模块加载
+func (t *greeterOwner) AsModule() ipakku.Opts {
+	return ipakku.Opts{
+		Name:    "GreeterOwner",
+		Version: 1.0,
+		OnReady: func(app ipakku.Application) {
+			t.impl = ipakku.PakkuConf.GetPakkuModuleImplement("greeter", "impl", "").(greeter)
+		},
+		OnInit: func() {
+			ipakku.PakkuConf.SetPakkuModuleImplementInitialized(t.impl, true)
+		},
+		OnShutdown: func() {
+			ipakku.PakkuConf.SetPakkuModuleImplementInitialized(t.impl, false)
+		},
+	}
+}
+
+// qualifiedModule 使用可选、限定和切片注入
+type qualifiedModule struct {
+	optional  ipakku.Module `@autowired:"NotExists?"`
+	implement greeter       `@autowired:"greeter#impl"`
+	greeters  []greeter     `@autowired:""`
+}
+
+// AsModule 作为一个模块加载
+func (t *qualifiedModule) AsModule() ipakku.Opts {
+	return ipakku.Opts{Name: "Qualified", Version: 1.0}
+}
+
+// uninitializedModule 注入未被所有者初始化的实现
+type uninitializedModule struct {
+	implement greeter `@autowired:"greeter#impl"`
+}
+
+// AsModule 作为一个模块加载
+func (t *uninitializedModule) AsModule() ipakku.Opts {
+	return ipakku.Opts{Name: "Uninitialized", Version: 1.0}
+}
+
+// unselectedModule 注入所有者未选用的实现
+type unselectedModule struct {
+	implement greeter `@autowired:"greeter#other"`
+}
+
+// AsModule 作为一个模块加载
+func (t *unselectedModule) AsModule() ipakku.Opts {
+	return ipakku.Opts{Name: "Unselected", Version: 1.0}
+}
+
+// optionalUninitializedModule 可选注入未被所有者初始化的实现
+type optionalUninitializedModule struct {
+	implement greeter `@autowired:"greeter#impl?"`
+}
+
+// AsModule 作为一个模块加载
+func (t *optionalUninitializedModule) AsModule() ipakku.Opts {
+	return ipakku.Opts{Name: "OptionalUninitialized", Version: 1.0}
+}
+
+func TestLoaderQualifiedAutowired(t *testing.T) {
+	dir := t.TempDir()
+	ipakku.PakkuConf.RegisterPakkuModuleImplement(&greeterModule{name: "GreeterImpl"}, "greeter", "impl")
+	ipakku.PakkuConf.RegisterPakkuModuleImplement(&greeterModule{name: "GreeterOther"}, "greeter", "other")
+
+	// 未设置所有者模块时无法注入
+	if err := newTestLoader("TestUninitializedAutowired", dir).TryLoads(new(uninitializedModule)); nil == err || !strings.Contains(err.Error(), "has no owner module") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ipakku.PakkuConf.SetPakkuModuleImplementOwner("greeter", "GreeterOwner")
+
+	// 依赖所有者模块, 所有者未加载时报错
+	if err := newTestLoader("TestUninitializedAutowired", dir).TryLoads(new(uninitializedModule)); nil == err || !strings.Contains(err.Error(), "GreeterOwner") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	optional := new(optionalUninitializedModule)
+	if err := newTestLoader("TestOptionalUninitializedAutowired", dir).TryLoads(optional); nil != err || nil != optional.implement {
+		t.Fatalf("err = %v, implement = %v", err, optional.implement)
+	}
+
+	// 所有者排在后面时依然先加载所有者
+	mt := new(qualifiedModule)
+	loader := newTestLoader("TestQualifiedAutowired", dir)
+	loader.Loads(mt, &greeterModule{name: "GreeterA"}, &greeterModule{name: "GreeterB"}, new(greeterOwner))
+
+	if nil != mt.optional {
+		t.Fatal("optional field should be nil")
+	}
+	if nil == mt.implement || mt.implement.Greet() != "GreeterImpl" {
+		t.Fatal("implement field is not injected")
+	}
+	if len(mt.greeters) != 2 || mt.greeters[0].Greet() != "GreeterA" || mt.greeters[1].Greet() != "GreeterB" {
+		t.Fatalf("unexpected greeters: %v", mt.greeters)
+	}
+
+	// 所有者未选用的实现不注入
+	var berr *ipakku.BootError
+	if err := loader.TryLoads(new(unselectedModule)); !errors.As(err, &berr) || !strings.Contains(err.Error(), "has not been initialized by its owner module GreeterOwner") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 所有者关闭后不再注入
+	if err := loader.Shutdown(context.Background()); nil != err {
+		t.Fatal(err)
+	}
+	if err := newTestLoader("TestUninitializedAutowired", dir).TryLoads(new(uninitializedModule)); nil == err {
+		t.Fatal("implement released by the owner should not be injected")
+	}
+}
+
+// greetService 由构造函数创建的模块
+type greetService interface {
+	Hello() string
+}
+
+// greetServiceImpl greetService 实现
+type greetServiceImpl struct {
+	greeter greeter
+	app     ipakku.Application
+}
+
+// Hello Hello
+func (t *greetServiceImpl) Hello() string {
+	return "hello " + t.greeter.Greet()
+}
+
+func TestLoaderProvider(t *testing.T) {
+	provider, err := NewProviderModule(func(g greeter, app ipakku.Application) (greetService, error) {
+		return &greetServiceImpl{greeter: g, app: app}, nil
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// 构造函数模块排在其依赖之前, 加载时依然先加载依赖
+	loader := newTestLoader("TestProvider", t.TempDir())
+	loader.Loads(provider, &greeterModule{name: "greeter"})
+
+	var service greetService
+	if err := loader.GetModules(&service); nil != err {
+		t.Fatal(err)
+	}
+	if service.Hello() != "hello greeter" || nil == service.(*greetServiceImpl).app {
+		t.Fatalf("unexpected service: %s", service.Hello())
+	}
+
+	if _, err := NewProviderModule(func(name string) greetService { return nil }); nil == err {
+		t.Fatal("non-interface param should be rejected")
+	}
+}
+
+// slowModule OnInit 耗时的模块
+type slowModule struct {
+	name    string
+	running *int32
+	maxRun  *int32
+}
+
+// slowDependent 依赖 SlowA 的耗时模块
+type slowDependent struct {
+	slowModule
+	dep ipakku.Module `@autowired:"SlowA"`
+}
+
+// AsModule 作为一个模块加载
+func (t *slowModule) AsModule() ipakku.Opts {
+	return ipakku.Opts{
+		Name:    t.name,
+		Version: 1.0,
+		OnInit: func() {
+			n := atomic.AddInt32(t.running, 1)
+			for {
+				if m := atomic.LoadInt32(t.maxRun); n <= m || atomic.CompareAndSwapInt32(t.maxRun, m, n) {
+					break
+				}
+			}
+			time.Sleep(50 * time.Millisecond)
+			atomic.AddInt32(t.running, -1)
+		},
+	}
+}
+
+func TestLoaderParallel(t *testing.T) {
+	var running, maxRun int32
+	loader := newTestLoader("TestParallel", t.TempDir())
+	loader.SetParallelism(3)
+
+	var order []string
+	loader.OnModuleEvent("*", ipakku.ModuleEventOnLoaded, func(module any, app ipakku.Application) {
+		order = append(order, module.(ipakku.Module).AsModule().Name)
+	})
+	loader.Loads(
+		&slowDependent{slowModule: slowModule{name: "SlowB", running: &running, maxRun: &maxRun}},
+		&slowDependent{slowModule: slowModule{name: "SlowC", running: &running, maxRun: &maxRun}},
+		&slowModule{name: "SlowA", running: &running, maxRun: &maxRun},
+	)
+
+	// SlowB、SlowC 依赖 SlowA, 在 SlowA 之后并行加载
+	if maxRun != 2 || len(order) != 3 || order[0] != "SlowA" {
+		t.Fatalf("unexpected parallel loading: max=%d, order=%v", maxRun, order)
+	}
+}
+
+// orderedModule 各阶段耗时不同的模块
+type orderedModule struct {
+	name  string
+	delay time.Duration
+}
+
+// orderedDependent 依赖 OrderA 的模块
+type orderedDependent struct {
+	orderedModule
+	dep ipakku.Module `@autowired:"OrderA"`
+}
+
+// AsModule 作为一个模块加载
+func (t *orderedModule) AsModule() ipakku.Opts {
+	return ipakku.Opts{
+		Name:    t.name,
+		Version: 1.0,
+		OnReady: func(app ipakku.Application) { time.Sleep(t.delay) },
+		OnSetup: func() { time.Sleep(t.delay) },
+		OnInit:  func() { time.Sleep(t.delay) },
+	}
+}
+
+// chainB 依赖 ChainA 的模块
+type chainB struct {
+	orderedModule
+	dep ipakku.Module `@autowired:"ChainA"`
+}
+
+// chainC 依赖 ChainB 的模块
+type chainC struct {
+	orderedModule
+	dep ipakku.Module `@autowired:"ChainB"`
+}
+
+func TestLoaderParallelReadyQueue(t *testing.T) {
+	loader := newTestLoader("TestParallelReadyQueue", t.TempDir())
+	loader.SetParallelism(2)
+
+	var order []string
+	loader.OnModuleEvent("*", ipakku.ModuleEventOnLoaded, func(module any, app ipakku.Application) {
+		order = append(order, module.(ipakku.Module).AsModule().Name)
+	})
+	loader.Loads(
+		&orderedModule{name: "Slow", delay: 100 * time.Millisecond},
+		&orderedModule{name: "ChainA"},
+		&chainB{orderedModule: orderedModule{name: "ChainB"}},
+		&chainC{orderedModule: orderedModule{name: "ChainC"}},
+	)
+
+	// 耗时的模块不阻塞与其无关的依赖链
+	if strings.Join(order, ",") != "ChainA,ChainB,ChainC,Slow" {
+		t.Fatalf("unexpected loaded order: %v", order)
+	}
+}
+
+func TestLoaderParallelEventOrder(t *testing.T) {
+	lifecycle := []ipakku.ModuleEvent{ipakku.ModuleEventOnReady, ipakku.ModuleEventOnSetup, ipakku.ModuleEventOnSetupSucced, ipakku.ModuleEventOnInit, ipakku.ModuleEventOnLoaded}
+	delays := []time.Duration{0, 5 * time.Millisecond, 10 * time.Millisecond, 15 * time.Millisecond, 20 * time.Millisecond}
+	for round := 0; round < len(delays); round++ {
+		delay := func(i int) time.Duration { return delays[(i+round)%len(delays)] }
+		loader := newTestLoader(fmt.Sprintf("TestParallelEventOrder%d", round), t.TempDir())
+		loader.SetParallelism(2)
+
+		var events []string
+		for _, event := range lifecycle {
+			event := event
+			loader.OnModuleEvent("*", event, func(module any, app ipakku.Application) {
+				events = append(events, module.(ipakku.Module).AsModule().Name+"."+string(event))
+			})
+		}
+		loader.Loads(
+			&orderedDependent{orderedModule: orderedModule{name: "OrderD", delay: delay(0)}},
+			&orderedModule{name: "OrderC", delay: delay(1)},
+			&orderedModule{name: "OrderB", delay: delay(2)},
+			&orderedDependent{orderedModule: orderedModule{name: "OrderE", delay: delay(3)}},
+			&orderedModule{name: "OrderA", delay: delay(4)},
+		)
+
+		// 每个模块的事件按生命周期顺序执行, 被依赖模块加载完成后才开始加载依赖它的模块
+		if len(events) != 25 {
+			t.Fatalf("unexpected events: %v", events)
+		}
+		indexOf := func(event string) int {
+			for i := 0; i < len(events); i++ {
+				if events[i] == event {
+					return i
+				}
+			}
+			t.Fatalf("event %s not found: %v", event, events)
+			return -1
+		}
+		for _, name := range []string{"OrderA", "OrderB", "OrderC", "OrderD", "OrderE"} {
+			for i := 1; i < len(lifecycle); i++ {
+				if indexOf(name+"."+string(lifecycle[i-1])) > indexOf(name+"."+string(lifecycle[i])) {
+					t.Fatalf("unexpected lifecycle order of %s: %v", name, events)
+				}
+			}
+		}
+		for _, name := range []string{"OrderD", "OrderE"} {
+			if indexOf("OrderA."+string(ipakku.ModuleEventOnLoaded)) > indexOf(name+"."+string(ipakku.ModuleEventOnReady)) {
+				t.Fatalf("%s is loaded before OrderA: %v", name, events)
+			}
+		}
+	}
+}
+
+// failingModule OnInitE 返回错误的模块
+type failingModule struct {
+	dep ipakku.Module `@autowired:"RollbackA"`
+}
+
+// AsModule 作为一个模块加载
+func (t *failingModule) AsModule() ipakku.Opts {
+	return ipakku.Opts{
+		Name:    "Failing",
+		Version: 1.0,
+		OnInitE: func() error {
+			return errors.New("init failed")
+		},
+	}
+}
+
+func TestLoaderTryLoads(t *testing.T) {
+	order := make([]string, 0)
+	loader := newTestLoader("TestTryLoads", t.TempDir())
+	err := loader.TryLoads(new(failingModule), &shutdownModule{name: "RollbackA", order: &order})
+
+	var berr *ipakku.BootError
+	if !errors.As(err, &berr) || berr.Module != "Failing" || berr.Phase != string(ipakku.ModuleEventOnInit) || berr.Err.Error() != "init failed" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// 已加载的模块被回滚
+	if len(order) != 1 || order[0] != "RollbackA" {
+		t.Fatalf("unexpected rollback: %v", order)
+	}
+	var mt ipakku.Module
+	if err := loader.GetModuleByName("RollbackA", &mt); nil == err {
+		t.Fatal("module RollbackA should be removed")
+	}
+}
+
+// upgradeModule 用于测试升级的模块
+type upgradeModule struct {
+	version  float64
+	updaters ipakku.Updaters
+}
+
+// AsModule 作为一个模块加载
+func (t *upgradeModule) AsModule() ipakku.Opts {
+	return ipakku.Opts{
+		Name:     "Upgrade",
+		Version:  t.version,
+		Updaters: func(app ipakku.Application) ipakku.Updaters { return t.updaters },
+	}
+}
+
+// testUpdater 可回滚的升级器
+type testUpdater struct {
+	version    float64
+	err        error
+	rollbacked bool
+}
+
+// Version 要升级到的版本号
+func (u *testUpdater) Version() float64 {
+	return u.version
+}
+
+// Execute 执行升级
+func (u *testUpdater) Execute(app ipakku.Application) error {
+	return u.err
+}
+
+// Rollback 回滚升级
+func (u *testUpdater) Rollback(app ipakku.Application) error {
+	u.rollbacked = true
+	return nil
+}
+
+func TestLoaderUpgradeRollback(t *testing.T) {
+	dir := t.TempDir()
+	newTestLoader("TestUpgrade", dir).Loads(&upgradeModule{version: 1.0})
+
+	u1 := &testUpdater{version: 1.1}
+	u2 := &testUpdater{version: 1.2, err: errors.New("upgrade failed")}
+	mt := &upgradeModule{version: 1.2, updaters: ipakku.Updaters{u2, u1}}
+
+	// 预演
+	loader := newTestLoader("TestUpgrade", dir)
+	plans, err := loader.PlanUpdates(mt)
+	if nil != err || len(plans) != 1 || plans[0].FromVersion != "1.0.0" || len(plans[0].Updaters) != 2 || plans[0].Updaters[0] != "1.10.0" {
+		t.Fatalf("unexpected plans: %v, %v", plans, err)
+	}
+
+	// 升级失败, 回滚并恢复版本号
+	if err = loader.TryLoads(mt); nil == err || !strings.Contains(err.Error(), "upgrade failed") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !u1.rollbacked || !u2.rollbacked {
+		t.Fatal("updaters should be rollbacked")
+	}
+	if ver := loader.GetModuleVersion("Upgrade"); ver != "1.0.0" {
+		t.Fatalf("unexpected version: %s", ver)
+	}
+	if loader.mrecord.GetValue("Upgrade.Upgrade.1_20_0.Error") != "upgrade failed" {
+		t.Fatal("upgrade journal is not recorded")
+	}
+
+	// 拒绝降级
+	loader = newTestLoader("TestUpgrade", dir)
+	loader.SetParam(ipakku.PARAMS_KEY_REFUSE_DOWNGRADE, true)
+	if err = loader.TryLoads(&upgradeModule{version: 0.5}); nil == err || !strings.Contains(err.Error(), "downgrade is refused") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// semverModule 使用语义化版本号的模块
+type semverModule struct {
+	semver   string
+	legacy   func(version float64) string
+	executed []string
+}
+
+// AsModule 作为一个模块加载
+func (t *semverModule) AsModule() ipakku.Opts {
+	return ipakku.Opts{
+		Name:         "SemVer",
+		Version:      1.1,
+		SemVer:       t.semver,
+		LegacySemVer: t.legacy,
+		Updaters: func(app ipakku.Application) ipakku.Updaters {
+			return ipakku.Updaters{
+				ipakku.NewUpdater("1.10.1", func(app ipakku.Application) error {
+					t.executed = append(t.executed, "1.10.1")
+					return nil
+				}),
+				ipakku.NewUpdater("1.11.0-rc.1", func(app ipakku.Application) error {
+					t.executed = append(t.executed, "1.11.0-rc.1")
+					return nil
+				}),
+				ipakku.NewUpdater("1.11.0", func(app ipakku.Application) error {
+					t.executed = append(t.executed, "1.11.0")
+					return nil
+				}),
+			}
+		},
+	}
+}
+
+func TestLoaderSemVer(t *testing.T) {
+	dir := t.TempDir()
+
+	// 使用 Version 声明版本时按相同规则转换, 读取版本号不修改记录, 加载时保存转换后的记录
+	mt := &semverModule{}
+	loader := newTestLoader("TestSemVer", dir)
+	mrecord := loader.mrecord
+	mrecord.SetValue("SemVer.SetupVer", "1.10")
+	if ver := loader.GetModuleVersion("SemVer"); ver != "1.10.0" || mrecord.GetValue("SemVer.SetupVer") != "1.10" {
+		t.Fatalf("unexpected version: %s", ver)
+	}
+	loader.Loads(mt)
+	if ver := mrecord.GetValue("SemVer.SetupVer"); ver != "1.10.0" || len(mt.executed) != 0 {
+		t.Fatalf("unexpected version: %s, %v", ver, mt.executed)
+	}
+
+	mt = &semverModule{semver: "1.11.0-rc.1"}
+	newTestLoader("TestSemVer", dir).Loads(mt)
+	if strings.Join(mt.executed, ",") != "1.10.1,1.11.0-rc.1" {
+		t.Fatalf("unexpected updaters: %v", mt.executed)
+	}
+
+	mt = &semverModule{semver: "1.11.0"}
+	loader = newTestLoader("TestSemVer", dir)
+	loader.Loads(mt)
+	if strings.Join(mt.executed, ",") != "1.11.0" || loader.GetModuleVersion("SemVer") != "1.11.0" {
+		t.Fatalf("unexpected updaters: %v", mt.executed)
+	}
+}
+
+func TestLoaderSemVerLegacyRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	// 改用 SemVer 后依然自动转换旧的记录, 默认与 Version 的转换规则相同
+	mt := &semverModule{semver: "1.11.0"}
+	loader := newTestLoader("TestSemVerLegacy", dir)
+	mrecord := loader.mrecord
+	mrecord.SetValue("SemVer.SetupVer", "1.10")
+	plans, err := loader.PlanUpdates(mt)
+	if nil != err || len(plans) != 1 || plans[0].FromVersion != "1.10.0" || len(plans[0].Updaters) != 3 {
+		t.Fatalf("unexpected plans: %v, %v", plans, err)
+	}
+	if err = loader.TryLoads(mt); nil != err || strings.Join(mt.executed, ",") != "1.10.1,1.11.0-rc.1,1.11.0" {
+		t.Fatalf("unexpected updaters: %v, %v", mt.executed, err)
+	}
+	if ver := mrecord.GetValue("SemVer.SetupVer"); ver != "1.11.0" {
+		t.Fatalf("unexpected version: %s", ver)
+	}
+
+	// 版本号规则不一致时, 由 LegacySemVer 转换: 1.1 => 1.1.0 < 1.2.0
+	mt = &semverModule{semver: "1.2.0", legacy: func(version float64) string {
+		return strconv.FormatFloat(version, 'f', -1, 64) + ".0"
+	}}
+	loader = newTestLoader("TestSemVerLegacy", dir)
+	mrecord = loader.mrecord
+	mrecord.SetValue("SemVer.SetupVer", "1.10")
+	if plans, err = loader.PlanUpdates(mt); nil != err || len(plans) != 1 || plans[0].FromVersion != "1.1.0" || len(plans[0].Updaters) != 0 {
+		t.Fatalf("unexpected plans: %v, %v", plans, err)
+	}
+	if err = loader.TryLoads(mt); nil != err || len(mt.executed) != 0 || mrecord.GetValue("SemVer.SetupVer") != "1.2.0" {
+		t.Fatalf("unexpected version: %s, %v", mrecord.GetValue("SemVer.SetupVer"), err)
+	}
+
+	// 转换结果不是语义化版本号时加载失败
+	mt = &semverModule{semver: "1.11.0", legacy: func(version float64) string { return "v1" }}
+	loader = newTestLoader("TestSemVerLegacy", dir)
+	loader.mrecord.SetValue("SemVer.SetupVer", "1.10")
+	if err = loader.TryLoads(mt); nil == err || !strings.Contains(err.Error(), "convert legacy version record") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// lockRecorder 实现了 ipakku.ModuleInfoLocker 的内存记录器
+type lockRecorder struct {
+	values map[string]string
+	locks  []string
+}
+
+// Init 初始化
+func (r *lockRecorder) Init(appName string) error {
+	r.values = make(map[string]string)
+	return nil
+}
+
+// GetValue 读取记录
+func (r *lockRecorder) GetValue(key string) string {
+	return r.values[key]
+}
+
+// SetValue 写入记录
+func (r *lockRecorder) SetValue(key string, value string) error {
+	r.values[key] = value
+	return nil
+}
+
+// Lock 获取锁
+func (r *lockRecorder) Lock(name string) error {
+	r.locks = append(r.locks, "lock:"+name)
+	return nil
+}
+
+// Unlock 释放锁
+func (r *lockRecorder) Unlock(name string) error {
+	r.locks = append(r.locks, "unlock:"+name)
+	return nil
+}
+
+func TestLoaderModuleInfoLocker(t *testing.T) {
+	recorder := new(lockRecorder)
+	loader := NewDefault("TestModuleInfoLocker")
+	loader.SetModuleInfoRecorder(recorder)
+
+	// 首次加载需安装, 在锁内执行; 再次加载版本一致, 不再加锁
+	loader.Load(&upgradeModule{version: 1.0})
+	loader.Load(&upgradeModule{version: 1.0})
+	if strings.Join(recorder.locks, ",") != "lock:Upgrade,unlock:Upgrade" || recorder.values["Upgrade.SetupVer"] != "1.0.0" {
+		t.Fatalf("unexpected locks: %v", recorder.locks)
+	}
+}
+
+// failingRecorder 指定记录写入失败的内存记录器, getErr 不为空时读取失败
+type failingRecorder struct {
+	lockRecorder
+	fail   func(key, value string) bool
+	getErr error
+}
+
+// GetValueE 读取记录
+func (r *failingRecorder) GetValueE(key string) (string, error) {
+	if nil != r.getErr {
+		return "", r.getErr
+	}
+	return r.lockRecorder.GetValue(key), nil
+}
+
+// SetValue 写入记录, fail 返回 true 时写入失败
+func (r *failingRecorder) SetValue(key string, value string) error {
+	if nil != r.fail && r.fail(key, value) {
+		return errors.New("write " + key + " failed")
+	}
+	return r.lockRecorder.SetValue(key, value)
+}
+
+func TestLoaderUpgradeRecordError(t *testing.T) {
+	recorder := new(failingRecorder)
+	loader := NewDefault("TestUpgradeRecordError").(*Loader)
+	loader.SetModuleInfoRecorder(recorder)
+	loader.Load(&upgradeModule{version: 1.0})
+
+	// 升级失败后恢复版本号失败
+	recorder.fail = func(key, value string) bool { return key == "Upgrade.SetupVer" && value == "1.0.0" }
+	u1 := &testUpdater{version: 1.2, err: errors.New("upgrade failed")}
+	err := loader.TryLoads(&upgradeModule{version: 1.2, updaters: ipakku.Updaters{u1}})
+	if nil == err || !strings.Contains(err.Error(), "upgrade failed") || !strings.Contains(err.Error(), "restore version 1.0.0 failed") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !u1.rollbacked {
+		t.Fatal("updater should be rollbacked")
+	}
+
+	// 升级日志写入失败时不执行升级器
+	recorder.values["Upgrade.SetupVer"] = "1.0.0"
+	recorder.fail = func(key, value string) bool { return strings.HasSuffix(key, ".StartDate") }
+	u2 := &testUpdater{version: 1.2}
+	if err = loader.TryLoads(&upgradeModule{version: 1.2, updaters: ipakku.Updaters{u2}}); nil == err || !strings.Contains(err.Error(), "StartDate failed") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if u2.rollbacked || recorder.values["Upgrade.SetupVer"] != "1.0.0" {
+		t.Fatalf("unexpected version: %s", recorder.values["Upgrade.SetupVer"])
+	}
+}
+
+func TestLoaderRecordReadError(t *testing.T) {
+	recorder := &failingRecorder{getErr: errors.New("connection refused")}
+	loader := NewDefault("TestRecordReadError").(*Loader)
+	loader.SetModuleInfoRecorder(recorder)
+
+	// 读取记录失败时不能当作未安装
+	mt := &upgradeModule{version: 1.0}
+	err := loader.TryLoads(mt)
+	var berr *ipakku.BootError
+	if !errors.As(err, &berr) || berr.Phase != ipakku.BootPhaseVersion || !strings.Contains(err.Error(), "connection refused") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := recorder.values["Upgrade.SetupVer"]; ok {
+		t.Fatal("module should not be setup")
+	}
+}
+
+func TestLoaderConfigDir(t *testing.T) {
+	dir := t.TempDir()
+	loader := NewDefault("TestConfigDir")
+	loader.SetParam(ipakku.PARAMS_KEY_CONFIG_DIR, dir)
+	loader.Load(&upgradeModule{version: 1.0})
+	if _, err := os.Stat(dir + "/TestConfigDir_modules.json"); nil != err {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(".conf/TestConfigDir_modules.json"); !os.IsNotExist(err) {
+		t.Fatalf("module info should not be recorded in .conf: %v", err)
+	}
+}
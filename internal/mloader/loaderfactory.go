@@ -6,6 +6,8 @@
 package mloader
 
 import (
+	"sync"
+
 	"github.com/wup364/pakku/internal/mloader/listener"
 	"github.com/wup364/pakku/ipakku"
 	"github.com/wup364/pakku/pkg/strutil"
@@ -34,5 +36,7 @@ func New(name string) ipakku.Loader {
 		modules:    utypes.NewSafeMap[string, ipakku.Module](),
 		mparams:    utypes.NewSafeMap[string, any](),
 		instanceID: strutil.GetUUID(),
+		locker:     new(sync.Mutex),
+		elocker:    new(sync.Mutex),
 	}
 }
@@ -6,6 +6,7 @@ package mutils
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"unsafe"
 
 	"github.com/wup364/pakku/ipakku"
@@ -86,20 +87,140 @@ func doAutowireFields(ptr any, tagvals map[string]string, app ipakku.Application
 		if ftype, err = reflectutil.GetStructFieldType(ptr, field); nil != err {
 			err = fmt.Errorf("autowire field %s is failed, error: %s", field, err.Error())
 			break
-		} else if ftype.Kind() != reflect.Interface {
-			err = fmt.Errorf("autowire field %s is failed, error: only interface type injections are accepted", field)
+		}
+
+		var tag AutowiredTag
+		if tag, err = ParseAutowiredTag(valKey, ftype); nil != err {
+			err = fmt.Errorf("autowire field %s is failed, error: %s", field, err.Error())
 			break
 		}
 
 		var val any
-		moduleName := getModuleName(valKey, ftype)
-		if val, err = getModuleByName(moduleName, app); nil != err {
+		if val, err = getAutowiredValue(tag, ftype, app); nil != err {
+			if tag.Optional {
+				err = nil
+				logs.Infof("> Autowired %s skipped, optional %s[%s] not found ", field, tag.String(), ftype.String())
+				continue
+			}
 			break
 		}
 		if err = reflectutil.SetStructFieldValueUnSafe(ptr, field, val); nil != err {
 			break
 		}
-		logs.Infof("> Autowired %s <= %s[%s] ", field, moduleName, ftype.String())
+		logs.Infof("> Autowired %s <= %s[%s] ", field, tag.String(), ftype.String())
+	}
+	return
+}
+
+// applicationType ipakku.Application 接口类型
+var applicationType = reflect.TypeOf((*ipakku.Application)(nil)).Elem()
+
+// GetFuncArgs 按参数类型获取函数参数, 规则同 @autowired:"", ipakku.Application 类型参数传入 app
+func GetFuncArgs(ftype reflect.Type, app ipakku.Application) (args []reflect.Value, err error) {
+	args = make([]reflect.Value, ftype.NumIn())
+	for i := 0; i < ftype.NumIn(); i++ {
+		ptype := ftype.In(i)
+		if ptype == applicationType {
+			args[i] = reflect.ValueOf(app)
+			continue
+		}
+
+		var tag AutowiredTag
+		if tag, err = ParseAutowiredTag("", ptype); nil != err {
+			return nil, fmt.Errorf("param %d %s, error: %s", i, ptype.String(), err.Error())
+		}
+		var val any
+		if val, err = getAutowiredValue(tag, ptype, app); nil != err {
+			return nil, fmt.Errorf("param %d %s, error: %s", i, ptype.String(), err.Error())
+		}
+		args[i] = reflect.New(ptype).Elem()
+		args[i].Set(reflect.ValueOf(val))
+	}
+	return
+}
+
+// AutowiredTag 解析后的 @autowired 标签
+// 格式: "" | "模块名" | "接口名#实现名" | "#实现名", 末尾追加 '?' 表示可选注入
+// "接口名#实现名" 注入 PakkuConf 中注册的实现, 依赖接口的所有者模块(PakkuConf.SetPakkuModuleImplementOwner),
+// 该实现需要被所有者模块选用并初始化(PakkuConf.SetPakkuModuleImplementInitialized)
+type AutowiredTag struct {
+	Name      string // 模块名, 默认为字段接口名
+	Implement string // PakkuConf 中注册的实现名, 不为空时从 PakkuConf 中获取
+	Optional  bool   // 是否可选, 可选时找不到不报错, 字段保持 nil
+	Slice     bool   // 是否为接口切片, 为切片时注入所有实现了该接口的已加载模块
+}
+
+// String 标签描述, 用于日志
+func (tag AutowiredTag) String() string {
+	if tag.Slice {
+		return "[]" + tag.Name
+	} else if len(tag.Implement) > 0 {
+		return tag.Name + "#" + tag.Implement
+	}
+	return tag.Name
+}
+
+// ParseAutowiredTag 解析 @autowired 标签
+func ParseAutowiredTag(valKey string, ftype reflect.Type) (tag AutowiredTag, err error) {
+	if tag.Optional = strings.HasSuffix(valKey, "?"); tag.Optional {
+		valKey = valKey[:len(valKey)-1]
+	}
+	if idx := strings.Index(valKey, "#"); idx > -1 {
+		tag.Name, tag.Implement = valKey[:idx], valKey[idx+1:]
+		if len(tag.Implement) == 0 {
+			return tag, fmt.Errorf("implement name is required after '#'")
+		}
+	} else {
+		tag.Name = valKey
+	}
+
+	switch {
+	case ftype.Kind() == reflect.Interface:
+	case ftype.Kind() == reflect.Slice && ftype.Elem().Kind() == reflect.Interface:
+		if len(tag.Implement) > 0 || len(tag.Name) > 0 {
+			return tag, fmt.Errorf("slice injections do not accept a qualifier")
+		}
+		tag.Slice = true
+		ftype = ftype.Elem()
+	default:
+		return tag, fmt.Errorf("only interface or interface slice type injections are accepted")
+	}
+	tag.Name = getModuleName(tag.Name, ftype)
+	return
+}
+
+// getAutowiredValue 根据标签获取注入对象
+func getAutowiredValue(tag AutowiredTag, ftype reflect.Type, app ipakku.Application) (val any, err error) {
+	if tag.Slice {
+		getter, ok := app.Modules().(ipakku.ModulesByInterfaceGetter)
+		if !ok {
+			return nil, fmt.Errorf("slice injections are not supported by %T", app.Modules())
+		}
+		slice := reflect.New(ftype)
+		if err = getter.GetModulesByInterface(slice.Interface()); nil == err {
+			if slice.Elem().Len() == 0 && tag.Optional {
+				return nil, fmt.Errorf(ipakku.ERR_MSG_MODULE_NOT_FOUND, tag.String())
+			}
+			val = slice.Elem().Interface()
+		}
+		return
+	}
+
+	if len(tag.Implement) > 0 {
+		if val = ipakku.PakkuConf.GetPakkuModuleImplement(tag.Name, tag.Implement, tag.Implement); nil == val {
+			return nil, fmt.Errorf(ipakku.ERR_MSG_MODULE_NOT_FOUND, tag.String())
+		}
+		// 注册的实现只是原型, 需要由所有者(如: AppCache模块)选用并初始化后才能使用
+		if !ipakku.PakkuConf.IsPakkuModuleImplementInitialized(val) {
+			return nil, fmt.Errorf("%s has not been initialized by its owner module %s, select it by PakkuConf.SetPakkuModuleImplement(params, \"%s\", \"%s\")",
+				tag.String(), ipakku.PakkuConf.GetPakkuModuleImplementOwner(tag.Name), tag.Name, tag.Implement)
+		}
+	} else if val, err = getModuleByName(tag.Name, app); nil != err {
+		return
+	}
+
+	if !reflect.TypeOf(val).Implements(ftype) {
+		return nil, fmt.Errorf("%s[%T] does not implement %s", tag.String(), val, ftype.String())
 	}
 	return
 }
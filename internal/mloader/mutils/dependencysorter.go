@@ -13,8 +13,15 @@ import (
 	"github.com/wup364/pakku/pkg/strutil"
 )
 
-// GetAutoWiredDependencies 获取依赖注入的依赖树信息
-func GetAutoWiredDependencies(ptr ipakku.Module) (reuslt strutil.DS_M, err error) {
+// AutoWiredDependencies 依赖注入的依赖信息
+type AutoWiredDependencies struct {
+	strutil.DS_M
+	Optionals  []string       // 可选依赖, 仅在同批加载时参与排序
+	Interfaces []reflect.Type // 切片注入的接口, 依赖同批加载中所有实现了该接口的模块
+}
+
+// GetAutoWiredDependencies 获取依赖注入的依赖树信息, PakkuConf 中注册的实现依赖其所有者模块
+func GetAutoWiredDependencies(ptr ipakku.Module) (reuslt AutoWiredDependencies, err error) {
 	// 仅支持指针类型结构体
 	if t := reflect.TypeOf(ptr); t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
 		err = fmt.Errorf("only pointer object '%s' is supported", ipakku.STAG_AUTOWIRED)
@@ -34,11 +41,38 @@ func GetAutoWiredDependencies(ptr ipakku.Module) (reuslt strutil.DS_M, err error
 		err = appendFormAnonymousStruct(ptr, &reuslt)
 	}
 	reuslt.Dependencies = strutil.RemoveDuplicatesAndEmpty(reuslt.Dependencies...)
+	reuslt.Optionals = strutil.RemoveDuplicatesAndEmpty(reuslt.Optionals...)
+	return
+}
+
+// GetFuncDependencies 获取构造函数参数的依赖信息, 规则同 @autowired:""
+func GetFuncDependencies(name string, ftype reflect.Type) (reuslt AutoWiredDependencies) {
+	reuslt.Name = name
+	reuslt.Requesters = make(map[string]string)
+	for i := 0; i < ftype.NumIn(); i++ {
+		ptype := ftype.In(i)
+		if ptype == applicationType {
+			continue
+		}
+		tag, err := ParseAutowiredTag("", ptype)
+		if nil != err {
+			continue // 调用时再报错
+		}
+		if tag.Slice {
+			reuslt.Interfaces = append(reuslt.Interfaces, ptype.Elem())
+		} else {
+			reuslt.Dependencies = append(reuslt.Dependencies, tag.Name)
+		}
+		if _, ok := reuslt.Requesters[tag.Name]; !ok {
+			reuslt.Requesters[tag.Name] = fmt.Sprintf("%s provider param %d", name, i)
+		}
+	}
+	reuslt.Dependencies = strutil.RemoveDuplicatesAndEmpty(reuslt.Dependencies...)
 	return
 }
 
 // appendFormAnonymousStruct 匿名嵌套结构体
-func appendFormAnonymousStruct(ptr any, reuslt *strutil.DS_M) (err error) {
+func appendFormAnonymousStruct(ptr any, reuslt *AutoWiredDependencies) (err error) {
 	var fields []reflect.StructField
 	if fields = reflectutil.GetAnonymousOrNoneTypeNameField(ptr); len(fields) == 0 {
 		return
@@ -76,22 +110,65 @@ func appendFormAnonymousStruct(ptr any, reuslt *strutil.DS_M) (err error) {
 }
 
 // appendDependencies 追加依赖信息
-func appendDependencies(reuslt *strutil.DS_M, tagvals map[string]string, ptr any) (err error) {
+func appendDependencies(reuslt *AutoWiredDependencies, tagvals map[string]string, ptr any) (err error) {
 	if len(tagvals) == 0 {
 		return
 	}
+	if nil == reuslt.Requesters {
+		reuslt.Requesters = make(map[string]string)
+	}
 	for field, valKey := range tagvals {
-		if len(valKey) == 0 {
-			var ftype reflect.Type
-			if ftype, err = reflectutil.GetStructFieldType(ptr, field); nil != err {
+		var ftype reflect.Type
+		if ftype, err = reflectutil.GetStructFieldType(ptr, field); nil != err {
+			err = fmt.Errorf("autowire field %s is failed, error: %s", field, err.Error())
+			break
+		}
+		var tag AutowiredTag
+		if tag, err = ParseAutowiredTag(valKey, ftype); nil != err {
+			err = fmt.Errorf("autowire field %s is failed, error: %s", field, err.Error())
+			break
+		}
+
+		// PakkuConf 中注册的实现依赖其所有者模块
+		if len(tag.Implement) > 0 {
+			if tag.Name, err = getImplementOwner(tag); nil != err {
 				err = fmt.Errorf("autowire field %s is failed, error: %s", field, err.Error())
 				break
 			}
-			reuslt.Dependencies = append(reuslt.Dependencies, ftype.Name())
-		} else {
-			reuslt.Dependencies = append(reuslt.Dependencies, valKey)
+		}
+
+		switch {
+		case tag.Slice:
+			reuslt.Interfaces = append(reuslt.Interfaces, ftype.Elem())
+		case tag.Optional:
+			reuslt.Optionals = append(reuslt.Optionals, tag.Name)
+		default:
+			reuslt.Dependencies = append(reuslt.Dependencies, tag.Name)
+		}
+		if _, ok := reuslt.Requesters[tag.Name]; !ok {
+			reuslt.Requesters[tag.Name] = getStructName(ptr) + "." + field
 		}
 	}
 
 	return
 }
+
+// getImplementOwner 获取 PakkuConf 中注册的实现的所有者模块名
+func getImplementOwner(tag AutowiredTag) (string, error) {
+	if owner := ipakku.PakkuConf.GetPakkuModuleImplementOwner(tag.Name); len(owner) > 0 {
+		return owner, nil
+	}
+	return "", fmt.Errorf("%s has no owner module, set it by PakkuConf.SetPakkuModuleImplementOwner", tag.String())
+}
+
+// getStructName 获取结构体名字, 支持 reflect.Value 包装的指针
+func getStructName(ptr any) string {
+	t := reflect.TypeOf(ptr)
+	if val, ok := ptr.(reflect.Value); ok {
+		t = val.Type()
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.String()
+}
@@ -11,8 +11,10 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/wup364/pakku/ipakku"
 	"github.com/wup364/pakku/pkg/fileutil"
@@ -24,45 +26,52 @@ func init() {
 	ipakku.PakkuConf.SetModuleInfoRecorderImplement(new(InfoRecorder))
 }
 
+// lockTimeout 等待记录文件锁的超时时间, lockStale 锁文件超过该时间视为已失效
+const lockTimeout, lockStale = 5 * time.Second, 30 * time.Second
+
 // InfoRecorder json配置器
 type InfoRecorder struct {
 	jsonObject map[string]any
 	configPath string
+	configDir  string
+	nobackup   bool
 	l          *sync.RWMutex
 }
 
+// SetConfigDir 设置记录文件所在目录, 默认 .conf
+func (config *InfoRecorder) SetConfigDir(dir string) {
+	config.configDir = dir
+}
+
+// SetBackup 写入时是否保留上一个版本为 .bak 文件, 默认保留
+func (config *InfoRecorder) SetBackup(backup bool) *InfoRecorder {
+	config.nobackup = !backup
+	return config
+}
+
 // Init 初始化解析器
 func (config *InfoRecorder) Init(appName string) error {
-	return config.InitConfig(fmt.Sprintf(".conf/%s_modules.json", appName))
+	dir := config.configDir
+	if len(dir) == 0 {
+		dir = ipakku.DEFT_VAL_CONFIG_DIR
+	}
+	return config.InitConfig(filepath.Join(dir, fmt.Sprintf("%s_modules.json", appName)))
 }
 
-// InitConfig 初始化解析器
+// InitConfig 初始化解析器, 文件不存在时在第一次写入时创建
 func (config *InfoRecorder) InitConfig(configPath string) error {
 	if len(configPath) == 0 {
 		return errors.New("config file path is empty")
 	}
-	// 创建父级目录
-	parent := strutil.GetPathParent(configPath)
-	if !fileutil.IsExist(parent) {
-		err := fileutil.MkdirAll(parent)
-		if nil != err {
-			return err
-		}
-	}
 	config.configPath = configPath
-	// 文件不存在则创建
-	if !fileutil.IsFile(config.configPath) {
-		err := config.writeFileAsJSON(config.configPath, make(map[string]any))
-		if nil != err {
-			return err
-		}
-	}
-
 	config.l = new(sync.RWMutex)
 	config.l.Lock()
 	defer config.l.Unlock()
 	// Json to map
 	config.jsonObject = make(map[string]any)
+	if !fileutil.IsFile(config.configPath) {
+		return nil
+	}
 	return config.readFileAsJSON(config.configPath, &config.jsonObject)
 }
 
@@ -134,6 +143,26 @@ func (config *InfoRecorder) SetValueByKey(key string, value string) error {
 	}
 	config.l.Lock()
 	defer config.l.Unlock()
+	// 创建父级目录
+	if parent := strutil.GetPathParent(config.configPath); len(parent) > 0 && !fileutil.IsExist(parent) {
+		if err := fileutil.MkdirAll(parent); nil != err {
+			return err
+		}
+	}
+	// 多个进程共用记录文件时互斥写入, 写入前重新读取, 避免覆盖其他进程的修改
+	lock, err := fileutil.LockFile(config.configPath+".lock", lockTimeout, lockStale)
+	if nil != err {
+		return err
+	}
+	defer lock.Unlock()
+	if fileutil.IsFile(config.configPath) {
+		jsonObject := make(map[string]any)
+		if err := config.readFileAsJSON(config.configPath, &jsonObject); nil != err {
+			return err
+		}
+		config.jsonObject = jsonObject
+	}
+
 	keys := strings.Split(key, ".")
 	keyLength := len(keys)
 	var temp any
@@ -145,8 +174,7 @@ func (config *InfoRecorder) SetValueByKey(key string, value string) error {
 			} else if temp != nil {
 				temp.(map[string]any)[keys[i]] = value
 			}
-			err := config.writeFileAsJSON(config.configPath, config.jsonObject)
-			return err
+			return config.writeFileAsJSON(config.configPath, config.jsonObject)
 		}
 
 		//
@@ -202,25 +230,7 @@ func (config *InfoRecorder) readFileAsJSON(path string, v any) error {
 	return err
 }
 
-// writeFileAsJSON 写入Json文件
+// writeFileAsJSON 以缩进格式原子写入Json文件
 func (config *InfoRecorder) writeFileAsJSON(path string, v any) error {
-	if len(path) == 0 {
-		return fileutil.PathNotExist("WriteFileAsJSON", path)
-	}
-	fp, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
-	defer func() {
-		if nil != fp {
-			fp.Close()
-		}
-	}()
-
-	if err == nil {
-		data, err := json.Marshal(v)
-		if err == nil {
-			_, err := fp.Write(data)
-			return err
-		}
-		return err
-	}
-	return err
+	return fileutil.WriteFileAsIndentJSON(path, v, !config.nobackup)
 }
@@ -0,0 +1,282 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2024 WuPeng <wup364@outlook.com>.
+
+// 模块信息记录器-数据库实现, 多个实例共用一个数据库时, 通过锁表互斥执行模块安装和升级.
+// 锁使用租约版本号续期, 等待的实例按本机计时判断租约是否超过 LockExpire 未续期, 不比较各实例的系统时间
+// 依赖包: sqlexecutor
+
+package mutils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wup364/pakku/pkg/logs"
+	"github.com/wup364/pakku/pkg/sqlutil/sqlexecutor"
+	"github.com/wup364/pakku/pkg/strutil"
+)
+
+const (
+	// SqlInfoTable 模块信息表
+	SqlInfoTable = "pakku_module_info"
+	// SqlLockTable 模块锁表
+	SqlLockTable = "pakku_module_lock"
+)
+
+// NewSqlInfoRecorder 数据库模块信息记录器
+func NewSqlInfoRecorder(provider sqlexecutor.SqlExecutorProvider) *SqlInfoRecorder {
+	return &SqlInfoRecorder{
+		provider:    provider,
+		owner:       strutil.GetUUID(),
+		leases:      make(map[string]chan struct{}),
+		LockExpire:  3 * time.Minute,
+		LockRenew:   30 * time.Second,
+		LockTimeout: 10 * time.Minute,
+		LockRetry:   500 * time.Millisecond,
+	}
+}
+
+// SqlInfoRecorder 数据库模块信息记录器
+type SqlInfoRecorder struct {
+	provider    sqlexecutor.SqlExecutorProvider
+	appName     string
+	owner       string                   // 锁持有者, 每个实例唯一
+	leases      map[string]chan struct{} // 持有中的锁, 关闭后停止续期
+	llock       sync.Mutex               // leases 锁
+	LockExpire  time.Duration            // 锁过期时间, 等待的实例观察到租约超过该时间未续期时, 视为持有者异常退出并接管锁
+	LockRenew   time.Duration            // 持有锁期间的续期间隔, 需小于 LockExpire, 小于等于0时不续期
+	LockTimeout time.Duration            // 获取锁的最长等待时间, 需大于 LockExpire 才能接管异常退出实例的锁
+	LockRetry   time.Duration            // 获取锁的重试间隔
+}
+
+// Init 初始化, 表不存在时自动创建
+func (recorder *SqlInfoRecorder) Init(appName string) (err error) {
+	if nil == recorder.provider {
+		return errors.New("sql executor provider is nil")
+	}
+	recorder.appName = appName
+
+	if err = recorder.createTable(SqlInfoTable, "app_name VARCHAR(128) NOT NULL, info_key VARCHAR(255) NOT NULL, info_value VARCHAR(4000) NOT NULL, "+
+		"PRIMARY KEY (app_name, info_key)"); nil != err {
+		return
+	}
+	return recorder.createTable(SqlLockTable, "app_name VARCHAR(128) NOT NULL, lock_name VARCHAR(255) NOT NULL, lock_owner VARCHAR(64) NOT NULL, lease_version INTEGER NOT NULL, "+
+		"PRIMARY KEY (app_name, lock_name)")
+}
+
+// createTable 表不存在时创建. 部分数据库(如: Oracle、SQL Server)不支持 CREATE TABLE IF NOT EXISTS,
+// 先查询表是否存在, 创建失败时再次确认是否已被其他实例创建
+func (recorder *SqlInfoRecorder) createTable(table, columns string) (err error) {
+	if recorder.tableExists(table) {
+		return
+	}
+	if _, err = recorder.provider.GetSqlExecutor().Exec("CREATE TABLE " + table + " (" + columns + ")"); nil != err && recorder.tableExists(table) {
+		err = nil
+	}
+	return
+}
+
+// tableExists 表是否存在, 查询失败时视为不存在
+func (recorder *SqlInfoRecorder) tableExists(table string) bool {
+	rows, err := recorder.provider.GetSqlExecutor().Query("SELECT 1 FROM " + table + " WHERE 1 = 0")
+	if nil != err {
+		return false
+	}
+	rows.Close()
+	return true
+}
+
+// GetValue 读取记录, 不存在或读取失败时返回空字符串. 加载器使用 GetValueE 读取, 读取失败时模块加载失败
+func (recorder *SqlInfoRecorder) GetValue(key string) string {
+	val, err := recorder.GetValueE(key)
+	if nil != err {
+		logs.Error(err)
+	}
+	return val
+}
+
+// GetValueE 读取记录, 不存在时返回空字符串
+func (recorder *SqlInfoRecorder) GetValueE(key string) (val string, err error) {
+	var rows *sql.Rows
+	if rows, err = recorder.provider.GetSqlExecutor().Query(recorder.bind("SELECT info_value FROM "+SqlInfoTable+" WHERE app_name = ? AND info_key = ?"), recorder.appName, key); nil != err {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		if err = rows.Scan(&val); nil != err {
+			return
+		}
+	}
+	err = rows.Err()
+	return
+}
+
+// SetValue 写入记录
+func (recorder *SqlInfoRecorder) SetValue(key string, value string) (err error) {
+	if len(key) == 0 || len(value) == 0 {
+		return errors.New("key or value is empty")
+	}
+
+	var tx sqlexecutor.SqlTxExecutor
+	if tx, err = recorder.provider.GetSqlTxExecutor(); nil != err {
+		return
+	}
+	if _, err = tx.Exec(recorder.bind("DELETE FROM "+SqlInfoTable+" WHERE app_name = ? AND info_key = ?"), recorder.appName, key); nil != err {
+		tx.RollbackSilence()
+		return
+	}
+	if _, err = tx.Exec(recorder.bind("INSERT INTO "+SqlInfoTable+" (app_name, info_key, info_value) VALUES (?, ?, ?)"), recorder.appName, key, value); nil != err {
+		tx.RollbackSilence()
+		return
+	}
+	return tx.Complete()
+}
+
+// Lock 获取锁, 锁被其他实例持有时等待, 超过 LockTimeout 返回错误. 获得锁后按 LockRenew 定时续期, 直到 Unlock.
+// 持有者的租约(持有者+版本号)在本机计时超过 LockExpire 未变化时, 删除该租约后重新获取
+func (recorder *SqlInfoRecorder) Lock(name string) (err error) {
+	start := time.Now()
+	exec := recorder.provider.GetSqlExecutor()
+	var retried bool
+	var observed string
+	var observedAt time.Time
+	for {
+		if _, err = exec.Exec(recorder.bind("INSERT INTO "+SqlLockTable+" (app_name, lock_name, lock_owner, lease_version) VALUES (?, ?, ?, 0)"),
+			recorder.appName, name, recorder.owner); nil == err {
+			recorder.keepLease(name)
+			return
+		}
+
+		// 仅在锁记录存在(主键冲突)时等待重试, 锁记录不存在时可能刚被释放, 再试一次仍失败则返回错误
+		owner, version, held, qerr := recorder.getLease(name)
+		if nil != qerr {
+			return qerr
+		}
+		if !held {
+			if retried {
+				return
+			}
+			retried = true
+			continue
+		}
+		retried = false
+
+		// 租约变化时重新计时, 超过 LockExpire 未变化时删除该租约, 租约已变化时删除不生效
+		if lease := owner + "/" + strconv.FormatInt(version, 10); lease != observed {
+			observed, observedAt = lease, time.Now()
+		} else if time.Since(observedAt) >= recorder.LockExpire {
+			logs.Infof("> Module lock %s held by %s is expired ", name, owner)
+			if _, err = exec.Exec(recorder.bind("DELETE FROM "+SqlLockTable+" WHERE app_name = ? AND lock_name = ? AND lock_owner = ? AND lease_version = ?"),
+				recorder.appName, name, owner, version); nil != err {
+				return
+			}
+			observed = ""
+			continue
+		}
+		if time.Since(start) >= recorder.LockTimeout {
+			return fmt.Errorf("acquire module lock %s timeout, last error: %s", name, err.Error())
+		}
+		time.Sleep(recorder.LockRetry)
+	}
+}
+
+// Unlock 释放锁, 仅释放当前实例持有的锁
+func (recorder *SqlInfoRecorder) Unlock(name string) (err error) {
+	recorder.stopLease(name)
+	var res sql.Result
+	if res, err = recorder.provider.GetSqlExecutor().Exec(recorder.bind("DELETE FROM "+SqlLockTable+" WHERE app_name = ? AND lock_name = ? AND lock_owner = ?"),
+		recorder.appName, name, recorder.owner); nil != err {
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("module lock %s is not held by this instance", name)
+	}
+	return
+}
+
+// getLease 读取锁的租约, 锁记录不存在时 held 为 false
+func (recorder *SqlInfoRecorder) getLease(name string) (owner string, version int64, held bool, err error) {
+	var rows *sql.Rows
+	if rows, err = recorder.provider.GetSqlExecutor().Query(recorder.bind("SELECT lock_owner, lease_version FROM "+SqlLockTable+" WHERE app_name = ? AND lock_name = ?"), recorder.appName, name); nil != err {
+		return
+	}
+	defer rows.Close()
+	if held = rows.Next(); held {
+		if err = rows.Scan(&owner, &version); nil != err {
+			return
+		}
+	}
+	err = rows.Err()
+	return
+}
+
+// keepLease 持有锁期间按 LockRenew 定时递增租约版本号, 直到 stopLease
+func (recorder *SqlInfoRecorder) keepLease(name string) {
+	if recorder.LockRenew <= 0 {
+		return
+	}
+	stop := make(chan struct{})
+	recorder.llock.Lock()
+	if nil == recorder.leases {
+		recorder.leases = make(map[string]chan struct{})
+	}
+	recorder.leases[name] = stop
+	recorder.llock.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(recorder.LockRenew)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				res, err := recorder.provider.GetSqlExecutor().Exec(recorder.bind("UPDATE "+SqlLockTable+" SET lease_version = lease_version + 1 WHERE app_name = ? AND lock_name = ? AND lock_owner = ?"),
+					recorder.appName, name, recorder.owner)
+				if nil != err {
+					logs.Errorf("renew module lock %s failed: %s", name, err.Error())
+				} else if n, _ := res.RowsAffected(); n == 0 {
+					logs.Errorf("renew module lock %s failed: lock is not held by this instance", name)
+				}
+			}
+		}
+	}()
+}
+
+// stopLease 停止锁续期
+func (recorder *SqlInfoRecorder) stopLease(name string) {
+	recorder.llock.Lock()
+	defer recorder.llock.Unlock()
+	if stop, ok := recorder.leases[name]; ok {
+		close(stop)
+		delete(recorder.leases, name)
+	}
+}
+
+// bind 根据数据库类型替换占位符, postgres 使用 $n, oracle 使用 :n, 其他使用 ?
+func (recorder *SqlInfoRecorder) bind(query string) string {
+	var prefix string
+	if driverName := strings.ToUpper(recorder.provider.GetDriverName()); strings.Contains(driverName, "POSTGRES") || strings.Contains(driverName, "PGX") {
+		prefix = "$"
+	} else if strings.Contains(driverName, "ORACLE") || strings.Contains(driverName, "GODROR") {
+		prefix = ":"
+	} else {
+		return query
+	}
+
+	var sb strings.Builder
+	for i, n := 0, 1; i < len(query); i++ {
+		if query[i] == '?' {
+			sb.WriteString(prefix + strconv.Itoa(n))
+			n++
+		} else {
+			sb.WriteByte(query[i])
+		}
+	}
+	return sb.String()
+}
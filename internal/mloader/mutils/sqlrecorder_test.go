@@ -0,0 +1,340 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2024 WuPeng <wup364@outlook.com>.
+
+package mutils
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wup364/pakku/pkg/sqlutil/sqlexecutor"
+)
+
+// fakeDB 测试使用的内存数据库
+var fakeDB = &fakeDriver{tables: map[string]bool{}, infos: map[string]string{}, locks: map[string]fakeLock{}}
+
+func init() {
+	sql.Register("pakku-fake", fakeDB)
+}
+
+func TestSqlInfoRecorder(t *testing.T) {
+	db, err := sql.Open("pakku-fake", "")
+	if nil != err {
+		t.Fatal(err)
+	}
+	provider := sqlexecutor.NewSimpleSqlExecutorProvider("pakku-fake", db)
+
+	r1, r2 := NewSqlInfoRecorder(provider), NewSqlInfoRecorder(provider)
+	r2.LockTimeout, r2.LockRetry = 50*time.Millisecond, 10*time.Millisecond
+	if err = r1.Init("app"); nil != err {
+		t.Fatal(err)
+	}
+	if err = r2.Init("app"); nil != err {
+		t.Fatal(err)
+	}
+
+	if err = r1.SetValue("Demo.SetupVer", "1.0.0"); nil != err {
+		t.Fatal(err)
+	}
+	if err = r1.SetValue("Demo.SetupVer", "1.1.0"); nil != err {
+		t.Fatal(err)
+	}
+	if val := r2.GetValue("Demo.SetupVer"); val != "1.1.0" {
+		t.Fatalf("unexpected value: %s", val)
+	}
+
+	// 锁被 r1 持有, r2 等待超时
+	if err = r1.Lock("Demo"); nil != err {
+		t.Fatal(err)
+	}
+	if err = r2.Lock("Demo"); nil == err {
+		t.Fatal("lock should be held by r1")
+	}
+	if err = r2.Unlock("Demo"); nil == err {
+		t.Fatal("r2 should not release the lock of r1")
+	}
+	if err = r1.Unlock("Demo"); nil != err {
+		t.Fatal(err)
+	}
+
+	// 租约超过 LockExpire 未续期时可被其他实例获取
+	r2.LockExpire, r2.LockTimeout = 20*time.Millisecond, time.Second
+	if err = r1.Lock("Demo"); nil != err {
+		t.Fatal(err)
+	}
+	if err = r2.Lock("Demo"); nil != err {
+		t.Fatal(err)
+	}
+	if err = r1.Unlock("Demo"); nil == err {
+		t.Fatal("expired lock should be taken over by r2")
+	}
+	r2.Unlock("Demo")
+}
+
+func TestSqlInfoRecorderCreateTable(t *testing.T) {
+	db, err := sql.Open("pakku-fake", "")
+	if nil != err {
+		t.Fatal(err)
+	}
+	recorder := NewSqlInfoRecorder(sqlexecutor.NewSimpleSqlExecutorProvider("pakku-fake", db))
+
+	// 不使用 CREATE TABLE IF NOT EXISTS, 表已存在时不再创建
+	fakeDB.dropTables()
+	if err = recorder.Init("create"); nil != err {
+		t.Fatal(err)
+	}
+	if err = recorder.Init("create"); nil != err {
+		t.Fatal(err)
+	}
+	if !fakeDB.hasTable(SqlInfoTable) || !fakeDB.hasTable(SqlLockTable) {
+		t.Fatal("tables are not created")
+	}
+}
+
+func TestSqlInfoRecorderErrors(t *testing.T) {
+	db, err := sql.Open("pakku-fake", "")
+	if nil != err {
+		t.Fatal(err)
+	}
+	recorder := NewSqlInfoRecorder(sqlexecutor.NewSimpleSqlExecutorProvider("pakku-fake", db))
+	if err = recorder.Init("errors"); nil != err {
+		t.Fatal(err)
+	}
+
+	// 读取失败时返回错误
+	fakeDB.setFail(errors.New("connection refused"))
+	if _, err = recorder.GetValueE("Demo.SetupVer"); nil == err {
+		t.Fatal("read error should be returned")
+	}
+	if val := recorder.GetValue("Demo.SetupVer"); val != "" {
+		t.Fatalf("unexpected value: %s", val)
+	}
+
+	// 非锁冲突的错误不重试
+	start := time.Now()
+	if err = recorder.Lock("Demo"); nil == err || !strings.Contains(err.Error(), "connection refused") || time.Since(start) > time.Second {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fakeDB.setFail(nil)
+}
+
+func TestSqlInfoRecorderLease(t *testing.T) {
+	db, err := sql.Open("pakku-fake", "")
+	if nil != err {
+		t.Fatal(err)
+	}
+	provider := sqlexecutor.NewSimpleSqlExecutorProvider("pakku-fake", db)
+	r1, r2 := NewSqlInfoRecorder(provider), NewSqlInfoRecorder(provider)
+	r1.LockRenew = 10 * time.Millisecond
+	r2.LockExpire, r2.LockTimeout, r2.LockRetry = 50*time.Millisecond, 150*time.Millisecond, 10*time.Millisecond
+	r1.Init("lease")
+	r2.Init("lease")
+
+	// 持有期间续期, 等待超过 LockExpire 后锁仍有效
+	if err = r1.Lock("Demo"); nil != err {
+		t.Fatal(err)
+	}
+	if err = r2.Lock("Demo"); nil == err {
+		t.Fatal("lock should be renewed by r1")
+	}
+	if err = r1.Unlock("Demo"); nil != err {
+		t.Fatal(err)
+	}
+	if err = r2.Lock("Demo"); nil != err {
+		t.Fatal(err)
+	}
+	r2.Unlock("Demo")
+}
+
+func TestSqlInfoRecorderBind(t *testing.T) {
+	recorder := NewSqlInfoRecorder(sqlexecutor.NewSimpleSqlExecutorProvider("postgres", nil))
+	if query := recorder.bind("a = ? AND b = ?"); query != "a = $1 AND b = $2" {
+		t.Fatalf("unexpected query: %s", query)
+	}
+}
+
+// fakeLock 锁记录
+type fakeLock struct {
+	owner   string
+	version int64
+}
+
+// fakeDriver 仅支持 SqlInfoRecorder 所使用语句的内存数据库驱动
+type fakeDriver struct {
+	l      sync.Mutex
+	fail   error // 不为空时, 查询和写入锁记录返回该错误
+	tables map[string]bool
+	infos  map[string]string
+	locks  map[string]fakeLock
+}
+
+// dropTables 删除所有表
+func (d *fakeDriver) dropTables() {
+	d.l.Lock()
+	defer d.l.Unlock()
+	d.tables = map[string]bool{}
+}
+
+// hasTable 表是否存在
+func (d *fakeDriver) hasTable(table string) bool {
+	d.l.Lock()
+	defer d.l.Unlock()
+	return d.tables[table]
+}
+
+// setFail 设置查询和写入锁记录返回的错误
+func (d *fakeDriver) setFail(err error) {
+	d.l.Lock()
+	defer d.l.Unlock()
+	d.fail = err
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{d: d}, nil
+}
+
+// fakeConn 数据库连接
+type fakeConn struct {
+	d *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{d: c.d, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c, nil
+}
+
+func (c *fakeConn) Commit() error {
+	return nil
+}
+
+func (c *fakeConn) Rollback() error {
+	return nil
+}
+
+// fakeStmt 语句, 按语句前缀区分操作
+type fakeStmt struct {
+	d     *fakeDriver
+	query string
+}
+
+func (s *fakeStmt) Close() error {
+	return nil
+}
+
+func (s *fakeStmt) NumInput() int {
+	return -1
+}
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.d.l.Lock()
+	defer s.d.l.Unlock()
+
+	key := func() string { return fmt.Sprint(args[0], args[1]) }
+	switch {
+	case strings.HasPrefix(s.query, "CREATE TABLE IF NOT EXISTS"):
+		return nil, errors.New("syntax error: " + s.query)
+	case strings.HasPrefix(s.query, "CREATE TABLE"):
+		table := strings.Fields(s.query)[2]
+		if s.d.tables[table] {
+			return nil, errors.New("table already exists: " + table)
+		}
+		s.d.tables[table] = true
+	case strings.HasPrefix(s.query, "DELETE FROM "+SqlInfoTable):
+		delete(s.d.infos, key())
+	case strings.HasPrefix(s.query, "INSERT INTO "+SqlInfoTable):
+		s.d.infos[key()] = args[2].(string)
+	case strings.HasPrefix(s.query, "DELETE FROM "+SqlLockTable) && strings.HasSuffix(s.query, "lease_version = ?"):
+		if lock, ok := s.d.locks[key()]; ok && lock.owner == args[2].(string) && lock.version == args[3].(int64) {
+			delete(s.d.locks, key())
+			return driver.RowsAffected(1), nil
+		}
+		return driver.RowsAffected(0), nil
+	case strings.HasPrefix(s.query, "DELETE FROM "+SqlLockTable):
+		if lock, ok := s.d.locks[key()]; ok && lock.owner == args[2].(string) {
+			delete(s.d.locks, key())
+			return driver.RowsAffected(1), nil
+		}
+		return driver.RowsAffected(0), nil
+	case strings.HasPrefix(s.query, "INSERT INTO "+SqlLockTable):
+		if nil != s.d.fail {
+			return nil, s.d.fail
+		}
+		if _, ok := s.d.locks[key()]; ok {
+			return nil, errors.New("duplicate key")
+		}
+		s.d.locks[key()] = fakeLock{owner: args[2].(string)}
+	case strings.HasPrefix(s.query, "UPDATE "+SqlLockTable):
+		if lock, ok := s.d.locks[key()]; ok && lock.owner == args[2].(string) {
+			s.d.locks[key()] = fakeLock{owner: lock.owner, version: lock.version + 1}
+			return driver.RowsAffected(1), nil
+		}
+		return driver.RowsAffected(0), nil
+	default:
+		return nil, errors.New("unsupported query: " + s.query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.d.l.Lock()
+	defer s.d.l.Unlock()
+
+	if nil != s.d.fail {
+		return nil, s.d.fail
+	}
+	if strings.HasPrefix(s.query, "SELECT 1 FROM") {
+		if table := strings.Fields(s.query)[3]; !s.d.tables[table] {
+			return nil, errors.New("table not found: " + table)
+		}
+		return &fakeRows{cols: []string{"1"}}, nil
+	}
+	if strings.HasPrefix(s.query, "SELECT lock_owner") {
+		rows := &fakeRows{cols: []string{"lock_owner", "lease_version"}}
+		if lock, ok := s.d.locks[fmt.Sprint(args[0], args[1])]; ok {
+			rows.vals = append(rows.vals, []driver.Value{lock.owner, lock.version})
+		}
+		return rows, nil
+	}
+	rows := &fakeRows{cols: []string{"info_value"}}
+	if val, ok := s.d.infos[fmt.Sprint(args[0], args[1])]; ok {
+		rows.vals = append(rows.vals, []driver.Value{val})
+	}
+	return rows, nil
+}
+
+// fakeRows 查询结果
+type fakeRows struct {
+	cols []string
+	vals [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.cols
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.vals) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.vals[0])
+	r.vals = r.vals[1:]
+	return nil
+}
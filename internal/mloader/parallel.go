@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 模块加载器-并行加载
+// 模块的依赖全部加载完成后立即进入就绪队列, 同时加载的模块最多 parallelism 个, 耗时的模块不会阻塞与其无关的模块.
+// 模块事件在模块的加载线程中同步执行(OnReady 的监听函数会完成依赖注入等准备工作), 监听函数串行执行, 不会并发调用.
+// 同一模块的事件按生命周期顺序执行, 被依赖模块的 OnLoaded 一定先于依赖它的模块的 OnReady 执行;
+// 相互无依赖的模块之间, 事件按实际加载的先后执行
+
+package mloader
+
+import (
+	"sort"
+
+	"github.com/wup364/pakku/ipakku"
+)
+
+// SetParallelism 设置并行加载的最大并发数, 小于等于1时顺序加载. 需在 Loads 之前设置
+func (loader *Loader) SetParallelism(workers int) {
+	loader.parallelism = workers
+}
+
+// loadResult 单个模块的加载结果
+type loadResult struct {
+	index int
+	err   error
+}
+
+// loadsParallel 并行加载模块, mts 为已排序的模块, 被依赖的模块排在前面.
+// 出现失败后不再启动新的模块, 等待加载中的模块结束后返回排序最靠前的失败模块的错误
+func (loader *Loader) loadsParallel(mts []ipakku.Module, deps map[string][]string) (failed error) {
+	indexes := make(map[string]int, len(mts))
+	for i := 0; i < len(mts); i++ {
+		indexes[loader.getModuleName(mts[i])] = i
+	}
+
+	// waiting 为模块尚未加载完成的依赖数, dependents 为依赖该模块的模块
+	waiting := make([]int, len(mts))
+	dependents := make([][]int, len(mts))
+	var ready []int
+	for i := 0; i < len(mts); i++ {
+		for _, dep := range deps[loader.getModuleName(mts[i])] {
+			if j, ok := indexes[dep]; ok {
+				waiting[i]++
+				dependents[j] = append(dependents[j], i)
+			}
+		}
+		if waiting[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	results := make(chan loadResult)
+	failedIndex, running := len(mts), 0
+	for {
+		// 就绪的模块按排序顺序启动
+		for nil == failed && running < loader.parallelism && len(ready) > 0 {
+			go loader.loadAsync(ready[0], mts[ready[0]], results)
+			ready = ready[1:]
+			running++
+		}
+		if running == 0 {
+			return
+		}
+
+		res := <-results
+		running--
+		if nil != res.err {
+			if res.index < failedIndex {
+				failed, failedIndex = res.err, res.index
+			}
+			continue
+		}
+		for _, i := range dependents[res.index] {
+			if waiting[i]--; waiting[i] == 0 {
+				ready = append(ready, i)
+			}
+		}
+		sort.Ints(ready)
+	}
+}
+
+// loadAsync 加载模块, 并将结果写入 results
+func (loader *Loader) loadAsync(index int, mt ipakku.Module, results chan<- loadResult) {
+	results <- loadResult{index: index, err: loader.tryLoad(mt)}
+}
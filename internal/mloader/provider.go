@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 模块加载器-构造函数模块
+
+package mloader
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/wup364/pakku/internal/mloader/mutils"
+	"github.com/wup364/pakku/ipakku"
+)
+
+// errorType error 接口类型
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// NewProviderModule 使用构造函数创建模块, 如: func(conf ipakku.AppConfig) (MyService, error)
+// 函数参数按类型名从已加载的模块中获取(规则同 @autowired:""), 返回值作为模块, 模块名为返回值的类型名.
+// 返回值若实现了 ipakku.Module, 则使用其生命周期函数
+func NewProviderModule(fn any) (ipakku.Module, error) {
+	fval := reflect.ValueOf(fn)
+	if !fval.IsValid() || fval.Kind() != reflect.Func {
+		return nil, fmt.Errorf("provider must be a function, got %T", fn)
+	}
+
+	ftype := fval.Type()
+	if ftype.NumOut() == 0 || ftype.NumOut() > 2 || (ftype.NumOut() == 2 && ftype.Out(1) != errorType) {
+		return nil, fmt.Errorf("provider %s must return (T) or (T, error)", ftype.String())
+	}
+
+	name := ftype.Out(0).Name()
+	if ftype.Out(0).Kind() == reflect.Ptr {
+		name = ftype.Out(0).Elem().Name()
+	} else if ftype.Out(0).Kind() != reflect.Interface {
+		return nil, fmt.Errorf("provider %s must return an interface or a pointer", ftype.String())
+	}
+	if len(name) == 0 {
+		return nil, fmt.Errorf("provider %s must return a named type", ftype.String())
+	}
+	for i := 0; i < ftype.NumIn(); i++ {
+		if _, err := mutils.ParseAutowiredTag("", ftype.In(i)); nil != err {
+			return nil, fmt.Errorf("provider %s param %d, error: %s", ftype.String(), i, err.Error())
+		}
+	}
+	return &providerModule{name: name, fn: fval}, nil
+}
+
+// providerModule 构造函数模块, 加载时调用构造函数生成实例
+type providerModule struct {
+	name  string
+	fn    reflect.Value
+	value any // 构造函数返回的实例
+}
+
+// AsModule 作为一个模块加载
+func (pm *providerModule) AsModule() ipakku.Opts {
+	opts := ipakku.Opts{Description: "Provider of " + pm.name}
+	if mt, ok := pm.value.(ipakku.Module); ok {
+		opts = mt.AsModule()
+	}
+	opts.Name = pm.name
+	return opts
+}
+
+// provide 调用构造函数, 参数从 app 中获取
+func (pm *providerModule) provide(app ipakku.Application) (err error) {
+	if nil != pm.value {
+		return
+	}
+
+	var args []reflect.Value
+	if args, err = mutils.GetFuncArgs(pm.fn.Type(), app); nil != err {
+		return fmt.Errorf("provider %s failed, error: %s", pm.name, err.Error())
+	}
+
+	res := pm.fn.Call(args)
+	if len(res) == 2 && !res[1].IsNil() {
+		return fmt.Errorf("provider %s failed, error: %w", pm.name, res[1].Interface().(error))
+	}
+	if (res[0].Kind() == reflect.Interface || res[0].Kind() == reflect.Ptr) && res[0].IsNil() {
+		return errors.New("provider " + pm.name + " returned nil")
+	}
+	pm.value = res[0].Interface()
+	return
+}
+
+// dependencies 构造函数参数依赖
+func (pm *providerModule) dependencies() mutils.AutoWiredDependencies {
+	return mutils.GetFuncDependencies(pm.name, pm.fn.Type())
+}
+
+// moduleType 模块类型, 构造函数模块返回其返回值类型
+func moduleType(mt ipakku.Module) reflect.Type {
+	if pm, ok := mt.(*providerModule); ok {
+		return pm.fn.Type().Out(0)
+	}
+	return reflect.TypeOf(mt)
+}
+
+// eventTarget 模块事件的对象, 构造函数模块的实例为结构体指针时返回实例, 否则返回模块本身
+func eventTarget(mt ipakku.Module) any {
+	if val := unwrapModule(mt); val != any(mt) {
+		if t := reflect.TypeOf(val); t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Struct {
+			return val
+		}
+	}
+	return mt
+}
+
+// unwrapModule 构造函数模块返回其实例, 其他模块返回本身
+func unwrapModule(mt ipakku.Module) any {
+	if pm, ok := mt.(*providerModule); ok && nil != pm.value {
+		return pm.value
+	}
+	return mt
+}
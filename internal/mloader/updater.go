@@ -0,0 +1,239 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 模块加载器-模块升级
+
+package mloader
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wup364/pakku/ipakku"
+	"github.com/wup364/pakku/pkg/logs"
+	"github.com/wup364/pakku/pkg/utypes"
+)
+
+// PlanUpdates 预演升级, 返回需要升级的模块及将要执行的升级器版本, 不执行升级
+func (loader *Loader) PlanUpdates(mts ...ipakku.Module) (plans []ipakku.UpdatePlan, err error) {
+	newMts, _, err := loader.dependencySort(mts...)
+	if nil != err {
+		return
+	}
+
+	for i := 0; i < len(newMts); i++ {
+		// 构造函数模块未加载前无法得知版本
+		if pm, ok := newMts[i].(*providerModule); ok && nil == pm.value {
+			continue
+		}
+
+		opts := newMts[i].AsModule()
+		moduleName := loader.getModuleName(newMts[i])
+		version, verr := opts.GetSemVer()
+		if nil != verr {
+			return nil, &ipakku.BootError{Module: moduleName, Phase: ipakku.BootPhaseVersion, Err: verr}
+		}
+		var fromVersion string
+		if fromVersion, err = loader.getRecord(moduleName + ".SetupVer"); nil == err {
+			fromVersion, err = loader.legacySemVer(moduleName, opts, fromVersion)
+		}
+		if nil != err {
+			return nil, &ipakku.BootError{Module: moduleName, Phase: ipakku.BootPhaseVersion, Err: err}
+		}
+		if len(fromVersion) == 0 || loader.isVersionRecorded(fromVersion, version) {
+			continue
+		}
+
+		var execList []versionedUpdater
+		if execList, err = loader.getUpdaters(opts, fromVersion, version); nil != err {
+			return nil, &ipakku.BootError{Module: moduleName, Phase: string(ipakku.ModuleEventOnUpdate), Err: err}
+		}
+		plan := ipakku.UpdatePlan{Module: moduleName, FromVersion: fromVersion, ToVersion: version.String()}
+		for j := 0; j < len(execList); j++ {
+			plan.Updaters = append(plan.Updaters, execList[j].version.String())
+		}
+		plans = append(plans, plan)
+	}
+	return
+}
+
+// doUpdate 模块升级, fromVersion 为已记录的版本号. 升级失败时逆序执行已执行升级器的 Rollback, 并恢复升级前的版本号
+// 升级过程记录在 {module}.Upgrade.{ver} 下: StartDate FinishDate FailureDate Error RollbackDate
+func (loader *Loader) doUpdate(moduleId string, opts ipakku.Opts, fromVersion string, version utypes.SemVer) error {
+	execList, err := loader.getUpdaters(opts, fromVersion, version)
+	if nil != err {
+		return err
+	}
+
+	for i := 0; i < len(execList); i++ {
+		ver := execList[i].version
+		logs.Infof("> Execute %s.Update ver=%s ", moduleId, ver)
+		if err := loader.setUpgradeJournal(moduleId, ver, "StartDate", strconv.FormatInt(time.Now().UnixNano(), 10)); nil != err {
+			return loader.failUpdate(moduleId, fromVersion, ver, execList[:i], err)
+		}
+		err := loader.executeUpdater(execList[i].Updater)
+		if nil == err {
+			err = loader.setVersion(moduleId, ver)
+		}
+		if nil == err {
+			err = loader.setUpgradeJournal(moduleId, ver, "FinishDate", strconv.FormatInt(time.Now().UnixNano(), 10))
+		}
+		if nil != err {
+			return loader.failUpdate(moduleId, fromVersion, ver, execList[:i+1], err)
+		}
+		logs.Infof("> Completed %s.Update ver=%s ", moduleId, ver)
+	}
+
+	if err := loader.setVersion(moduleId, version); nil != err {
+		return loader.failUpdate(moduleId, fromVersion, version, execList, err)
+	}
+	return nil
+}
+
+// failUpdate 升级失败, 逆序执行已执行升级器的 Rollback 并恢复升级前的版本号.
+// 记录日志、回滚或恢复版本号失败时, 一并返回
+func (loader *Loader) failUpdate(moduleId, fromVersion string, ver utypes.SemVer, executed []versionedUpdater, cause error) error {
+	var errs []string
+	if err := loader.setUpgradeJournal(moduleId, ver, "FailureDate", strconv.FormatInt(time.Now().UnixNano(), 10)); nil != err {
+		errs = append(errs, "write journal failed: "+err.Error())
+	} else if err = loader.setUpgradeJournal(moduleId, ver, "Error", cause.Error()); nil != err {
+		errs = append(errs, "write journal failed: "+err.Error())
+	}
+	errs = append(errs, loader.rollbackUpdaters(moduleId, executed)...)
+	if err := loader.mrecord.SetValue(moduleId+".SetupVer", fromVersion); nil != err {
+		errs = append(errs, fmt.Sprintf("restore version %s failed: %s", fromVersion, err.Error()))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("update to ver=%s failed: %w; %s", ver, cause, strings.Join(errs, "; "))
+	}
+	return fmt.Errorf("update to ver=%s failed: %w", ver, cause)
+}
+
+// legacySemVer 将旧的两位小数版本号记录转换为语义化版本号, 模块设置了 LegacySemVer 时使用其转换结果,
+// 否则与 Version 的转换规则相同(如: 1.1 => 1.10.0). 非旧的记录原样返回
+func (loader *Loader) legacySemVer(moduleId string, opts ipakku.Opts, ver string) (string, error) {
+	fv, ok := parseLegacyVersion(ver)
+	if !ok {
+		return ver, nil
+	}
+	if nil == opts.LegacySemVer {
+		return utypes.FloatToSemVer(fv).String(), nil
+	}
+	semver, err := utypes.ParseSemVer(opts.LegacySemVer(fv))
+	if nil != err {
+		return ver, fmt.Errorf("convert legacy version record %s.SetupVer=%s failed: %s", moduleId, ver, err.Error())
+	}
+	return semver.String(), nil
+}
+
+// migrateLegacyVersion 将旧的两位小数版本号记录转换为语义化版本号并保存, 返回转换后的版本号
+func (loader *Loader) migrateLegacyVersion(moduleId string, opts ipakku.Opts, ver string) (string, error) {
+	semver, err := loader.legacySemVer(moduleId, opts, ver)
+	if nil != err || semver == ver {
+		return semver, err
+	}
+	if err = loader.mrecord.SetValue(moduleId+".SetupVer", semver); nil != err {
+		return ver, err
+	}
+	logs.Infof("> Migrate %s.SetupVer %s => %s ", moduleId, ver, semver)
+	if cur, verr := opts.GetSemVer(); nil == verr && nil == opts.LegacySemVer && cur.Compare(utypes.MustParseSemVer(semver)) < 0 {
+		logs.Warnf("> %s.SetupVer %s is converted to %s which is newer than %s, set Opts.LegacySemVer if it is not expected ", moduleId, ver, semver, cur)
+	}
+	return semver, nil
+}
+
+// versionedUpdater 带语义化版本号的升级器
+type versionedUpdater struct {
+	ipakku.Updater
+	version utypes.SemVer
+}
+
+// isVersionRecorded 已记录的版本号 recorded 是否与 version 相同
+func (loader *Loader) isVersionRecorded(recorded string, version utypes.SemVer) bool {
+	ver, err := utypes.ParseSemVer(recorded)
+	return nil == err && ver.Compare(version) == 0
+}
+
+// getUpdaters 获取需要执行的升级器, 版本号在 (fromVersion, version] 范围内, 按版本号排序
+func (loader *Loader) getUpdaters(opts ipakku.Opts, fromVersion string, version utypes.SemVer) (execList []versionedUpdater, err error) {
+	var recorded utypes.SemVer
+	if recorded, err = utypes.ParseSemVer(fromVersion); nil != err {
+		return
+	}
+	if recorded.Compare(version) > 0 && loader.GetParam(ipakku.PARAMS_KEY_REFUSE_DOWNGRADE).ToBool(false) {
+		return nil, fmt.Errorf("downgrade is refused, recorded version %s is newer than %s", recorded, version)
+	}
+	if nil == opts.Updaters {
+		return
+	}
+
+	var vrange utypes.SemVerRange
+	if vrange, err = utypes.ParseSemVerRange(">" + recorded.String() + " <=" + version.String()); nil != err {
+		return
+	}
+	updaters := opts.Updaters(loader)
+	for i := 0; i < len(updaters); i++ {
+		var upv utypes.SemVer
+		if upv, err = ipakku.GetUpdaterSemVer(updaters[i]); nil != err {
+			return nil, err
+		}
+		if vrange.Contains(upv) {
+			execList = append(execList, versionedUpdater{Updater: updaters[i], version: upv})
+		}
+	}
+	sort.SliceStable(execList, func(i, j int) bool {
+		return execList[i].version.Compare(execList[j].version) < 0
+	})
+	return
+}
+
+// executeUpdater 执行升级器, panic 转换为错误返回
+func (loader *Loader) executeUpdater(updater ipakku.Updater) (err error) {
+	defer func() {
+		if r := recover(); nil != r {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return updater.Execute(loader)
+}
+
+// rollbackUpdaters 逆序执行升级器的 Rollback, 未实现 ipakku.RollbackUpdater 的升级器跳过, 返回回滚或记录日志失败的信息
+func (loader *Loader) rollbackUpdaters(moduleId string, updaters []versionedUpdater) (errs []string) {
+	for i := len(updaters) - 1; i >= 0; i-- {
+		rollbacker, ok := updaters[i].Updater.(ipakku.RollbackUpdater)
+		if !ok {
+			continue
+		}
+
+		ver := updaters[i].version
+		logs.Infof("> Rollback %s.Update ver=%s ", moduleId, ver)
+		err := func() (err error) {
+			defer func() {
+				if r := recover(); nil != r {
+					err = fmt.Errorf("%v", r)
+				}
+			}()
+			return rollbacker.Rollback(loader)
+		}()
+		if nil != err {
+			logs.Errorf("> Rollback %s.Update ver=%s failed: %s ", moduleId, ver, err.Error())
+			errs = append(errs, fmt.Sprintf("rollback ver=%s failed: %s", ver, err.Error()))
+			err = loader.setUpgradeJournal(moduleId, ver, "RollbackError", err.Error())
+		} else {
+			err = loader.setUpgradeJournal(moduleId, ver, "RollbackDate", strconv.FormatInt(time.Now().UnixNano(), 10))
+		}
+		if nil != err {
+			errs = append(errs, "write journal failed: "+err.Error())
+		}
+	}
+	return
+}
+
+// setUpgradeJournal 记录升级日志, key 如: {module}.Upgrade.1_10_0.StartDate
+func (loader *Loader) setUpgradeJournal(moduleId string, version utypes.SemVer, key, value string) error {
+	ver := strings.ReplaceAll(version.String(), ".", "_")
+	return loader.mrecord.SetValue(moduleId+".Upgrade."+ver+"."+key, value)
+}
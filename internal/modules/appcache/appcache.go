@@ -11,13 +11,21 @@ import (
 
 	// 注册
 	_ "github.com/wup364/pakku/internal/modules/appcache/localcache"
+	_ "github.com/wup364/pakku/internal/modules/appcache/rediscache"
+	_ "github.com/wup364/pakku/internal/modules/appcache/tieredcache"
 )
 
+func init() {
+	// 注册的 ICache 实现由本模块选用并初始化
+	ipakku.PakkuConf.SetPakkuModuleImplementOwner("ICache", "AppCache")
+}
+
 // AppCache 配置模块
 type AppCache struct {
 	appname string
 	cache   ipakku.ICache
 	conf    ipakku.AppConfig `@autowired:""`
+	event   ipakku.AppEvent  `@autowired:"?"`
 }
 
 // AsModule 作为一个模块加载
@@ -33,8 +41,20 @@ func (cache *AppCache) AsModule() ipakku.Opts {
 			cache.appname = app.Params().GetParam(ipakku.PARAMS_KEY_APPNAME).ToString(ipakku.DEFT_VAL_APPNAME)
 		},
 		OnInit: func() {
+			// 需要与其他实例通信的缓存实现(如: tiered)使用事件模块, 未启用事件模块时不设置
+			if setter, ok := cache.cache.(ipakku.CacheEventSetter); ok && nil != cache.event {
+				setter.SetAppEvent(cache.event)
+			}
 			// 初始化配置
 			cache.cache.Init(cache.conf, cache.appname)
+			ipakku.PakkuConf.SetPakkuModuleImplementInitialized(cache.cache, true)
+		},
+		OnShutdown: func() {
+			// 释放缓存实现持有的资源(如清理线程)
+			ipakku.PakkuConf.SetPakkuModuleImplementInitialized(cache.cache, false)
+			if destroyer, ok := cache.cache.(interface{ Destroy() }); ok {
+				destroyer.Destroy()
+			}
 		},
 	}
 }
@@ -44,13 +64,32 @@ func (cache *AppCache) RegLib(clib string, second int64) error {
 	return cache.cache.RegLib(clib, second)
 }
 
+// RegLibWithOptions 按选项注册缓存库, 缓存实现不支持时仅在未设置容量限制的情况下按 RegLib 注册
+func (cache *AppCache) RegLibWithOptions(clib string, opts ipakku.CacheLibOptions) error {
+	if register, ok := cache.cache.(ipakku.CacheLibRegister); ok {
+		return register.RegLibWithOptions(clib, opts)
+	}
+	if opts.MaxEntries > 0 || opts.MaxBytes > 0 || nil != opts.OnEvict {
+		return ipakku.ErrCacheNotSupported
+	}
+	return cache.cache.RegLib(clib, opts.Expire)
+}
+
+// Stats 获取缓存库统计信息
+func (cache *AppCache) Stats(clib string) (ipakku.CacheLibStats, error) {
+	if getter, ok := cache.cache.(ipakku.CacheStatsGetter); ok {
+		return getter.Stats(clib)
+	}
+	return ipakku.CacheLibStats{}, ipakku.ErrCacheNotSupported
+}
+
 // Exists 返回key是否存在
 func (cache *AppCache) Exists(clib string, key string) (bool, error) {
 	return cache.cache.Exists(clib, key)
 }
 
 // Set 向lib库中设置键为key的值
-// args[0] 为缓存值 args[2]如果存在, 则覆盖默认过期时间, 单位秒
+// args[0] 为缓存值 args[1]如果存在, 则覆盖默认过期时间, 单位秒
 func (cache *AppCache) Set(clib string, key string, args ...any) error {
 	if len(args) < 1 {
 		return ipakku.ErrCacheArgsEmpty
@@ -59,7 +98,7 @@ func (cache *AppCache) Set(clib string, key string, args ...any) error {
 }
 
 // SetNX 向lib库中设置键为key的值, 当key不存在时设置成功, 并返回true
-// args[0] 为缓存值 args[2]如果存在, 则覆盖默认过期时间, 单位秒
+// args[0] 为缓存值 args[1]如果存在, 则覆盖默认过期时间, 单位秒
 func (cache *AppCache) SetNX(clib string, key string, args ...any) (bool, error) {
 	if len(args) < 1 {
 		return false, ipakku.ErrCacheArgsEmpty
@@ -68,7 +107,7 @@ func (cache *AppCache) SetNX(clib string, key string, args ...any) (bool, error)
 }
 
 // Incrby 指定key以increment的值累加, 返回累加后的值
-// args[0] 为缓存值 args[2]如果存在, 则覆盖默认过期时间, 单位秒
+// args[0] 为缓存值 args[1]如果存在, 则覆盖默认过期时间, 单位秒
 func (cache *AppCache) Incrby(clib string, key string, args ...any) (int64, error) {
 	if len(args) < 1 {
 		return -1, ipakku.ErrCacheArgsEmpty
@@ -0,0 +1,265 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 缓存库, 在 TokenManager 的基础上增加容量限制和统计
+
+package localcache
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/wup364/pakku/ipakku"
+)
+
+// entryOverhead 估算占用字节数时每个key的额外开销(map节点、过期时间、淘汰策略节点等)
+const entryOverhead = 96
+
+// newCacheLib 新建缓存库, 过期清理由 scheduler 负责
+func newCacheLib(opts ipakku.CacheLibOptions, scheduler *expiryScheduler) *cacheLib {
+	lib := &cacheLib{opts: opts, l: new(sync.Mutex)}
+	if lib.bounded() {
+		lib.policy = newEvictPolicy(opts.Policy)
+		lib.sizes = make(map[string]int64)
+	}
+	lib.tm = (&TokenManager{}).setScheduler(scheduler).SetExpiredListener(lib.onExpired).Init()
+	return lib
+}
+
+// cacheLib 缓存库, 未设置容量限制时不记录访问情况
+type cacheLib struct {
+	tm        *TokenManager
+	opts      ipakku.CacheLibOptions
+	policy    evictPolicy
+	sizes     map[string]int64
+	bytes     int64
+	hits      uint64
+	misses    uint64
+	evictions uint64
+	l         *sync.Mutex
+}
+
+// evictedEntry 被淘汰的key
+type evictedEntry struct {
+	key string
+	val any
+}
+
+// bounded 是否设置了容量限制
+func (lib *cacheLib) bounded() bool {
+	return lib.opts.MaxEntries > 0 || lib.opts.MaxBytes > 0
+}
+
+// get 读取, 命中时记录访问
+func (lib *cacheLib) get(key string) (any, bool) {
+	val, ok := lib.tm.GetTokenBody(key)
+	if !ok {
+		atomic.AddUint64(&lib.misses, 1)
+		return nil, false
+	}
+	atomic.AddUint64(&lib.hits, 1)
+	if nil != lib.policy {
+		lib.l.Lock()
+		lib.policy.Touch(key)
+		lib.l.Unlock()
+	}
+	return val, true
+}
+
+// put 写入, 返回因超出容量被淘汰的key
+func (lib *cacheLib) put(key string, val any, second int64) []evictedEntry {
+	lib.l.Lock()
+	defer lib.l.Unlock()
+	lib.tm.PutTokenBody(key, val, second)
+	return lib.added(key, val)
+}
+
+// putNX key不存在时写入
+func (lib *cacheLib) putNX(key string, val any, second int64) (bool, []evictedEntry) {
+	lib.l.Lock()
+	defer lib.l.Unlock()
+	if !lib.tm.PutTokenBodyNX(key, val, second) {
+		return false, nil
+	}
+	return true, lib.added(key, val)
+}
+
+// incrby 累加, key不存在时以 val 为初始值写入
+func (lib *cacheLib) incrby(key string, val int64, second int64) (int64, []evictedEntry) {
+	lib.l.Lock()
+	defer lib.l.Unlock()
+	if oldval, ok := lib.tm.GetTokenBody(key); ok {
+		tmp := oldval.(*StructValue)
+		tmp.Value = tmp.Value.(int64) + val
+		if nil != lib.policy {
+			lib.policy.Touch(key)
+		}
+		return tmp.Value.(int64), nil
+	}
+	sv := &StructValue{val}
+	lib.tm.PutTokenBody(key, sv, second)
+	return val, lib.added(key, sv)
+}
+
+// del 删除
+func (lib *cacheLib) del(key string) {
+	lib.l.Lock()
+	defer lib.l.Unlock()
+	lib.tm.DestroyToken(key)
+	lib.removed(key)
+}
+
+// clear 清空
+func (lib *cacheLib) clear() {
+	lib.l.Lock()
+	defer lib.l.Unlock()
+	lib.tm.Clear()
+	if nil != lib.policy {
+		lib.policy.Clear()
+		lib.sizes = make(map[string]int64)
+		lib.bytes = 0
+	}
+}
+
+// stats 统计信息
+func (lib *cacheLib) stats() ipakku.CacheLibStats {
+	lib.l.Lock()
+	defer lib.l.Unlock()
+	res := ipakku.CacheLibStats{
+		Bytes:     lib.bytes,
+		Hits:      atomic.LoadUint64(&lib.hits),
+		Misses:    atomic.LoadUint64(&lib.misses),
+		Evictions: atomic.LoadUint64(&lib.evictions),
+	}
+	if nil != lib.policy {
+		res.Entries = lib.policy.Len()
+	} else {
+		res.Entries = len(lib.tm.ListTokens())
+	}
+	return res
+}
+
+// getExpSecond 获取过期时间, 若args[1]有值, 则返回args[1]的值, 否则返回注册lib时的值
+func (lib *cacheLib) getExpSecond(args ...any) (int64, error) {
+	if len(args) > 1 {
+		if val, ok := args[1].(int64); ok {
+			return val, nil
+		} else if val, ok := args[1].(int); ok {
+			return int64(val), nil
+		} else {
+			return -1, ipakku.ErrCacheArgsTypeError
+		}
+	}
+	return lib.opts.Expire, nil
+}
+
+// notifyEvicted 回调淘汰通知, 需在释放锁之后调用
+func (lib *cacheLib) notifyEvicted(evicted []evictedEntry) {
+	if nil == lib.opts.OnEvict {
+		return
+	}
+	for _, e := range evicted {
+		lib.opts.OnEvict(e.key, e.val)
+	}
+}
+
+// added 记录写入的key并淘汰超出容量的key, 不会淘汰刚写入的key, 需持有锁
+func (lib *cacheLib) added(key string, val any) (evicted []evictedEntry) {
+	if nil == lib.policy {
+		return
+	}
+	lib.policy.Add(key)
+	if lib.opts.MaxBytes > 0 {
+		size := estimateSize(key, val)
+		lib.bytes += size - lib.sizes[key]
+		lib.sizes[key] = size
+	}
+	for lib.overflow() {
+		victim, ok := lib.policy.Victim(key)
+		if !ok {
+			break
+		}
+		val, _ := lib.tm.tokenMap.Get(victim)
+		lib.tm.DestroyToken(victim)
+		lib.removed(victim)
+		atomic.AddUint64(&lib.evictions, 1)
+		evicted = append(evicted, evictedEntry{key: victim, val: val.O})
+	}
+	return
+}
+
+// removed 移除key的记录, 需持有锁
+func (lib *cacheLib) removed(key string) {
+	if nil == lib.policy {
+		return
+	}
+	lib.policy.Remove(key)
+	if size, ok := lib.sizes[key]; ok {
+		lib.bytes -= size
+		delete(lib.sizes, key)
+	}
+}
+
+// overflow 是否超出容量
+func (lib *cacheLib) overflow() bool {
+	return (lib.opts.MaxEntries > 0 && lib.policy.Len() > lib.opts.MaxEntries) ||
+		(lib.opts.MaxBytes > 0 && lib.bytes > lib.opts.MaxBytes)
+}
+
+// onExpired 过期key被清理后移除其记录, 清理期间被重新写入的key不处理
+func (lib *cacheLib) onExpired(key string) {
+	if nil == lib.policy {
+		return
+	}
+	lib.l.Lock()
+	defer lib.l.Unlock()
+	if !lib.tm.tokenMap.ContainsKey(key) {
+		lib.removed(key)
+	}
+}
+
+// estimateSize 估算key和值占用的字节数
+func estimateSize(key string, val any) int64 {
+	return entryOverhead + int64(len(key)) + sizeOf(reflect.ValueOf(val), 0)
+}
+
+// sizeOf 估算值占用的字节数, 超过一定深度的嵌套不再计算
+func sizeOf(v reflect.Value, depth int) int64 {
+	if !v.IsValid() || depth > 8 {
+		return 0
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return int64(16 + v.Len())
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return 8
+		}
+		return 8 + sizeOf(v.Elem(), depth+1)
+	case reflect.Slice, reflect.Array:
+		res := int64(24)
+		if elem := v.Type().Elem(); elem.Kind() != reflect.Ptr && elem.Kind() != reflect.Interface &&
+			elem.Kind() != reflect.String && elem.Kind() != reflect.Slice && elem.Kind() != reflect.Map && elem.Kind() != reflect.Struct {
+			return res + int64(v.Len())*int64(elem.Size())
+		}
+		for i := 0; i < v.Len(); i++ {
+			res += sizeOf(v.Index(i), depth+1)
+		}
+		return res
+	case reflect.Map:
+		res := int64(48)
+		iter := v.MapRange()
+		for iter.Next() {
+			res += sizeOf(iter.Key(), depth+1) + sizeOf(iter.Value(), depth+1)
+		}
+		return res
+	case reflect.Struct:
+		var res int64
+		for i := 0; i < v.NumField(); i++ {
+			res += sizeOf(v.Field(i), depth+1)
+		}
+		return res
+	}
+	return int64(v.Type().Size())
+}
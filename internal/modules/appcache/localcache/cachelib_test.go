@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+package localcache
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/wup364/pakku/ipakku"
+)
+
+func newTestCacheManager(t *testing.T) *CacheManager {
+	cm := &CacheManager{}
+	cm.Init(nil, "")
+	t.Cleanup(cm.Destroy)
+	return cm
+}
+
+func TestCacheLibLRU(t *testing.T) {
+	cm := newTestCacheManager(t)
+	var evicted []string
+	err := cm.RegLibWithOptions("lru", ipakku.CacheLibOptions{Expire: -1, MaxEntries: 3, OnEvict: func(key string, val any) {
+		evicted = append(evicted, key+"="+strconv.Itoa(val.(int)))
+	}})
+	if nil != err {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		cm.Set("lru", "k"+strconv.Itoa(i), i)
+	}
+	// 访问k1后, k2为最久未访问
+	var val int
+	if err = cm.Get("lru", "k1", &val); nil != err || val != 1 {
+		t.Fatalf("val = %d, err = %v", val, err)
+	}
+	cm.Set("lru", "k4", 4)
+	if ok, _ := cm.SetNX("lru", "k5", 5); !ok {
+		t.Fatal("SetNX failed")
+	}
+	if strings.Join(evicted, ",") != "k2=2,k3=3" {
+		t.Fatalf("evicted = %v", evicted)
+	}
+	keys := cm.Keys("lru")
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "k1,k4,k5" {
+		t.Fatalf("keys = %v", keys)
+	}
+
+	cm.Get("lru", "k2", &val)
+	stats, err := cm.Stats("lru")
+	if nil != err || stats.Entries != 3 || stats.Evictions != 2 || stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("stats = %+v, err = %v", stats, err)
+	}
+
+	cm.Del("lru", "k1")
+	cm.Clear("lru")
+	if stats, _ = cm.Stats("lru"); stats.Entries != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestCacheLibLFU(t *testing.T) {
+	cm := newTestCacheManager(t)
+	if err := cm.RegLibWithOptions("lfu", ipakku.CacheLibOptions{Expire: -1, MaxEntries: 2, Policy: ipakku.CACHE_EVICT_LFU}); nil != err {
+		t.Fatal(err)
+	}
+	cm.Set("lfu", "a", 1)
+	cm.Set("lfu", "b", 2)
+	for i := 0; i < 3; i++ {
+		cm.Get("lfu", "b", nil)
+	}
+	cm.Get("lfu", "a", nil)
+
+	// 新写入的key不会被立即淘汰, a访问次数最少
+	cm.Set("lfu", "c", 3)
+	if ok, _ := cm.Exists("lfu", "a"); ok {
+		t.Fatal("a should be evicted")
+	}
+	cm.Set("lfu", "d", 4)
+	if ok, _ := cm.Exists("lfu", "b"); !ok {
+		t.Fatal("b should not be evicted")
+	}
+	if ok, _ := cm.Exists("lfu", "c"); ok {
+		t.Fatal("c should be evicted")
+	}
+}
+
+func TestCacheLibMaxBytes(t *testing.T) {
+	cm := newTestCacheManager(t)
+	if err := cm.RegLibWithOptions("bytes", ipakku.CacheLibOptions{Expire: -1, MaxBytes: 4096}); nil != err {
+		t.Fatal(err)
+	}
+	value := strings.Repeat("x", 1000)
+	for i := 0; i < 10; i++ {
+		cm.Set("bytes", "k"+strconv.Itoa(i), value)
+	}
+	stats, _ := cm.Stats("bytes")
+	if stats.Bytes > 4096 || stats.Entries != 3 || stats.Evictions != 7 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	// 覆盖时按新值重新计算
+	cm.Set("bytes", "k9", "small")
+	if now, _ := cm.Stats("bytes"); now.Bytes >= stats.Bytes || now.Entries != 3 {
+		t.Fatalf("stats = %+v", now)
+	}
+
+	// 单个值超出限制时保留该值
+	cm.Set("bytes", "big", strings.Repeat("x", 8192))
+	if stats, _ = cm.Stats("bytes"); stats.Entries != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestCacheLibUnbounded(t *testing.T) {
+	cm := newTestCacheManager(t)
+	if err := cm.RegLib("plain", -1); nil != err {
+		t.Fatal(err)
+	}
+	if err := cm.RegLibWithOptions("plain", ipakku.CacheLibOptions{}); err != ipakku.ErrCacheLibIsExist {
+		t.Fatalf("err = %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		cm.Incrby("plain", "n", int64(1))
+		cm.Set("plain", "k"+strconv.Itoa(i), i)
+	}
+	var sv StructValue
+	if err := cm.Get("plain", "n", &sv); nil != err || sv.Value.(int64) != 100 {
+		t.Fatalf("n = %v, err = %v", sv.Value, err)
+	}
+	stats, err := cm.Stats("plain")
+	if nil != err || stats.Entries != 101 || stats.Evictions != 0 || stats.Bytes != 0 {
+		t.Fatalf("stats = %+v, err = %v", stats, err)
+	}
+	if _, err = cm.Stats("none"); err != ipakku.ErrCacheLibNotExist {
+		t.Fatalf("err = %v", err)
+	}
+}
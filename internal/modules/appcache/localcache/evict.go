@@ -0,0 +1,212 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 缓存淘汰策略
+
+package localcache
+
+import (
+	"container/heap"
+	"container/list"
+
+	"github.com/wup364/pakku/ipakku"
+)
+
+// evictPolicy 淘汰策略, 记录key的访问情况, 非并发安全
+type evictPolicy interface {
+
+	// Add 记录新增或覆盖的key
+	Add(key string)
+
+	// Touch 记录key被访问
+	Touch(key string)
+
+	// Remove 移除key
+	Remove(key string)
+
+	// Victim 选出应被淘汰的key, 不会选中 exclude
+	Victim(exclude string) (string, bool)
+
+	// Len key数量
+	Len() int
+
+	// Clear 清空
+	Clear()
+}
+
+// newEvictPolicy 根据策略名创建淘汰策略, 默认LRU
+func newEvictPolicy(policy ipakku.CacheEvictPolicy) evictPolicy {
+	if policy == ipakku.CACHE_EVICT_LFU {
+		return newLFUPolicy()
+	}
+	return newLRUPolicy()
+}
+
+// newLRUPolicy 最久未访问淘汰
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{ll: list.New(), items: make(map[string]*list.Element)}
+}
+
+// lruPolicy 最久未访问淘汰, 链表头部为最近访问
+type lruPolicy struct {
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+// Add 记录新增或覆盖的key
+func (p *lruPolicy) Add(key string) {
+	if e, ok := p.items[key]; ok {
+		p.ll.MoveToFront(e)
+		return
+	}
+	p.items[key] = p.ll.PushFront(key)
+}
+
+// Touch 记录key被访问
+func (p *lruPolicy) Touch(key string) {
+	if e, ok := p.items[key]; ok {
+		p.ll.MoveToFront(e)
+	}
+}
+
+// Remove 移除key
+func (p *lruPolicy) Remove(key string) {
+	if e, ok := p.items[key]; ok {
+		p.ll.Remove(e)
+		delete(p.items, key)
+	}
+}
+
+// Victim 选出最久未访问的key
+func (p *lruPolicy) Victim(exclude string) (string, bool) {
+	for e := p.ll.Back(); nil != e; e = e.Prev() {
+		if key := e.Value.(string); key != exclude {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// Len key数量
+func (p *lruPolicy) Len() int {
+	return len(p.items)
+}
+
+// Clear 清空
+func (p *lruPolicy) Clear() {
+	p.ll.Init()
+	p.items = make(map[string]*list.Element)
+}
+
+// newLFUPolicy 最少访问淘汰
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{items: make(map[string]*lfuItem)}
+}
+
+// lfuPolicy 最少访问淘汰, 使用按(访问次数, 最后访问序号)排序的最小堆
+type lfuPolicy struct {
+	seq   uint64
+	heap  lfuHeap
+	items map[string]*lfuItem
+}
+
+// lfuItem 堆中的key
+type lfuItem struct {
+	key   string
+	freq  uint64
+	seq   uint64
+	index int
+}
+
+// Add 记录新增或覆盖的key, 覆盖视为一次访问
+func (p *lfuPolicy) Add(key string) {
+	if _, ok := p.items[key]; ok {
+		p.Touch(key)
+		return
+	}
+	p.seq++
+	item := &lfuItem{key: key, freq: 1, seq: p.seq}
+	p.items[key] = item
+	heap.Push(&p.heap, item)
+}
+
+// Touch 记录key被访问
+func (p *lfuPolicy) Touch(key string) {
+	if item, ok := p.items[key]; ok {
+		p.seq++
+		item.freq++
+		item.seq = p.seq
+		heap.Fix(&p.heap, item.index)
+	}
+}
+
+// Remove 移除key
+func (p *lfuPolicy) Remove(key string) {
+	if item, ok := p.items[key]; ok {
+		heap.Remove(&p.heap, item.index)
+		delete(p.items, key)
+	}
+}
+
+// Victim 选出访问次数最少的key, 堆顶为 exclude 时从其子节点中选
+func (p *lfuPolicy) Victim(exclude string) (string, bool) {
+	if len(p.heap) == 0 {
+		return "", false
+	}
+	if p.heap[0].key != exclude {
+		return p.heap[0].key, true
+	}
+	var res *lfuItem
+	for _, i := range []int{1, 2} {
+		if i < len(p.heap) && (nil == res || p.heap.Less(i, res.index)) {
+			res = p.heap[i]
+		}
+	}
+	if nil == res {
+		return "", false
+	}
+	return res.key, true
+}
+
+// Len key数量
+func (p *lfuPolicy) Len() int {
+	return len(p.items)
+}
+
+// Clear 清空
+func (p *lfuPolicy) Clear() {
+	p.heap = nil
+	p.items = make(map[string]*lfuItem)
+}
+
+// lfuHeap 实现 heap.Interface
+type lfuHeap []*lfuItem
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq != h[j].freq {
+		return h[i].freq < h[j].freq
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x any) {
+	item := x.(*lfuItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *lfuHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
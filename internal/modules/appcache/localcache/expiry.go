@@ -0,0 +1,202 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 过期调度器
+// 使用按过期时间排序的最小堆, 由一个线程负责多个 TokenManager 的过期清理,
+// 只在最近的过期时间到达时唤醒, 每次只处理已过期的key. 没有待过期的key时线程退出, 再次添加时重新启动
+
+package localcache
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// defaultScheduler 未指定调度器的 TokenManager 共用的调度器
+var defaultScheduler = newExpiryScheduler()
+
+// newExpiryScheduler 新建过期调度器
+func newExpiryScheduler() *expiryScheduler {
+	return &expiryScheduler{
+		l:     new(sync.Mutex),
+		items: make(map[*TokenManager]map[string]*expiryItem),
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+// expiryScheduler 过期调度器
+type expiryScheduler struct {
+	l     *sync.Mutex
+	heap  expiryHeap
+	items map[*TokenManager]map[string]*expiryItem
+	wake  chan struct{}
+	done  chan struct{} // 清理线程运行中时不为nil, 退出时关闭
+}
+
+// expiryItem 待过期的key
+type expiryItem struct {
+	tm    *TokenManager
+	token string
+	at    int64 // 过期时间, UnixNano
+	index int
+}
+
+// schedule 设置key的过期时间, 已存在时更新
+func (s *expiryScheduler) schedule(tm *TokenManager, token string, at int64) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	tokens, ok := s.items[tm]
+	if !ok {
+		tokens = make(map[string]*expiryItem)
+		s.items[tm] = tokens
+	}
+	if item, ok := tokens[token]; ok {
+		item.at = at
+		heap.Fix(&s.heap, item.index)
+	} else {
+		item = &expiryItem{tm: tm, token: token, at: at}
+		tokens[token] = item
+		heap.Push(&s.heap, item)
+	}
+
+	if nil == s.done {
+		s.done = make(chan struct{})
+		go s.run(s.done)
+	} else if s.heap[0].tm == tm && s.heap[0].token == token {
+		// 最近的过期时间发生变化
+		s.notify()
+	}
+}
+
+// unschedule 取消key的过期
+func (s *expiryScheduler) unschedule(tm *TokenManager, token string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if item, ok := s.items[tm][token]; ok {
+		heap.Remove(&s.heap, item.index)
+		s.forget(item)
+	}
+}
+
+// unscheduleAll 取消 TokenManager 所有key的过期
+func (s *expiryScheduler) unscheduleAll(tm *TokenManager) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	for _, item := range s.items[tm] {
+		heap.Remove(&s.heap, item.index)
+	}
+	delete(s.items, tm)
+	s.notify()
+}
+
+// Stop 取消所有key的过期并等待清理线程退出, 之后仍可继续使用
+func (s *expiryScheduler) Stop() {
+	s.l.Lock()
+	s.heap = nil
+	s.items = make(map[*TokenManager]map[string]*expiryItem)
+	done := s.done
+	s.notify()
+	s.l.Unlock()
+	if nil != done {
+		<-done
+	}
+}
+
+// Len 待过期的key数量
+func (s *expiryScheduler) Len() int {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return len(s.heap)
+}
+
+// run 清理线程, 没有待过期的key时退出
+func (s *expiryScheduler) run(done chan struct{}) {
+	defer close(done)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		s.l.Lock()
+		now := time.Now().UnixNano()
+		var expired []*expiryItem
+		for len(s.heap) > 0 && s.heap[0].at <= now {
+			item := heap.Pop(&s.heap).(*expiryItem)
+			s.forget(item)
+			expired = append(expired, item)
+		}
+		if len(expired) == 0 && len(s.heap) == 0 {
+			s.done = nil
+			s.l.Unlock()
+			return
+		}
+		var wait time.Duration
+		if len(s.heap) > 0 {
+			wait = time.Duration(s.heap[0].at - now)
+		}
+		s.l.Unlock()
+
+		if len(expired) > 0 {
+			for _, item := range expired {
+				item.tm.expire(item.token, item.at)
+			}
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// forget 删除key的记录, 需持有锁
+func (s *expiryScheduler) forget(item *expiryItem) {
+	if tokens, ok := s.items[item.tm]; ok {
+		delete(tokens, item.token)
+		if len(tokens) == 0 {
+			delete(s.items, item.tm)
+		}
+	}
+}
+
+// notify 唤醒清理线程, 需持有锁
+func (s *expiryScheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// expiryHeap 实现 heap.Interface
+type expiryHeap []*expiryItem
+
+func (h expiryHeap) Len() int { return len(h) }
+
+func (h expiryHeap) Less(i, j int) bool { return h[i].at < h[j].at }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	item := x.(*expiryItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return item
+}
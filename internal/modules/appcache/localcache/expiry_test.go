@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+package localcache
+
+import (
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wup364/pakku/ipakku"
+)
+
+// running 清理线程是否在运行
+func (s *expiryScheduler) running() bool {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return nil != s.done
+}
+
+// waitFor 等待条件成立
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestExpirySchedulerOrder(t *testing.T) {
+	s := newExpiryScheduler()
+	a := (&TokenManager{}).setScheduler(s).Init()
+	b := (&TokenManager{}).setScheduler(s).Init()
+	var expired []string
+	a.SetExpiredListener(func(token string) { expired = append(expired, "a"+token) })
+	b.SetExpiredListener(func(token string) { expired = append(expired, "b"+token) })
+
+	now := time.Now().UnixNano()
+	for i, at := range []int64{300, 100, 200} {
+		token := strconv.Itoa(i)
+		at = now + at*int64(time.Millisecond)
+		a.tokenMap.Put(token, tokenObject{O: i, expired: at})
+		s.schedule(a, token, at)
+		b.tokenMap.Put(token, tokenObject{O: i, expired: at + int64(50*time.Millisecond)})
+		s.schedule(b, token, at+int64(50*time.Millisecond))
+	}
+	// 取消和更新过期时间
+	s.unschedule(b, "0")
+	a.tokenMap.Put("1", tokenObject{O: 1, expired: now + int64(400*time.Millisecond)})
+	s.schedule(a, "1", now+int64(400*time.Millisecond))
+	if s.Len() != 5 || !s.running() {
+		t.Fatalf("len = %d", s.Len())
+	}
+
+	waitFor(t, 2*time.Second, func() bool { return !s.running() })
+	if expect := "b1,a2,b2,a0,a1"; strings.Join(expired, ",") != expect {
+		t.Fatalf("expired = %v", expired)
+	}
+	if a.tokenMap.Size() != 0 || b.tokenMap.Size() != 1 {
+		t.Fatalf("a = %v, b = %v", a.tokenMap.Keys(), b.tokenMap.Keys())
+	}
+}
+
+func TestExpirySchedulerStop(t *testing.T) {
+	cm := &CacheManager{}
+	cm.Init(nil, "")
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		if err := cm.RegLib("lib"+strconv.Itoa(i), 100); nil != err {
+			t.Fatal(err)
+		}
+		cm.Set("lib"+strconv.Itoa(i), "key", i)
+	}
+	// 所有缓存库共用一个清理线程
+	if n := runtime.NumGoroutine(); n > before+1 {
+		t.Fatalf("goroutines: %d -> %d", before, n)
+	}
+	if cm.scheduler.Len() != 100 || !cm.scheduler.running() {
+		t.Fatalf("len = %d", cm.scheduler.Len())
+	}
+	cm.Destroy()
+	if cm.scheduler.Len() != 0 || cm.scheduler.running() {
+		t.Fatalf("len = %d", cm.scheduler.Len())
+	}
+
+	// 销毁后可重新注册
+	if err := cm.RegLib("lib0", 100); nil != err {
+		t.Fatal(err)
+	}
+	cm.Set("lib0", "key", 1)
+	if !cm.scheduler.running() {
+		t.Fatal("scheduler is not running")
+	}
+	cm.Destroy()
+}
+
+func TestCacheManagerExpire(t *testing.T) {
+	cm := newTestCacheManager(t)
+	if err := cm.RegLibWithOptions("lib", ipakku.CacheLibOptions{Expire: 1, MaxEntries: 10}); nil != err {
+		t.Fatal(err)
+	}
+	cm.Set("lib", "a", 1)
+	cm.Set("lib", "b", 2)
+	cm.Set("lib", "c", 3, -1)
+	// 覆盖为不过期
+	cm.Set("lib", "b", 2, -1)
+	if ok, _ := cm.SetNX("lib", "a", 1); ok {
+		t.Fatal("a exists")
+	}
+
+	waitFor(t, 3*time.Second, func() bool { return !cm.scheduler.running() })
+	keys := cm.Keys("lib")
+	stats, _ := cm.Stats("lib")
+	if strings.Join(sortStrings(keys), ",") != "b,c" || stats.Entries != 2 || stats.Evictions != 0 {
+		t.Fatalf("keys = %v, stats = %+v", keys, stats)
+	}
+	if ok, _ := cm.SetNX("lib", "a", 1); !ok {
+		t.Fatal("a is expired")
+	}
+}
+
+func sortStrings(arr []string) []string {
+	sort.Strings(arr)
+	return arr
+}
@@ -7,7 +7,6 @@
 package localcache
 
 import (
-	"runtime"
 	"time"
 
 	"github.com/wup364/pakku/pkg/strutil"
@@ -17,8 +16,9 @@ import (
 // TokenManager 令牌管理器, 可实现临时对象的存储
 // 使用前需要调用 init 方法
 type TokenManager struct {
-	destroyed bool // 是否销毁对象
 	tokenMap  *utypes.SafeMap[string, tokenObject]
+	scheduler *expiryScheduler
+	onExpired func(token string)
 }
 
 // tokenObject 用于保存token内容的对象
@@ -28,16 +28,27 @@ type tokenObject struct {
 	O       any   // token内容
 }
 
-// Init 初始化-启动一个管理线程, 负责令牌的生命周期
+// Init 初始化, 令牌的过期清理由过期调度器负责, 未指定时使用共用的调度器
 func (tm *TokenManager) Init() *TokenManager {
 	if nil != tm.tokenMap {
 		return tm
 	}
-	tm.destroyed = false
+	if nil == tm.scheduler {
+		tm.scheduler = defaultScheduler
+	}
 	tm.tokenMap = utypes.NewSafeMap[string, tokenObject]()
+	return tm
+}
 
-	// 定期清理
-	go tm.clearRunnable()
+// setScheduler 指定过期调度器, 需在 Init 之前设置
+func (tm *TokenManager) setScheduler(scheduler *expiryScheduler) *TokenManager {
+	tm.scheduler = scheduler
+	return tm
+}
+
+// SetExpiredListener 设置过期令牌被清理线程删除后的回调, 需在 Init 之前设置
+func (tm *TokenManager) SetExpiredListener(fn func(token string)) *TokenManager {
+	tm.onExpired = fn
 	return tm
 }
 
@@ -62,6 +73,7 @@ func (tm *TokenManager) PutTokenBody(token string, tb any, second int64) {
 		tkb.expired = -1
 	}
 	tm.tokenMap.Put(token, tkb)
+	tm.scheduleToken(token, tkb.expired)
 }
 
 // PutTokenBodyNX 参数同PutTokenBody函数, 区别在于当token存在时操作不成功, 返回false
@@ -75,7 +87,15 @@ func (tm *TokenManager) PutTokenBodyNX(token string, tb any, second int64) bool
 	} else {
 		tkb.expired = -1
 	}
-	return tm.tokenMap.PutX(token, tkb) == nil
+	// 已过期但尚未清理的令牌视为不存在
+	tm.tokenMap.DeleteIf(token, func(val tokenObject) bool {
+		return val.expired != -1 && val.expired <= tkb.regtime
+	})
+	if nil != tm.tokenMap.PutX(token, tkb) {
+		return false
+	}
+	tm.scheduleToken(token, tkb.expired)
+	return true
 }
 
 // GetTokenBody 获取令牌信息
@@ -101,6 +121,7 @@ func (tm *TokenManager) RefreshToken(tk string) {
 		val.regtime = time.Now().UnixNano()
 		val.expired = val.regtime + used
 		tm.tokenMap.Put(tk, val)
+		tm.scheduleToken(tk, val.expired)
 	}
 }
 
@@ -127,53 +148,44 @@ func (tm *TokenManager) GetExpiredNano(tk string) int64 {
 	}
 }
 
-// Clear 销毁整个对象, 销毁后不能在使用此对象, 需要重新初始化
+// Clear 清空所有令牌
 func (tm *TokenManager) Clear() {
 	tm.tokenMap.Clear()
+	tm.scheduler.unscheduleAll(tm)
 }
 
 // DestroyToken 销毁令牌
 func (tm *TokenManager) DestroyToken(tk string) {
 	tm.tokenMap.Delete(tk)
+	tm.scheduler.unschedule(tm, tk)
 }
 
-// Destroy 销毁整个对象, 销毁后不能在使用此对象, 需要重新初始化
+// Destroy 销毁整个对象, 清空令牌并取消其过期调度, 销毁后不能在使用此对象
 func (tm *TokenManager) Destroy() {
-	tm.destroyed = true
+	if nil == tm.tokenMap {
+		return
+	}
+	tm.Clear()
 }
 
-// clearRunnable 清理线程
-func (tm *TokenManager) clearRunnable() {
-	defer func() {
-		if nil != tm.tokenMap {
-			tm.tokenMap.Clear()
-			tm.tokenMap = nil
-		}
-	}()
-
-	for {
-		if nil == tm.tokenMap || tm.destroyed {
-			break
-		}
-
-		time.Sleep(time.Duration(1) * time.Second)
-		if tm.tokenMap.Size() == 0 {
-			continue
-		}
+// scheduleToken 调度令牌过期, expired=-1时取消调度
+func (tm *TokenManager) scheduleToken(token string, expired int64) {
+	if expired > -1 {
+		tm.scheduler.schedule(tm, token, expired)
+	} else {
+		tm.scheduler.unschedule(tm, token)
+	}
+}
 
-		keys := make([]string, 0)
-		tm.tokenMap.DoRange(func(key string, val tokenObject) error {
-			if val.expired > -1 {
-				if now := time.Now().UnixNano(); val.expired <= now {
-					keys = append(keys, key)
-				}
-			}
-			return nil
-		})
-
-		runtime.Gosched()
-		for i := 0; i < len(keys); i++ {
-			tm.tokenMap.Delete(keys[i])
+// expire 由过期调度器调用, 删除过期时间仍为 at 的令牌. 过期时间已被并发修改时重新调度
+func (tm *TokenManager) expire(token string, at int64) {
+	if _, ok := tm.tokenMap.DeleteIf(token, func(val tokenObject) bool { return val.expired == at }); ok {
+		if nil != tm.onExpired {
+			tm.onExpired(token)
 		}
+		return
+	}
+	if val, ok := tm.tokenMap.Get(token); ok && val.expired > -1 {
+		tm.scheduler.schedule(tm, token, val.expired)
 	}
 }
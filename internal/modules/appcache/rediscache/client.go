@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// redis客户端, 带连接池
+
+package rediscache
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrClientClosed 客户端已关闭
+var ErrClientClosed = errors.New("redis client is closed")
+
+// Options redis连接选项, 从配置 cache.redis 中读取
+type Options struct {
+	Addr     string        `@value:"addr:127.0.0.1:6379"`
+	Password string        `@value:"password"`
+	DB       int           `@value:"db:0" @valid:"min=0"`
+	PoolSize int           `@value:"poolSize:10" @valid:"min=1"`
+	Timeout  time.Duration `@value:"timeout:5s" @valid:"min=1ms"`
+	Prefix   string        `@value:"prefix"` // key前缀, 默认为应用名
+}
+
+// NewClient 新建客户端, 连接在使用时建立
+func NewClient(opts Options) *Client {
+	if opts.PoolSize < 1 {
+		opts.PoolSize = 1
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	return &Client{opts: opts, idle: make(chan *conn, opts.PoolSize), l: new(sync.Mutex)}
+}
+
+// Client redis客户端, 并发安全
+type Client struct {
+	opts   Options
+	idle   chan *conn
+	closed bool
+	l      *sync.Mutex
+}
+
+// conn redis连接
+type conn struct {
+	c net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+// Do 执行命令, redis返回错误应答时返回 RedisError. 应答类型: string, int64, []any, nil
+func (cli *Client) Do(args ...string) (any, error) {
+	cn, err := cli.get()
+	if nil != err {
+		return nil, err
+	}
+	reply, err := cn.do(args, cli.opts.Timeout)
+	if nil != err {
+		// 网络错误时连接不可再用
+		cn.c.Close()
+		return nil, err
+	}
+	cli.put(cn)
+	if rerr, ok := reply.(RedisError); ok {
+		return nil, rerr
+	}
+	return reply, nil
+}
+
+// Close 关闭所有空闲连接, 使用中的连接归还时关闭
+func (cli *Client) Close() error {
+	cli.l.Lock()
+	defer cli.l.Unlock()
+	if cli.closed {
+		return nil
+	}
+	cli.closed = true
+	for {
+		select {
+		case cn := <-cli.idle:
+			cn.c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// get 获取空闲连接, 没有时新建
+func (cli *Client) get() (*conn, error) {
+	cli.l.Lock()
+	closed := cli.closed
+	cli.l.Unlock()
+	if closed {
+		return nil, ErrClientClosed
+	}
+	select {
+	case cn := <-cli.idle:
+		return cn, nil
+	default:
+		return cli.dial()
+	}
+}
+
+// put 归还连接, 连接池已满或已关闭时关闭连接
+func (cli *Client) put(cn *conn) {
+	cli.l.Lock()
+	defer cli.l.Unlock()
+	if !cli.closed {
+		select {
+		case cli.idle <- cn:
+			return
+		default:
+		}
+	}
+	cn.c.Close()
+}
+
+// dial 新建连接, 并完成认证和选择数据库
+func (cli *Client) dial() (*conn, error) {
+	c, err := net.DialTimeout("tcp", cli.opts.Addr, cli.opts.Timeout)
+	if nil != err {
+		return nil, err
+	}
+	cn := &conn{c: c, r: bufio.NewReader(c), w: bufio.NewWriter(c)}
+	var setup [][]string
+	if len(cli.opts.Password) > 0 {
+		setup = append(setup, []string{"AUTH", cli.opts.Password})
+	}
+	if cli.opts.DB > 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(cli.opts.DB)})
+	}
+	for _, args := range setup {
+		reply, err := cn.do(args, cli.opts.Timeout)
+		if rerr, ok := reply.(RedisError); ok {
+			err = rerr
+		}
+		if nil != err {
+			c.Close()
+			return nil, err
+		}
+	}
+	return cn, nil
+}
+
+// do 发送命令并读取应答
+func (cn *conn) do(args []string, timeout time.Duration) (any, error) {
+	if err := cn.c.SetDeadline(time.Now().Add(timeout)); nil != err {
+		return nil, err
+	}
+	if err := writeCommand(cn.w, args); nil != err {
+		return nil, err
+	}
+	return readReply(cn.r)
+}
@@ -0,0 +1,429 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 进程内的RESP服务, 用于在没有redis的环境下测试
+// 支持命令: PING AUTH SELECT GET SET(EX/PX/NX/XX) DEL EXISTS INCRBY EXPIRE TTL SCAN KEYS FLUSHDB DBSIZE QUIT
+
+package rediscache
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewMemoryServer 在 addr 上启动服务, addr 为空时使用 127.0.0.1 上的随机端口, password 不为空时需要 AUTH
+func NewMemoryServer(addr, password string) (*MemoryServer, error) {
+	if len(addr) == 0 {
+		addr = "127.0.0.1:0"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if nil != err {
+		return nil, err
+	}
+	srv := &MemoryServer{
+		ln:       ln,
+		password: password,
+		data:     make(map[string]*memoryValue),
+		conns:    make(map[net.Conn]bool),
+		cursors:  make(map[uint64]string),
+		l:        new(sync.Mutex),
+		wg:       new(sync.WaitGroup),
+	}
+	srv.wg.Add(1)
+	go srv.serve()
+	return srv, nil
+}
+
+// MemoryServer 进程内的RESP服务, 数据保存在内存中, 不区分数据库
+type MemoryServer struct {
+	ln        net.Listener
+	password  string
+	data      map[string]*memoryValue
+	conns     map[net.Conn]bool
+	cursors   map[uint64]string // SCAN 游标对应的最后一个key
+	cursorSeq uint64
+	commands  uint64
+	l         *sync.Mutex
+	wg        *sync.WaitGroup
+}
+
+// memoryValue 值和过期时间
+type memoryValue struct {
+	val     string
+	expired time.Time
+}
+
+// Addr 监听地址
+func (srv *MemoryServer) Addr() string {
+	return srv.ln.Addr().String()
+}
+
+// Commands 已执行的命令数量
+func (srv *MemoryServer) Commands() uint64 {
+	srv.l.Lock()
+	defer srv.l.Unlock()
+	return srv.commands
+}
+
+// Close 停止服务并断开所有连接
+func (srv *MemoryServer) Close() error {
+	err := srv.ln.Close()
+	srv.l.Lock()
+	for c := range srv.conns {
+		c.Close()
+	}
+	srv.l.Unlock()
+	srv.wg.Wait()
+	return err
+}
+
+// serve 接受连接
+func (srv *MemoryServer) serve() {
+	defer srv.wg.Done()
+	for {
+		c, err := srv.ln.Accept()
+		if nil != err {
+			return
+		}
+		srv.l.Lock()
+		srv.conns[c] = true
+		srv.l.Unlock()
+		srv.wg.Add(1)
+		go srv.handle(c)
+	}
+}
+
+// handle 处理一个连接上的命令
+func (srv *MemoryServer) handle(c net.Conn) {
+	defer srv.wg.Done()
+	defer func() {
+		c.Close()
+		srv.l.Lock()
+		delete(srv.conns, c)
+		srv.l.Unlock()
+	}()
+	r, w := bufio.NewReader(c), bufio.NewWriter(c)
+	authed := len(srv.password) == 0
+	for {
+		req, err := readReply(r)
+		if nil != err {
+			if err != io.EOF {
+				writeReply(w, RedisError("ERR "+err.Error()))
+				w.Flush()
+			}
+			return
+		}
+		items, ok := req.([]any)
+		if !ok || len(items) == 0 {
+			writeReply(w, RedisError("ERR invalid request"))
+			w.Flush()
+			continue
+		}
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i], _ = item.(string)
+		}
+
+		var reply any
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "QUIT":
+			writeReply(w, simpleString("OK"))
+			w.Flush()
+			return
+		case cmd == "AUTH":
+			if len(args) == 2 && args[1] == srv.password {
+				authed, reply = true, simpleString("OK")
+			} else {
+				reply = RedisError("WRONGPASS invalid password")
+			}
+		case !authed:
+			reply = RedisError("NOAUTH Authentication required.")
+		default:
+			reply = srv.exec(cmd, args[1:])
+		}
+		writeReply(w, reply)
+		if err = w.Flush(); nil != err {
+			return
+		}
+	}
+}
+
+// exec 执行命令
+func (srv *MemoryServer) exec(cmd string, args []string) any {
+	srv.l.Lock()
+	defer srv.l.Unlock()
+	srv.commands++
+	now := time.Now()
+	switch cmd {
+	case "PING":
+		return simpleString("PONG")
+	case "SELECT", "FLUSHDB":
+		if cmd == "FLUSHDB" {
+			srv.data = make(map[string]*memoryValue)
+		}
+		return simpleString("OK")
+	case "DBSIZE":
+		return int64(len(srv.liveKeys(now)))
+	case "GET":
+		if len(args) != 1 {
+			return errArgs(cmd)
+		}
+		if v := srv.get(args[0], now); nil != v {
+			return v.val
+		}
+		return nil
+	case "SET":
+		return srv.set(args, now)
+	case "DEL", "EXISTS":
+		var n int64
+		for _, key := range args {
+			if nil != srv.get(key, now) {
+				n++
+				if cmd == "DEL" {
+					delete(srv.data, key)
+				}
+			}
+		}
+		return n
+	case "INCRBY":
+		if len(args) != 2 {
+			return errArgs(cmd)
+		}
+		incr, err := strconv.ParseInt(args[1], 10, 64)
+		if nil != err {
+			return RedisError("ERR value is not an integer or out of range")
+		}
+		v := srv.get(args[0], now)
+		if nil == v {
+			v = &memoryValue{val: "0"}
+			srv.data[args[0]] = v
+		}
+		n, err := strconv.ParseInt(v.val, 10, 64)
+		if nil != err {
+			return RedisError("ERR value is not an integer or out of range")
+		}
+		v.val = strconv.FormatInt(n+incr, 10)
+		return n + incr
+	case "EXPIRE", "TTL", "PTTL":
+		if (cmd == "EXPIRE" && len(args) != 2) || (cmd != "EXPIRE" && len(args) != 1) {
+			return errArgs(cmd)
+		}
+		v := srv.get(args[0], now)
+		if cmd != "EXPIRE" {
+			if nil == v {
+				return int64(-2)
+			} else if v.expired.IsZero() {
+				return int64(-1)
+			} else if cmd == "PTTL" {
+				return int64(v.expired.Sub(now) / time.Millisecond)
+			}
+			return int64((v.expired.Sub(now) + time.Second - 1) / time.Second)
+		}
+		second, err := strconv.ParseInt(args[1], 10, 64)
+		if nil != err {
+			return RedisError("ERR value is not an integer or out of range")
+		}
+		if nil == v {
+			return int64(0)
+		}
+		v.expired = now.Add(time.Duration(second) * time.Second)
+		return int64(1)
+	case "KEYS":
+		if len(args) != 1 {
+			return errArgs(cmd)
+		}
+		res := make([]any, 0)
+		for _, key := range srv.liveKeys(now) {
+			if matchGlob(args[0], key) {
+				res = append(res, key)
+			}
+		}
+		return res
+	case "SCAN":
+		return srv.scan(args, now)
+	}
+	return RedisError("ERR unknown command '" + cmd + "'")
+}
+
+// set SET key value [EX seconds|PX milliseconds] [NX|XX]
+func (srv *MemoryServer) set(args []string, now time.Time) any {
+	if len(args) < 2 {
+		return errArgs("SET")
+	}
+	v := &memoryValue{val: args[1]}
+	var nx, xx bool
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return RedisError("ERR syntax error")
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if nil != err || n <= 0 {
+				return RedisError("ERR invalid expire time in 'set' command")
+			}
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			v.expired = now.Add(time.Duration(n) * unit)
+			i++
+		default:
+			return RedisError("ERR syntax error")
+		}
+	}
+	exists := nil != srv.get(args[0], now)
+	if (nx && exists) || (xx && !exists) {
+		return nil
+	}
+	srv.data[args[0]] = v
+	return simpleString("OK")
+}
+
+// scan SCAN cursor [MATCH pattern] [COUNT count], cursor 对应上次返回的最后一个key, 遍历期间删除key不影响遍历
+func (srv *MemoryServer) scan(args []string, now time.Time) any {
+	if len(args) < 1 {
+		return errArgs("SCAN")
+	}
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	last, ok := srv.cursors[cursor]
+	if nil != err || (cursor > 0 && !ok) {
+		return RedisError("ERR invalid cursor")
+	}
+	delete(srv.cursors, cursor)
+	match, count := "*", 10
+	for i := 1; i+1 < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			match = args[i+1]
+		case "COUNT":
+			if count, err = strconv.Atoi(args[i+1]); nil != err || count < 1 {
+				return RedisError("ERR syntax error")
+			}
+		default:
+			return RedisError("ERR syntax error")
+		}
+	}
+	keys := srv.liveKeys(now)
+	start := sort.SearchStrings(keys, last)
+	if start < len(keys) && keys[start] == last && cursor > 0 {
+		start++
+	}
+	res := make([]any, 0)
+	end := start
+	for ; end < len(keys) && end < start+count; end++ {
+		if matchGlob(match, keys[end]) {
+			res = append(res, keys[end])
+		}
+	}
+	next := uint64(0)
+	if end < len(keys) {
+		srv.cursorSeq++
+		next = srv.cursorSeq
+		srv.cursors[next] = keys[end-1]
+	}
+	return []any{strconv.FormatUint(next, 10), res}
+}
+
+// get 获取未过期的值, 已过期的值被删除
+func (srv *MemoryServer) get(key string, now time.Time) *memoryValue {
+	v, ok := srv.data[key]
+	if !ok {
+		return nil
+	}
+	if !v.expired.IsZero() && !now.Before(v.expired) {
+		delete(srv.data, key)
+		return nil
+	}
+	return v
+}
+
+// liveKeys 未过期的key, 按key排序
+func (srv *MemoryServer) liveKeys(now time.Time) []string {
+	keys := make([]string, 0, len(srv.data))
+	for key := range srv.data {
+		if nil != srv.get(key, now) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// errArgs 参数数量错误
+func errArgs(cmd string) RedisError {
+	return RedisError("ERR wrong number of arguments for '" + strings.ToLower(cmd) + "' command")
+}
+
+// matchGlob redis风格的通配符匹配, 支持 * ? [abc] [^a] [a-z] 和 \ 转义
+func matchGlob(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchGlob(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			end := strings.IndexByte(pattern[1:], ']')
+			if end < 0 {
+				return false
+			}
+			set, not := pattern[1:end+1], false
+			if strings.HasPrefix(set, "^") {
+				set, not = set[1:], true
+			}
+			matched := false
+			for i := 0; i < len(set); i++ {
+				if i+2 < len(set) && set[i+1] == '-' {
+					if set[i] <= s[0] && s[0] <= set[i+2] {
+						matched = true
+					}
+					i += 2
+				} else if set[i] == s[0] {
+					matched = true
+				}
+			}
+			if matched == not {
+				return false
+			}
+			pattern = pattern[end+1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
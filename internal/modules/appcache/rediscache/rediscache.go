@@ -0,0 +1,345 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 缓存工具-redis实现
+// 缓存库映射为key前缀 {prefix}:{clib}:, 值以JSON格式保存, Keys和Clear使用SCAN遍历
+// 配置: cache.redis.addr/password/db/poolSize/timeout/prefix
+
+package rediscache
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/wup364/pakku/internal/modules/appcache/localcache"
+	"github.com/wup364/pakku/ipakku"
+	"github.com/wup364/pakku/pkg/logs"
+)
+
+func init() {
+	ipakku.PakkuConf.RegisterPakkuModuleImplement(new(RedisCache), "ICache", "redis")
+}
+
+// scanCount SCAN 每次遍历的数量
+const scanCount = "200"
+
+// RedisCache 基于redis的缓存实现, 使用前需要调用 Init 或 InitClient 方法
+type RedisCache struct {
+	client *Client
+	prefix string
+	libexp map[string]int64
+	locker *sync.RWMutex
+}
+
+// Init 初始化, 从配置 cache.redis 中读取连接选项, 一个对象只能初始化一次
+func (rc *RedisCache) Init(config ipakku.AppConfig, appName string) {
+	if nil != rc.client {
+		return
+	}
+	var opts Options
+	if err := config.ScanAndAutoValue(ipakku.CONFKEY_CACHE_REDIS, &opts); nil != err {
+		logs.Panic(err)
+	}
+	if len(opts.Prefix) == 0 {
+		opts.Prefix = appName
+	}
+	rc.InitClient(NewClient(opts), opts.Prefix)
+}
+
+// InitClient 使用指定的客户端初始化, key前缀为 {prefix}:{clib}:
+func (rc *RedisCache) InitClient(client *Client, prefix string) *RedisCache {
+	rc.client = client
+	rc.prefix = prefix
+	rc.libexp = make(map[string]int64)
+	rc.locker = new(sync.RWMutex)
+	return rc
+}
+
+// RegLib 注册缓存库
+// lib为库名, second:过期时间-1为不过期
+func (rc *RedisCache) RegLib(clib string, second int64) error {
+	return rc.RegLibWithOptions(clib, ipakku.CacheLibOptions{Expire: second})
+}
+
+// RegLibWithOptions 按选项注册缓存库, 容量由redis自身的 maxmemory 策略控制, 不支持 MaxEntries/MaxBytes/OnEvict
+func (rc *RedisCache) RegLibWithOptions(clib string, opts ipakku.CacheLibOptions) error {
+	if len(clib) == 0 {
+		return ipakku.ErrCacheLibNotExist
+	}
+	if opts.MaxEntries > 0 || opts.MaxBytes > 0 || nil != opts.OnEvict {
+		return ipakku.ErrCacheNotSupported
+	}
+	defer rc.locker.Unlock()
+	rc.locker.Lock()
+
+	if _, ok := rc.libexp[clib]; ok {
+		return ipakku.ErrCacheLibIsExist
+	}
+	rc.libexp[clib] = opts.Expire
+	return nil
+}
+
+// Exists 返回key是否存在
+func (rc *RedisCache) Exists(clib string, key string) (bool, error) {
+	if _, err := rc.getLibExp(clib); nil != err {
+		return false, err
+	}
+	reply, err := rc.client.Do("EXISTS", rc.libKey(clib, key))
+	if nil != err {
+		return false, err
+	}
+	n, _ := reply.(int64)
+	return n > 0, nil
+}
+
+// TTL 获取key的剩余过期时间, 单位秒(向下取整), -1为不过期
+func (rc *RedisCache) TTL(clib string, key string) (int64, error) {
+	if _, err := rc.getLibExp(clib); nil != err {
+		return -1, err
+	}
+	reply, err := rc.client.Do("PTTL", rc.libKey(clib, key))
+	if nil != err {
+		return -1, err
+	}
+	ms, _ := reply.(int64)
+	if ms == -2 {
+		return -1, ipakku.ErrNoCacheHit
+	} else if ms < 0 {
+		return -1, nil
+	}
+	return ms / 1000, nil
+}
+
+// Get 读取缓存信息, val 为 *localcache.StructValue 时按 Incrby 写入的整数读取
+func (rc *RedisCache) Get(clib string, key string, val any) error {
+	if _, err := rc.getLibExp(clib); nil != err {
+		return err
+	}
+	reply, err := rc.client.Do("GET", rc.libKey(clib, key))
+	if nil != err {
+		return err
+	}
+	data, ok := reply.(string)
+	if !ok {
+		return ipakku.ErrNoCacheHit
+	}
+	if nil == val {
+		return nil
+	}
+	if sv, ok := val.(*localcache.StructValue); ok {
+		if sv.Value, err = strconv.ParseInt(data, 10, 64); nil != err {
+			return ipakku.ErrCacheConvertError
+		}
+		return nil
+	}
+	if err = json.Unmarshal([]byte(data), val); nil != err {
+		return ipakku.ErrCacheConvertError
+	}
+	return nil
+}
+
+// Keys 获取库的所有key
+func (rc *RedisCache) Keys(clib string) []string {
+	res := make([]string, 0)
+	if _, err := rc.getLibExp(clib); nil != err {
+		return res
+	}
+	prefix := rc.libKey(clib, "")
+	if err := rc.scan(clib, func(keys []string) error {
+		for _, key := range keys {
+			res = append(res, strings.TrimPrefix(key, prefix))
+		}
+		return nil
+	}); nil != err {
+		logs.Errorf("scan redis keys failed: %s", err.Error())
+	}
+	return res
+}
+
+// Set 向lib库中设置键为key的值
+// args[0] 为缓存值 args[1]如果存在, 则覆盖默认过期时间, 单位秒
+func (rc *RedisCache) Set(clib string, key string, args ...any) error {
+	second, err := rc.getExpSecond(clib, args...)
+	if nil != err {
+		return err
+	}
+	data, err := json.Marshal(args[0])
+	if nil != err {
+		return ipakku.ErrCacheArgsTypeError
+	}
+	if second == 0 {
+		// 立即过期
+		_, err = rc.client.Do("DEL", rc.libKey(clib, key))
+		return err
+	}
+	_, err = rc.client.Do(setArgs(rc.libKey(clib, key), string(data), second)...)
+	return err
+}
+
+// SetNX 向lib库中设置键为key的值, 当key不存在时设置成功, 并返回true
+// args[0] 为缓存值 args[1]如果存在, 则覆盖默认过期时间, 单位秒
+func (rc *RedisCache) SetNX(clib string, key string, args ...any) (bool, error) {
+	second, err := rc.getExpSecond(clib, args...)
+	if nil != err {
+		return false, err
+	}
+	data, err := json.Marshal(args[0])
+	if nil != err {
+		return false, ipakku.ErrCacheArgsTypeError
+	}
+	if second == 0 {
+		return false, nil
+	}
+	reply, err := rc.client.Do(append(setArgs(rc.libKey(clib, key), string(data), second), "NX")...)
+	if nil != err {
+		return false, err
+	}
+	return nil != reply, nil
+}
+
+// Incrby 指定key以increment的值累加, 返回累加后的值
+// args[0] 为缓存值 args[1]如果存在, 则覆盖默认过期时间, 单位秒. 过期时间只在key不存在时设置
+func (rc *RedisCache) Incrby(clib string, key string, args ...any) (int64, error) {
+	second, err := rc.getExpSecond(clib, args...)
+	if nil != err {
+		return -1, err
+	}
+	val, ok := args[0].(int64)
+	if !ok {
+		return -1, ipakku.ErrCacheArgsTypeError
+	}
+	libKey := rc.libKey(clib, key)
+	if second > 0 {
+		// 先以0创建带过期时间的key, INCRBY 不会改变过期时间
+		if _, err = rc.client.Do(append(setArgs(libKey, "0", second), "NX")...); nil != err {
+			return -1, err
+		}
+	}
+	reply, err := rc.client.Do("INCRBY", libKey, strconv.FormatInt(val, 10))
+	if nil != err {
+		return -1, err
+	}
+	res, _ := reply.(int64)
+	return res, nil
+}
+
+// Del 删除缓存信息
+func (rc *RedisCache) Del(clib string, key string) error {
+	if _, err := rc.getLibExp(clib); nil != err {
+		return err
+	}
+	_, err := rc.client.Do("DEL", rc.libKey(clib, key))
+	return err
+}
+
+// Clear 清空库内容
+func (rc *RedisCache) Clear(clib string) {
+	if _, err := rc.getLibExp(clib); nil != err {
+		return
+	}
+	if err := rc.scan(clib, func(keys []string) error {
+		if len(keys) == 0 {
+			return nil
+		}
+		_, err := rc.client.Do(append([]string{"DEL"}, keys...)...)
+		return err
+	}); nil != err {
+		logs.Errorf("clear redis cache lib '%s' failed: %s", clib, err.Error())
+	}
+}
+
+// Destroy 关闭连接
+func (rc *RedisCache) Destroy() {
+	if nil != rc.client {
+		rc.client.Close()
+	}
+}
+
+// scan 使用 SCAN 遍历缓存库的key
+func (rc *RedisCache) scan(clib string, fn func(keys []string) error) error {
+	match := escapeGlob(rc.libKey(clib, "")) + "*"
+	cursor := "0"
+	for {
+		reply, err := rc.client.Do("SCAN", cursor, "MATCH", match, "COUNT", scanCount)
+		if nil != err {
+			return err
+		}
+		arr, ok := reply.([]any)
+		if !ok || len(arr) != 2 {
+			return ErrProtocol
+		}
+		cursor, _ = arr[0].(string)
+		items, _ := arr[1].([]any)
+		keys := make([]string, 0, len(items))
+		for _, item := range items {
+			if key, ok := item.(string); ok {
+				keys = append(keys, key)
+			}
+		}
+		if err = fn(keys); nil != err {
+			return err
+		}
+		if cursor == "0" || len(cursor) == 0 {
+			return nil
+		}
+	}
+}
+
+// libKey 缓存库中key对应的redis key
+func (rc *RedisCache) libKey(clib, key string) string {
+	return rc.prefix + ":" + clib + ":" + key
+}
+
+// getLibExp 获取缓存库的默认过期时间
+func (rc *RedisCache) getLibExp(clib string) (int64, error) {
+	defer rc.locker.RUnlock()
+	rc.locker.RLock()
+	if lx, ok := rc.libexp[clib]; ok {
+		return lx, nil
+	}
+	return -1, ipakku.ErrCacheLibNotExist
+}
+
+// getExpSecond 获取过期时间, 若args[1]有值, 则返回args[1]的值, 否则返回之前注册lib时的值
+func (rc *RedisCache) getExpSecond(clib string, args ...any) (int64, error) {
+	lx, err := rc.getLibExp(clib)
+	if nil != err {
+		return -1, err
+	}
+	if len(args) == 0 {
+		return -1, ipakku.ErrCacheArgsEmpty
+	}
+	if len(args) > 1 {
+		if val, ok := args[1].(int64); ok {
+			return val, nil
+		} else if val, ok := args[1].(int); ok {
+			return int64(val), nil
+		} else {
+			return -1, ipakku.ErrCacheArgsTypeError
+		}
+	}
+	return lx, nil
+}
+
+// setArgs SET 命令参数, second<0时不过期
+func setArgs(key, val string, second int64) []string {
+	if second < 0 {
+		return []string{"SET", key, val}
+	}
+	return []string{"SET", key, val, "EX", strconv.FormatInt(second, 10)}
+}
+
+// escapeGlob 转义 SCAN MATCH 中的通配符
+func escapeGlob(s string) string {
+	var sb strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(c)
+	}
+	return sb.String()
+}
@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+package rediscache
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/wup364/pakku/internal/modules/appcache/localcache"
+	"github.com/wup364/pakku/ipakku"
+)
+
+func newTestRedisCache(t *testing.T) (*RedisCache, *MemoryServer) {
+	srv, err := NewMemoryServer("", "secret")
+	if nil != err {
+		t.Fatal(err)
+	}
+	rc := new(RedisCache).InitClient(NewClient(Options{Addr: srv.Addr(), Password: "secret", DB: 1, PoolSize: 4}), "app")
+	t.Cleanup(func() {
+		rc.Destroy()
+		srv.Close()
+	})
+	return rc, srv
+}
+
+func TestRedisCache(t *testing.T) {
+	rc, _ := newTestRedisCache(t)
+	if err := rc.RegLib("user", -1); nil != err {
+		t.Fatal(err)
+	}
+	if err := rc.RegLib("user", -1); err != ipakku.ErrCacheLibIsExist {
+		t.Fatalf("err = %v", err)
+	}
+	if err := rc.RegLibWithOptions("bounded", ipakku.CacheLibOptions{MaxEntries: 10}); err != ipakku.ErrCacheNotSupported {
+		t.Fatalf("err = %v", err)
+	}
+	if err := rc.Set("none", "a", 1); err != ipakku.ErrCacheLibNotExist {
+		t.Fatalf("err = %v", err)
+	}
+
+	type user struct {
+		Name string
+		Age  int
+	}
+	if err := rc.Set("user", "u1", &user{Name: "pakku", Age: 5}); nil != err {
+		t.Fatal(err)
+	}
+	var u user
+	if err := rc.Get("user", "u1", &u); nil != err || u.Name != "pakku" || u.Age != 5 {
+		t.Fatalf("u = %v, err = %v", u, err)
+	}
+	var name string
+	if err := rc.Get("user", "u2", &name); err != ipakku.ErrNoCacheHit {
+		t.Fatalf("err = %v", err)
+	}
+	if err := rc.Get("user", "u1", &name); err != ipakku.ErrCacheConvertError {
+		t.Fatalf("err = %v", err)
+	}
+
+	if ok, err := rc.SetNX("user", "u2", "a"); nil != err || !ok {
+		t.Fatalf("ok = %v, err = %v", ok, err)
+	}
+	if ok, err := rc.SetNX("user", "u2", "b"); nil != err || ok {
+		t.Fatalf("ok = %v, err = %v", ok, err)
+	}
+	if err := rc.Get("user", "u2", &name); nil != err || name != "a" {
+		t.Fatalf("name = %s, err = %v", name, err)
+	}
+
+	if ok, _ := rc.Exists("user", "u2"); !ok {
+		t.Fatal("u2 should exist")
+	}
+	rc.Del("user", "u2")
+	if ok, _ := rc.Exists("user", "u2"); ok {
+		t.Fatal("u2 should be deleted")
+	}
+}
+
+func TestRedisCacheIncrbyAndExpire(t *testing.T) {
+	rc, _ := newTestRedisCache(t)
+	rc.RegLib("counter", 60)
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := rc.Incrby("counter", "n", int64(2)); nil != err {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	var sv localcache.StructValue
+	if err := rc.Get("counter", "n", &sv); nil != err || sv.Value.(int64) != 40 {
+		t.Fatalf("n = %v, err = %v", sv.Value, err)
+	}
+	var n int64
+	if err := rc.Get("counter", "n", &n); nil != err || n != 40 {
+		t.Fatalf("n = %d, err = %v", n, err)
+	}
+
+	// 默认过期时间和覆盖的过期时间
+	if ttl, _ := rc.client.Do("TTL", "app:counter:n"); ttl != int64(60) {
+		t.Fatalf("ttl = %v", ttl)
+	}
+	rc.Set("counter", "a", 1, 5)
+	rc.Set("counter", "b", 1, -1)
+	if ttl, _ := rc.client.Do("TTL", "app:counter:a"); ttl != int64(5) {
+		t.Fatalf("ttl = %v", ttl)
+	}
+	if ttl, _ := rc.client.Do("TTL", "app:counter:b"); ttl != int64(-1) {
+		t.Fatalf("ttl = %v", ttl)
+	}
+	if err := rc.Set("counter", "c", 1, 0); nil != err {
+		t.Fatal(err)
+	}
+	if ok, _ := rc.Exists("counter", "c"); ok {
+		t.Fatal("c should be expired")
+	}
+}
+
+func TestRedisCacheKeysAndClear(t *testing.T) {
+	rc, srv := newTestRedisCache(t)
+	rc.RegLib("a*", -1)
+	rc.RegLib("ab", -1)
+	expect := make([]string, 0)
+	for i := 0; i < 450; i++ {
+		key := "k" + strconv.Itoa(i)
+		expect = append(expect, key)
+		rc.Set("a*", key, i)
+		rc.Set("ab", key, i)
+	}
+	sort.Strings(expect)
+	keys := rc.Keys("a*")
+	sort.Strings(keys)
+	if len(keys) != len(expect) || keys[0] != expect[0] || keys[449] != expect[449] {
+		t.Fatalf("keys = %d", len(keys))
+	}
+
+	// 遍历期间删除不会遗漏
+	rc.Clear("a*")
+	if keys = rc.Keys("a*"); len(keys) != 0 {
+		t.Fatalf("keys = %v", keys)
+	}
+	if keys = rc.Keys("ab"); len(keys) != 450 {
+		t.Fatalf("keys = %d", len(keys))
+	}
+	if size, _ := rc.client.Do("DBSIZE"); size != int64(450) || srv.Commands() == 0 {
+		t.Fatalf("size = %v", size)
+	}
+}
+
+func TestRedisClientAuth(t *testing.T) {
+	_, srv := newTestRedisCache(t)
+	cli := NewClient(Options{Addr: srv.Addr(), Password: "wrong"})
+	defer cli.Close()
+	if _, err := cli.Do("PING"); nil == err {
+		t.Fatal("auth should fail")
+	}
+	cli = NewClient(Options{Addr: srv.Addr()})
+	defer cli.Close()
+	if _, err := cli.Do("GET", "a"); nil == err {
+		t.Fatal("NOAUTH expected")
+	}
+	cli.Close()
+	if _, err := cli.Do("PING"); err != ErrClientClosed {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	for _, c := range []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"*", "", true},
+		{"app:*", "app:user:1", true},
+		{"app:a\\*:*", "app:a*:k1", true},
+		{"app:a\\*:*", "app:ab:k1", false},
+		{"h?llo", "hello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+	} {
+		if matchGlob(c.pattern, c.s) != c.match {
+			t.Errorf("matchGlob(%q, %q) != %v", c.pattern, c.s, c.match)
+		}
+	}
+}
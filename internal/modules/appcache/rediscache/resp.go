@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// RESP(REdis Serialization Protocol) 编解码
+
+package rediscache
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ErrProtocol 无法解析的应答
+var ErrProtocol = errors.New("redis protocol error")
+
+// RedisError redis返回的错误应答, 如: ERR unknown command
+type RedisError string
+
+func (e RedisError) Error() string {
+	return string(e)
+}
+
+// writeCommand 以 RESP 数组的形式写入命令
+func writeCommand(w *bufio.Writer, args []string) error {
+	w.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		w.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n")
+		w.WriteString(arg)
+		w.WriteString("\r\n")
+	}
+	return w.Flush()
+}
+
+// readReply 读取应答, 返回值类型: string(简单字符串和批量字符串), int64, []any, nil, RedisError
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := readLine(r)
+	if nil != err {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, ErrProtocol
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return RedisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if nil != err || n < -1 {
+			return nil, ErrProtocol
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err = io.ReadFull(r, buf); nil != err {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if nil != err || n < -1 {
+			return nil, ErrProtocol
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		res := make([]any, n)
+		for i := 0; i < n; i++ {
+			if res[i], err = readReply(r); nil != err {
+				return nil, err
+			}
+		}
+		return res, nil
+	}
+	return nil, fmt.Errorf("%w: unexpected reply '%s'", ErrProtocol, line)
+}
+
+// readLine 读取以 \r\n 结尾的一行, 不含 \r\n
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if nil != err {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", ErrProtocol
+	}
+	return line[:len(line)-2], nil
+}
+
+// writeReply 写入应答, 供 MemoryServer 使用, 参数类型同 readReply 的返回值
+func writeReply(w *bufio.Writer, reply any) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case RedisError:
+		w.WriteString("-" + string(v) + "\r\n")
+	case simpleString:
+		w.WriteString("+" + string(v) + "\r\n")
+	case string:
+		w.WriteString("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")
+	case int64:
+		w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case []any:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, item := range v {
+			writeReply(w, item)
+		}
+	}
+}
+
+// simpleString 简单字符串应答, 如: +OK
+type simpleString string
@@ -0,0 +1,319 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 缓存工具-两级缓存实现
+// 在其他 ICache 实现(如: redis)前增加一层本地缓存, 读取时优先读取本地缓存.
+// 写入或删除时删除本地缓存, 并通过事件模块通知其他实例删除其本地缓存.
+// 本地缓存不会比远程缓存中key的剩余过期时间存活更久, 远程缓存未实现 CacheTTLGetter 时不使用本地缓存
+// 配置: cache.tiered.remote/nearExpire/nearMaxEntries
+
+package tieredcache
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/wup364/pakku/internal/modules/appcache/localcache"
+	"github.com/wup364/pakku/ipakku"
+	"github.com/wup364/pakku/pkg/logs"
+	"github.com/wup364/pakku/pkg/strutil"
+)
+
+func init() {
+	ipakku.PakkuConf.RegisterPakkuModuleImplement(new(TieredCache), "ICache", "tiered")
+}
+
+// Options 两级缓存选项, 从配置 cache.tiered 中读取
+type Options struct {
+	Remote         string `@value:"remote:redis"`                  // 远程缓存的 ICache 实现名
+	NearExpire     int64  `@value:"nearExpire:60" @valid:"min=-1"` // 本地缓存默认过期时间, 单位秒, -1为不过期
+	NearMaxEntries int    `@value:"nearMaxEntries:10000"`          // 每个缓存库的本地缓存最大key数量, 0为不限制
+}
+
+// invalidation 失效通知
+type invalidation struct {
+	Source string `json:"source"` // 发送通知的实例
+	Lib    string `json:"lib"`
+	Key    string `json:"key"` // 为空时清空整个库
+}
+
+// nearLib 本地缓存库信息
+type nearLib struct {
+	gen    uint64 // 修改计数
+	expire int64  // 本地缓存过期时间, 单位秒, -1为不过期
+}
+
+// TieredCache 两级缓存, 使用前需要调用 Init 或 InitCache 方法
+type TieredCache struct {
+	remote ipakku.ICache
+	ttl    ipakku.CacheTTLGetter
+	near   *localcache.CacheManager
+	event  ipakku.AppEvent
+	opts   Options
+	source string
+	libs   map[string]*nearLib
+	locker *sync.RWMutex
+}
+
+// SetAppEvent 设置用于发送和接收失效通知的事件模块, 未设置时只删除本实例的本地缓存
+func (tc *TieredCache) SetAppEvent(event ipakku.AppEvent) {
+	tc.event = event
+}
+
+// Init 初始化, 从配置 cache.tiered 中读取选项, 并初始化远程缓存实现
+func (tc *TieredCache) Init(config ipakku.AppConfig, appName string) {
+	if nil != tc.near {
+		return
+	}
+	var opts Options
+	if err := config.ScanAndAutoValue(ipakku.CONFKEY_CACHE_TIERED, &opts); nil != err {
+		logs.Panic(err)
+	}
+	remote, ok := ipakku.PakkuConf.GetPakkuModuleImplement("ICache", opts.Remote, "").(ipakku.ICache)
+	if !ok {
+		logs.Panicf("cache implement '%s' does not exist", opts.Remote)
+	}
+	if _, ok = remote.(*TieredCache); ok {
+		logs.Panicf("cache implement '%s' cannot be used as remote cache", opts.Remote)
+	}
+	if setter, ok := remote.(ipakku.CacheEventSetter); ok && nil != tc.event {
+		setter.SetAppEvent(tc.event)
+	}
+	remote.Init(config, appName)
+	ipakku.PakkuConf.SetPakkuModuleImplementInitialized(remote, true)
+	if err := tc.InitCache(remote, opts); nil != err {
+		logs.Panic(err)
+	}
+}
+
+// InitCache 使用已初始化的远程缓存初始化
+func (tc *TieredCache) InitCache(remote ipakku.ICache, opts Options) error {
+	if nil == remote {
+		return errors.New("remote cache is nil")
+	}
+	tc.remote = remote
+	if ttl, ok := remote.(ipakku.CacheTTLGetter); ok {
+		tc.ttl = ttl
+	} else {
+		logs.Warnf("cache implement %T does not support TTL, local cache is disabled", remote)
+	}
+	tc.opts = opts
+	tc.source = strutil.GetUUID()
+	tc.libs = make(map[string]*nearLib)
+	tc.locker = new(sync.RWMutex)
+	tc.near = new(localcache.CacheManager)
+	tc.near.Init(nil, "")
+	if nil != tc.event {
+		if err := tc.event.ConsumerEvent(ipakku.EVENT_GROUP_CACHE, ipakku.EVENT_NAME_CACHE_INVALIDATE, tc.onInvalidate); nil != err {
+			logs.Errorf("subscribe cache invalidation failed, local cache of other instances will not be invalidated: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// RegLib 注册缓存库, 本地缓存使用配置的默认过期时间
+// lib为库名, second:过期时间-1为不过期
+func (tc *TieredCache) RegLib(clib string, second int64) error {
+	return tc.RegLibWithOptions(clib, ipakku.CacheLibOptions{Expire: second})
+}
+
+// RegLibWithOptions 按选项注册缓存库, Expire 用于远程缓存, NearExpire/MaxEntries/MaxBytes/Policy/OnEvict 用于本地缓存
+func (tc *TieredCache) RegLibWithOptions(clib string, opts ipakku.CacheLibOptions) error {
+	if err := tc.remote.RegLib(clib, opts.Expire); nil != err {
+		return err
+	}
+	nearOpts := opts
+	if nearOpts.Expire = opts.NearExpire; nearOpts.Expire == 0 {
+		nearOpts.Expire = tc.opts.NearExpire
+	}
+	if nearOpts.Expire < 0 || (opts.Expire >= 0 && opts.Expire < nearOpts.Expire) {
+		// 本地缓存不能比远程缓存存活更久
+		nearOpts.Expire = opts.Expire
+	}
+	if nearOpts.MaxEntries == 0 && nearOpts.MaxBytes == 0 {
+		nearOpts.MaxEntries = tc.opts.NearMaxEntries
+	}
+	if err := tc.near.RegLibWithOptions(clib, nearOpts); nil != err {
+		return err
+	}
+	tc.locker.Lock()
+	tc.libs[clib] = &nearLib{expire: nearOpts.Expire}
+	tc.locker.Unlock()
+	return nil
+}
+
+// Stats 获取本地缓存的统计信息
+func (tc *TieredCache) Stats(clib string) (ipakku.CacheLibStats, error) {
+	return tc.near.Stats(clib)
+}
+
+// Exists 返回key是否存在, 以远程缓存为准
+func (tc *TieredCache) Exists(clib string, key string) (bool, error) {
+	if _, err := tc.getLib(clib); nil != err {
+		return false, err
+	}
+	return tc.remote.Exists(clib, key)
+}
+
+// Get 读取缓存信息, 本地缓存未命中时读取远程缓存并保存到本地缓存.
+// 本地缓存的过期时间不超过key在远程缓存中的剩余过期时间, 剩余不足1秒时不保存
+func (tc *TieredCache) Get(clib string, key string, val any) error {
+	lib, err := tc.getLib(clib)
+	if nil != err {
+		return err
+	}
+	if _, ok := val.(*localcache.StructValue); !ok {
+		if err = tc.near.Get(clib, key, val); nil == err || err != ipakku.ErrNoCacheHit {
+			return err
+		}
+	}
+	// 读取远程缓存期间key被修改时不保存到本地缓存
+	start := atomic.LoadUint64(&lib.gen)
+	if err = tc.remote.Get(clib, key, val); nil != err {
+		return err
+	}
+	if rv := reflect.ValueOf(val); rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		if _, ok := val.(*localcache.StructValue); !ok && nil != tc.ttl {
+			if second, ok := tc.nearExpire(lib, clib, key); ok && atomic.LoadUint64(&lib.gen) == start {
+				tc.near.Set(clib, key, rv.Elem().Interface(), second)
+			}
+		}
+	}
+	return nil
+}
+
+// nearExpire 本地缓存的过期时间, 取库的本地缓存过期时间和key在远程缓存中的剩余过期时间中较小的
+func (tc *TieredCache) nearExpire(lib *nearLib, clib, key string) (int64, bool) {
+	remain, err := tc.ttl.TTL(clib, key)
+	if nil != err || remain == 0 {
+		return 0, false
+	}
+	if remain < 0 || (lib.expire >= 0 && lib.expire < remain) {
+		return lib.expire, true
+	}
+	return remain, true
+}
+
+// Keys 获取库的所有key
+func (tc *TieredCache) Keys(clib string) []string {
+	return tc.remote.Keys(clib)
+}
+
+// Set 向lib库中设置键为key的值
+// args[0] 为缓存值 args[1]如果存在, 则覆盖默认过期时间, 单位秒. 本地缓存读取时按剩余过期时间保存
+func (tc *TieredCache) Set(clib string, key string, args ...any) error {
+	if err := tc.remote.Set(clib, key, args...); nil != err {
+		return err
+	}
+	tc.invalidate(clib, key)
+	return nil
+}
+
+// SetNX 向lib库中设置键为key的值, 当key不存在时设置成功, 并返回true
+// args[0] 为缓存值 args[1]如果存在, 则覆盖默认过期时间, 单位秒
+func (tc *TieredCache) SetNX(clib string, key string, args ...any) (bool, error) {
+	ok, err := tc.remote.SetNX(clib, key, args...)
+	if nil == err && ok {
+		tc.invalidate(clib, key)
+	}
+	return ok, err
+}
+
+// Incrby 指定key以increment的值累加, 返回累加后的值, 计数器不保存到本地缓存
+// args[0] 为缓存值 args[1]如果存在, 则覆盖默认过期时间, 单位秒
+func (tc *TieredCache) Incrby(clib string, key string, args ...any) (int64, error) {
+	res, err := tc.remote.Incrby(clib, key, args...)
+	if nil == err {
+		tc.invalidate(clib, key)
+	}
+	return res, err
+}
+
+// Del 删除缓存信息
+func (tc *TieredCache) Del(clib string, key string) error {
+	if err := tc.remote.Del(clib, key); nil != err {
+		return err
+	}
+	tc.invalidate(clib, key)
+	return nil
+}
+
+// Clear 清空库内容
+func (tc *TieredCache) Clear(clib string) {
+	tc.remote.Clear(clib)
+	tc.invalidate(clib, "")
+}
+
+// Destroy 释放本地缓存和远程缓存持有的资源
+func (tc *TieredCache) Destroy() {
+	if nil != tc.near {
+		tc.near.Destroy()
+	}
+	ipakku.PakkuConf.SetPakkuModuleImplementInitialized(tc.remote, false)
+	if destroyer, ok := tc.remote.(interface{ Destroy() }); ok {
+		destroyer.Destroy()
+	}
+}
+
+// invalidate 删除本地缓存并通知其他实例
+func (tc *TieredCache) invalidate(clib, key string) {
+	tc.invalidateNear(clib, key)
+	if nil == tc.event {
+		return
+	}
+	data, _ := json.Marshal(&invalidation{Source: tc.source, Lib: clib, Key: key})
+	if err := tc.event.PublishEvent(ipakku.EVENT_GROUP_CACHE, ipakku.EVENT_NAME_CACHE_INVALIDATE, string(data)); nil != err {
+		logs.Errorf("publish cache invalidation failed: %s", err.Error())
+	}
+}
+
+// invalidateNear 删除本地缓存, key为空时清空整个库
+func (tc *TieredCache) invalidateNear(clib, key string) {
+	lib, err := tc.getLib(clib)
+	if nil != err {
+		return
+	}
+	atomic.AddUint64(&lib.gen, 1)
+	if len(key) == 0 {
+		tc.near.Clear(clib)
+	} else {
+		tc.near.Del(clib, key)
+	}
+}
+
+// onInvalidate 收到其他实例的失效通知
+func (tc *TieredCache) onInvalidate(v any) error {
+	var data []byte
+	switch val := v.(type) {
+	case string:
+		data = []byte(val)
+	case []byte:
+		data = val
+	default:
+		var err error
+		if data, err = json.Marshal(v); nil != err {
+			return err
+		}
+	}
+	msg := new(invalidation)
+	if err := json.Unmarshal(data, msg); nil != err {
+		return err
+	}
+	if msg.Source != tc.source {
+		tc.invalidateNear(msg.Lib, msg.Key)
+	}
+	return nil
+}
+
+// getLib 获取本地缓存库信息
+func (tc *TieredCache) getLib(clib string) (*nearLib, error) {
+	tc.locker.RLock()
+	defer tc.locker.RUnlock()
+	if lib, ok := tc.libs[clib]; ok {
+		return lib, nil
+	}
+	return nil, ipakku.ErrCacheLibNotExist
+}
@@ -0,0 +1,217 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+package tieredcache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wup364/pakku/internal/modules/appcache/localcache"
+	"github.com/wup364/pakku/internal/modules/appcache/rediscache"
+	"github.com/wup364/pakku/ipakku"
+)
+
+// memoryBus 进程内广播事件, 模拟多个实例共用的消息队列
+type memoryBus struct {
+	handles map[string][]ipakku.EventHandle
+	l       sync.Mutex
+}
+
+func (bus *memoryBus) PublishEvent(group string, name string, val any) error {
+	bus.l.Lock()
+	handles := bus.handles[group+"."+name]
+	bus.l.Unlock()
+	for _, fn := range handles {
+		if err := fn(val); nil != err {
+			return err
+		}
+	}
+	return nil
+}
+
+func (bus *memoryBus) ConsumerEvent(group string, name string, fun ipakku.EventHandle) error {
+	bus.l.Lock()
+	defer bus.l.Unlock()
+	if nil == bus.handles {
+		bus.handles = make(map[string][]ipakku.EventHandle)
+	}
+	bus.handles[group+"."+name] = append(bus.handles[group+"."+name], fun)
+	return nil
+}
+
+// newTestInstances 两个共用redis和事件的实例
+func newTestInstances(t *testing.T, bus ipakku.AppEvent) (*TieredCache, *TieredCache, *rediscache.MemoryServer) {
+	srv, err := rediscache.NewMemoryServer("", "")
+	if nil != err {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	newInstance := func() *TieredCache {
+		remote := new(rediscache.RedisCache).InitClient(rediscache.NewClient(rediscache.Options{Addr: srv.Addr()}), "app")
+		tc := new(TieredCache)
+		if nil != bus {
+			tc.SetAppEvent(bus)
+		}
+		if err := tc.InitCache(remote, Options{NearExpire: 60, NearMaxEntries: 100}); nil != err {
+			t.Fatal(err)
+		}
+		if err := tc.RegLib("user", -1); nil != err {
+			t.Fatal(err)
+		}
+		t.Cleanup(tc.Destroy)
+		return tc
+	}
+	return newInstance(), newInstance(), srv
+}
+
+type user struct {
+	Name string
+}
+
+func TestTieredCacheNearHit(t *testing.T) {
+	a, _, srv := newTestInstances(t, new(memoryBus))
+	if err := a.Set("user", "u1", &user{Name: "pakku"}); nil != err {
+		t.Fatal(err)
+	}
+
+	var u user
+	if err := a.Get("user", "u1", &u); nil != err || u.Name != "pakku" {
+		t.Fatalf("u = %v, err = %v", u, err)
+	}
+	// 再次读取时命中本地缓存, 不访问redis
+	commands := srv.Commands()
+	for i := 0; i < 10; i++ {
+		u = user{}
+		if err := a.Get("user", "u1", &u); nil != err || u.Name != "pakku" {
+			t.Fatalf("u = %v, err = %v", u, err)
+		}
+	}
+	if srv.Commands() != commands {
+		t.Fatalf("commands: %d -> %d", commands, srv.Commands())
+	}
+	// 修改读取到的对象不影响本地缓存
+	u.Name = "changed"
+	a.Get("user", "u1", &u)
+	if u.Name != "pakku" {
+		t.Fatalf("u = %v", u)
+	}
+	if stats, _ := a.Stats("user"); stats.Hits != 11 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	if err := a.Get("user", "none", &u); err != ipakku.ErrNoCacheHit {
+		t.Fatalf("err = %v", err)
+	}
+	if err := a.Get("none", "u1", &u); err != ipakku.ErrCacheLibNotExist {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestTieredCacheInvalidation(t *testing.T) {
+	a, b, _ := newTestInstances(t, new(memoryBus))
+	a.Set("user", "u1", &user{Name: "v1"})
+	var u user
+	a.Get("user", "u1", &u)
+	b.Get("user", "u1", &u)
+
+	// b修改后a的本地缓存失效
+	b.Set("user", "u1", &user{Name: "v2"})
+	if a.Get("user", "u1", &u); u.Name != "v2" {
+		t.Fatalf("u = %v", u)
+	}
+	b.Del("user", "u1")
+	if err := a.Get("user", "u1", &u); err != ipakku.ErrNoCacheHit {
+		t.Fatalf("err = %v", err)
+	}
+
+	a.Set("user", "u2", &user{Name: "v1"})
+	a.Get("user", "u2", &u)
+	b.Clear("user")
+	if ok, _ := a.Exists("user", "u2"); ok {
+		t.Fatal("u2 should be cleared")
+	}
+
+	// 计数器不保存到本地缓存
+	a.RegLib("counter", -1)
+	b.RegLib("counter", -1)
+	a.Incrby("counter", "n", int64(1))
+	b.Incrby("counter", "n", int64(2))
+	var sv localcache.StructValue
+	if err := a.Get("counter", "n", &sv); nil != err || sv.Value.(int64) != 3 {
+		t.Fatalf("n = %v, err = %v", sv.Value, err)
+	}
+}
+
+func TestTieredCacheWithoutEvent(t *testing.T) {
+	a, b, _ := newTestInstances(t, nil)
+	a.Set("user", "u1", &user{Name: "v1"})
+	var u user
+	a.Get("user", "u1", &u)
+	b.Set("user", "u1", &user{Name: "v2"})
+
+	// 未设置事件模块时其他实例的本地缓存在过期前不会更新
+	if a.Get("user", "u1", &u); u.Name != "v1" {
+		t.Fatalf("u = %v", u)
+	}
+	if b.Get("user", "u1", &u); u.Name != "v2" {
+		t.Fatalf("u = %v", u)
+	}
+	if keys := a.Keys("user"); len(keys) != 1 || keys[0] != "u1" {
+		t.Fatalf("keys = %v", keys)
+	}
+}
+
+func TestTieredCacheNearOptions(t *testing.T) {
+	a, _, _ := newTestInstances(t, nil)
+	if err := a.RegLibWithOptions("small", ipakku.CacheLibOptions{Expire: -1, MaxEntries: 2}); nil != err {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"k1", "k2", "k3"} {
+		a.Set("small", key, key)
+		var val string
+		if err := a.Get("small", key, &val); nil != err || val != key {
+			t.Fatalf("val = %s, err = %v", val, err)
+		}
+	}
+	if stats, _ := a.Stats("small"); stats.Entries != 2 || stats.Evictions != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	// 本地缓存淘汰后从redis读取
+	var val string
+	if err := a.Get("small", "k1", &val); nil != err || val != "k1" {
+		t.Fatalf("val = %s, err = %v", val, err)
+	}
+	if err := a.RegLib("small", -1); err != ipakku.ErrCacheLibIsExist {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestTieredCacheKeyTTL(t *testing.T) {
+	a, _, _ := newTestInstances(t, nil)
+
+	// 本地缓存按key的剩余过期时间保存, 不足1秒时不保存
+	a.Set("user", "short", &user{Name: "v1"}, int64(1))
+	a.Set("user", "long", &user{Name: "v1"}, int64(2))
+	var u user
+	if err := a.Get("user", "short", &u); nil != err || u.Name != "v1" {
+		t.Fatalf("u = %v, err = %v", u, err)
+	}
+	if err := a.Get("user", "long", &u); nil != err || u.Name != "v1" {
+		t.Fatalf("u = %v, err = %v", u, err)
+	}
+	if stats, _ := a.Stats("user"); stats.Entries != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	time.Sleep(2100 * time.Millisecond)
+	for _, key := range []string{"short", "long"} {
+		if err := a.Get("user", key, &u); err != ipakku.ErrNoCacheHit {
+			t.Fatalf("%s: err = %v", key, err)
+		}
+		if ok, _ := a.Exists("user", key); ok {
+			t.Fatalf("%s should be expired", key)
+		}
+	}
+}
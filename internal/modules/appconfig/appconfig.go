@@ -1,20 +1,45 @@
 package appconfig
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"time"
+
 	"github.com/wup364/pakku/ipakku"
+	"github.com/wup364/pakku/pkg/fileutil"
 	"github.com/wup364/pakku/pkg/logs"
 	"github.com/wup364/pakku/pkg/utypes"
 
 	// 通过 init 函数注册
 	"github.com/wup364/pakku/internal/modules/appconfig/confutils"
 	_ "github.com/wup364/pakku/internal/modules/appconfig/jsonconfig"
+	_ "github.com/wup364/pakku/internal/modules/appconfig/remoteconfig"
+	_ "github.com/wup364/pakku/internal/modules/appconfig/tomlconfig"
+	_ "github.com/wup364/pakku/internal/modules/appconfig/yamlconfig"
 )
 
+func init() {
+	// 注册的 IConfig 实现由本模块选用并初始化
+	ipakku.PakkuConf.SetPakkuModuleImplementOwner("IConfig", "AppConfig")
+}
+
+// configImplements 配置文件扩展名对应的 IConfig 实现
+var configImplements = [][2]string{{".json", "json"}, {".yaml", "yaml"}, {".yml", "yaml"}, {".toml", "toml"}}
+
 // AppConfig 配置模块
 type AppConfig struct {
 	configname string
+	configDir  string
+	profile    string
 	config     ipakku.IConfig
+	layered    *confutils.LayeredConfig
+	secret     *confutils.SecretConfig
+	watcher    *confutils.ConfigWatcher
 	autoValue  *confutils.AutoValueOfBeanUtil
+	keys       *confutils.ConfigKeyRecorder
 }
 
 // AsModule 作为一个模块加载
@@ -23,12 +48,34 @@ func (conf *AppConfig) AsModule() ipakku.Opts {
 		Version:     1.0,
 		Description: "AppConfig module",
 		OnReady: func(app ipakku.Application) {
-			// 获取配置的适配器, 默认json
-			if err := ipakku.PakkuConf.AutowirePakkuModuleImplement(app.Params(), &conf.config, "json"); nil != err {
+			// 获取配置的适配器, 未指定时设置了远程配置地址环境变量则使用remote, 否则按已存在的配置文件扩展名选择, 默认json
+			conf.configname = app.Params().GetParam(ipakku.PARAMS_KEY_APPNAME).ToString(ipakku.DEFT_VAL_APPNAME)
+			conf.configDir = ipakku.GetConfigDir(app.Params())
+			if err := ipakku.PakkuConf.AutowirePakkuModuleImplement(app.Params(), &conf.config, detectImplement(conf.configDir, conf.configname)); nil != err {
 				logs.Panic(err)
 			}
-			conf.configname = app.Params().GetParam(ipakku.PARAMS_KEY_APPNAME).ToString(ipakku.DEFT_VAL_APPNAME)
-			conf.autoValue = confutils.NewAutoValueOfBeanUtil(conf.config)
+			if setter, ok := conf.config.(ipakku.ConfigDirSetter); ok {
+				setter.SetConfigDir(conf.configDir)
+			}
+			conf.profile = app.Params().GetParam(ipakku.PARAMS_KEY_PROFILE).ToString(os.Getenv(ipakku.ENV_KEY_PROFILE))
+			conf.layered = confutils.NewLayeredConfig(conf.config).
+				SetDefaults(app.Params().GetParam(ipakku.PARAMS_KEY_CONFIG_DEFAULTS).ToStrMap(nil)).
+				SetEnvPrefix(envPrefix(app.Params(), conf.configname), app.Params().GetParam(ipakku.PARAMS_KEY_CONFIG_ENV_PREFIX_ONLY).ToBool(true))
+			// 加密的配置值读取时解密
+			key, err := confutils.LoadSecretKey(app.Params().GetParam(ipakku.PARAMS_KEY_CONFIG_KEY_FILE).ToString(filepath.Join(conf.configDir, conf.configname+".key")))
+			if nil != err {
+				logs.Panic(err)
+			}
+			if conf.secret, err = confutils.NewSecretConfig(conf.layered, key); nil != err {
+				logs.Panic(err)
+			}
+			interval, ok := app.Params().GetParam(ipakku.PARAMS_KEY_CONFIG_RELOAD_INTERVAL).GetVal().(time.Duration)
+			if !ok {
+				interval = 5 * time.Second
+			}
+			conf.watcher = confutils.NewConfigWatcher(conf.secret, interval)
+			conf.keys = confutils.NewConfigKeyRecorder()
+			conf.autoValue = confutils.NewAutoValueOfBeanUtil(conf.secret).SetConfigWatcher(conf.watcher).SetKeyRecorder(conf.keys)
 
 			// 注册监听 - 自动完成配置类的配置
 			app.Modules().OnModuleEvent("*", ipakku.ModuleEventOnReady, func(module any, app ipakku.Application) {
@@ -39,18 +86,66 @@ func (conf *AppConfig) AsModule() ipakku.Opts {
 		},
 		OnInit: func() {
 			conf.config.Init(conf.configname)
+			if len(conf.profile) > 0 {
+				conf.layered.SetProfile(conf.newProfileConfig())
+			}
+			ipakku.PakkuConf.SetPakkuModuleImplementInitialized(conf.config, true)
+		},
+		OnShutdown: func() {
+			conf.watcher.Stop()
+			ipakku.PakkuConf.SetPakkuModuleImplementInitialized(conf.config, false)
 		},
 	}
 }
 
 // GetConfig 读取key的value信息, 返回 Object 对象, 里面的值可能是string或者map
 func (conf *AppConfig) GetConfig(key string) (res utypes.Object) {
-	return conf.config.GetConfig(key)
+	if !conf.keys.Has(key) {
+		// 记录调用方, 便于查找配置的使用位置
+		owner := ""
+		if pc, _, _, ok := runtime.Caller(1); ok {
+			if fn := runtime.FuncForPC(pc); nil != fn {
+				owner = fn.Name()
+			}
+		}
+		conf.keys.Record(key, nil, "", owner, "")
+	}
+	return conf.secret.GetConfig(key)
 }
 
 // SetConfig 设置值
 func (conf *AppConfig) SetConfig(key string, value any) error {
-	return conf.config.SetConfig(key, value)
+	return conf.layered.SetConfig(key, value)
+}
+
+// Watch 监听 keyPrefix 的值变化, 配置文件重新加载后值发生变化时回调
+func (conf *AppConfig) Watch(keyPrefix string, fn func(old, new utypes.Object)) {
+	conf.watcher.Watch(keyPrefix, fn)
+}
+
+// EncryptValue 加密 value, 返回 ENC(...) 形式的密文, 可直接写入配置文件
+func (conf *AppConfig) EncryptValue(value string) (string, error) {
+	return conf.secret.Encrypt(value)
+}
+
+// EncryptConfig 加密基础配置文件中 key 的明文值并回写, 已加密时不做处理, 值被覆盖时返回错误
+func (conf *AppConfig) EncryptConfig(key string) error {
+	return conf.secret.EncryptConfig(key)
+}
+
+// GetConfigKeys 获取已读取过的配置key, 包括 @value 标签和 GetConfig 读取的key
+func (conf *AppConfig) GetConfigKeys() []ipakku.ConfigKeyInfo {
+	return conf.keys.Keys()
+}
+
+// ExportConfigSchema 根据已读取过的配置key导出 JSON Schema
+func (conf *AppConfig) ExportConfigSchema() ([]byte, error) {
+	return json.MarshalIndent(conf.keys.JSONSchema(), "", "  ")
+}
+
+// ExportSampleConfig 根据已读取过的配置key导出示例配置(JSON), 值为默认值或类型的零值
+func (conf *AppConfig) ExportSampleConfig() ([]byte, error) {
+	return json.MarshalIndent(conf.keys.SampleConfig(), "", "  ")
 }
 
 // ScanAndAutoConfig 扫描带有@autoconfig标签的字段, 并完成其配置
@@ -62,3 +157,37 @@ func (conf *AppConfig) ScanAndAutoConfig(ptr any) error {
 func (conf *AppConfig) ScanAndAutoValue(configPrefix string, ptr any) error {
 	return conf.autoValue.ScanAndAutoValue(configPrefix, ptr)
 }
+
+// newProfileConfig 使用与基础配置相同的实现, 读取 {app}-{profile} 配置
+func (conf *AppConfig) newProfileConfig() ipakku.IConfig {
+	ctype := reflect.TypeOf(conf.config)
+	if ctype.Kind() != reflect.Ptr {
+		logs.Panicf("unsupported config implement type: %s", ctype.String())
+	}
+	profile := reflect.New(ctype.Elem()).Interface().(ipakku.IConfig)
+	if setter, ok := profile.(ipakku.ConfigDirSetter); ok {
+		setter.SetConfigDir(conf.configDir)
+	}
+	if err := profile.Init(conf.configname + "-" + conf.profile); nil != err {
+		logs.Panic(err)
+	}
+	return profile
+}
+
+// envPrefix 环境变量配置的前缀, 未设置时为 {APPNAME}_, 如: pakku-demo => PAKKU_DEMO_
+func envPrefix(params ipakku.Params, appName string) string {
+	return params.GetParam(ipakku.PARAMS_KEY_CONFIG_ENV_PREFIX).ToString(confutils.EnvKey(appName) + "_")
+}
+
+// detectImplement 设置了远程配置地址环境变量时使用remote, 否则根据已存在的配置文件扩展名选择 IConfig 实现, 默认json
+func detectImplement(configDir, appName string) string {
+	if len(os.Getenv(ipakku.ENV_KEY_CONFIG_URL)) > 0 {
+		return "remote"
+	}
+	for _, impl := range configImplements {
+		if fileutil.IsFile(filepath.Join(configDir, appName+impl[0])) {
+			return impl[1]
+		}
+	}
+	return "json"
+}
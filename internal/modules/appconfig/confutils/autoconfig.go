@@ -1,10 +1,12 @@
 package confutils
 
 import (
+	"encoding"
 	"errors"
 	"fmt"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"unsafe"
 
 	"github.com/wup364/pakku/ipakku"
@@ -20,7 +22,21 @@ func NewAutoValueOfBeanUtil(config ipakku.IConfig) *AutoValueOfBeanUtil {
 
 // AutoValueOfBeanUtil 自动配置工具
 type AutoValueOfBeanUtil struct {
-	config ipakku.IConfig
+	config   ipakku.IConfig
+	watcher  *ConfigWatcher
+	recorder *ConfigKeyRecorder
+}
+
+// SetConfigWatcher 设置配置变化监听, 用于重新配置 @autoConfig:"prefix,reload" 标注的字段
+func (av *AutoValueOfBeanUtil) SetConfigWatcher(watcher *ConfigWatcher) *AutoValueOfBeanUtil {
+	av.watcher = watcher
+	return av
+}
+
+// SetKeyRecorder 设置配置key记录器, 记录 @value 标注的字段读取的key
+func (av *AutoValueOfBeanUtil) SetKeyRecorder(recorder *ConfigKeyRecorder) *AutoValueOfBeanUtil {
+	av.recorder = recorder
+	return av
 }
 
 // ScanAndAutoConfig 扫描带有@autoconfig标签的字段, 并完成其配置
@@ -30,7 +46,7 @@ func (av *AutoValueOfBeanUtil) ScanAndAutoConfig(ptr any) (err error) {
 		return errors.New("only pointer objects are supported")
 	}
 
-	return av.scanAndAutoConfig(ptr, "")
+	return av.scanAndAutoConfig(ptr, "", true)
 }
 
 // ScanAndAutoValue 扫描带有@value标签的字段, 并完成其配置
@@ -39,33 +55,76 @@ func (av *AutoValueOfBeanUtil) ScanAndAutoValue(cprefix string, ptr any) (err er
 	if refVal.Kind() != reflect.Pointer || refVal.Elem().Kind() != reflect.Struct {
 		return errors.New("the input object must be a pointer struct")
 	}
-	if err = av.setBeanValue(cprefix, refVal); nil != err {
+	if err = av.setBeanValue(cprefix, refVal, true); nil != err {
 		return
 	}
 	return err
 }
 
-// scanAndAutoConfig 扫描自动配置类并配置
-func (av *AutoValueOfBeanUtil) scanAndAutoConfig(ptr any, prefix string) (err error) {
+// scanAndAutoConfig 扫描自动配置类并配置, watch 为 false 时(重新配置过程中)不再注册监听
+func (av *AutoValueOfBeanUtil) scanAndAutoConfig(ptr any, prefix string, watch bool) (err error) {
 	var fieldVals map[string]string
 	if fieldVals = reflectutil.GetTagValues(ipakku.STAG_AUTOCONFIG, ptr); len(fieldVals) == 0 {
 		return
 	}
 
-	// 获得配置类
-	for field, cprefix := range fieldVals {
+	// 获得配置类, 校验不通过的字段汇总后返回
+	var verrs []ipakku.ConfigFieldError
+	for field, tagval := range fieldVals {
+		cprefix, reload := parseAutoConfigTag(tagval)
 		if len(prefix) > 0 {
 			cprefix = prefix + "." + cprefix
 		}
-		if err = av.doConfigField(ptr, cprefix, field); nil != err {
+		if reload {
+			if err = checkReloadField(ptr, field); nil != err {
+				return
+			}
+		}
+		if err = collectValidationErr(&verrs, av.doConfigField(ptr, cprefix, field, watch)); nil != err {
 			return
 		}
+		if reload && watch && nil != av.watcher {
+			av.watchField(ptr, cprefix, field)
+		}
 	}
-	return err
+	return newValidationErr(verrs)
+}
+
+// checkReloadField 重新配置的字段需为指针类型, 新的值构建完成后原子替换, 读取方通过 ipakku.LoadAutoConfig 读取
+func checkReloadField(ptr any, field string) error {
+	fvalue, err := reflectutil.GetStructFieldRefValue(ptr, field)
+	if nil != err {
+		return err
+	}
+	if fvalue.Kind() != reflect.Ptr {
+		return fmt.Errorf("the field %s with reload option must be a pointer, got %s", field, fvalue.Type().String())
+	}
+	return nil
+}
+
+// watchField 配置变化时重新配置字段, 新的值构建完成后原子替换
+func (av *AutoValueOfBeanUtil) watchField(ptr any, cprefix, field string) {
+	av.watcher.Watch(cprefix, func(old, new utypes.Object) {
+		logs.Infof("> AutoConfig reload %s[%s] ", field, cprefix)
+		if err := av.doConfigField(ptr, cprefix, field, false); nil != err {
+			logs.Errorf("> AutoConfig reload %s [err=%s] ", field, err.Error())
+		}
+	})
+}
+
+// parseAutoConfigTag 解析 @autoConfig 标签, 格式: 配置路径[,reload]
+func parseAutoConfigTag(tagval string) (cprefix string, reload bool) {
+	opts := strings.Split(tagval, ",")
+	for _, opt := range opts[1:] {
+		if strings.TrimSpace(opt) == "reload" {
+			reload = true
+		}
+	}
+	return strings.TrimSpace(opts[0]), reload
 }
 
 // doConfigField 配置ptr内的某个字段
-func (av *AutoValueOfBeanUtil) doConfigField(ptr any, cprefix, fieldName string) (err error) {
+func (av *AutoValueOfBeanUtil) doConfigField(ptr any, cprefix, fieldName string, watch bool) (err error) {
 	var fvalue reflect.Value
 	if fvalue, err = reflectutil.GetStructFieldRefValue(ptr, fieldName); nil != err {
 		logs.Errorf("> AutoConfig %s [err=%s] ", fieldName, err.Error())
@@ -80,32 +139,23 @@ func (av *AutoValueOfBeanUtil) doConfigField(ptr any, cprefix, fieldName string)
 	} else {
 		newValue = reflect.New(fvalue.Type())
 	}
-	if err = av.setBeanValue(cprefix, newValue); nil != err {
+	if err = av.setBeanValue(cprefix, newValue, watch); nil != err {
 		return
 	}
 
-	// 回写值
-	fValElem := reflect.NewAt(fvalue.Type(), unsafe.Pointer(fvalue.UnsafeAddr())).Elem()
+	// 回写值, 指针类型原子替换, 重新配置时与读取方并发
 	if fvalue.Type().Kind() == reflect.Ptr {
-		fValElem.Set(newValue)
+		atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(fvalue.UnsafeAddr())), newValue.UnsafePointer())
 	} else {
-		fValElem.Set(newValue.Elem())
+		reflect.NewAt(fvalue.Type(), unsafe.Pointer(fvalue.UnsafeAddr())).Elem().Set(newValue.Elem())
 	}
 	return
 }
 
-// setBeanValue 结构赋值
-func (av *AutoValueOfBeanUtil) setBeanValue(cprefix string, ptr reflect.Value) (err error) {
-	var tagvals = make(map[string]string)
-	if tagvals = reflectutil.GetTagValues(ipakku.STAG_CONFIG_VALUE, ptr); len(tagvals) == 0 {
-		// 继续扫描匿名类
-		if err = av.scanAndAutoConfigAnonymous(ptr, cprefix); nil == err {
-			// 继续扫描嵌套的自动配置类
-			err = av.scanAndAutoConfig(ptr, cprefix)
-		}
-		return
-	}
-	//
+// setBeanValue 结构赋值, 转换失败或 @valid 校验不通过的字段汇总为 *ipakku.ConfigValidationError
+func (av *AutoValueOfBeanUtil) setBeanValue(cprefix string, ptr reflect.Value, watch bool) (err error) {
+	var verrs []ipakku.ConfigFieldError
+	var tagvals = reflectutil.GetTagValues(ipakku.STAG_CONFIG_VALUE, ptr)
 	for fieldName, confPath := range tagvals {
 		defaultVal := ""
 		configKey := confPath
@@ -121,219 +171,243 @@ func (av *AutoValueOfBeanUtil) setBeanValue(cprefix string, ptr reflect.Value) (
 		}
 
 		var confVal utypes.Object
+		sf, _ := ptr.Elem().Type().FieldByName(fieldName)
 		vv := ptr.Elem().FieldByName(fieldName)
-		if confVal = av.config.GetConfig(configKey); confVal.IsNill() && len(defaultVal) > 0 {
-			confVal = utypes.NewObject(defaultVal)
+		fieldErr := func(reason string) {
+			verrs = append(verrs, ipakku.ConfigFieldError{Key: configKey, Field: ptr.Elem().Type().Name() + "." + fieldName, Reason: reason})
 		}
-		if err = av.setFeildValue(reflect.NewAt(vv.Type(), unsafe.Pointer(vv.UnsafeAddr())).Elem(), confVal); nil != err {
+		if confVal, err = av.getConfig(configKey); nil != err {
 			return
+		} else if confVal.IsNill() && len(defaultVal) > 0 {
+			confVal = utypes.NewObject(defaultVal)
+		}
+		fv := reflect.NewAt(vv.Type(), unsafe.Pointer(vv.UnsafeAddr())).Elem()
+		if nil != av.recorder {
+			av.recorder.Record(configKey, vv.Type(), defaultVal, ptr.Elem().Type().String()+"."+fieldName, sf.Tag.Get(ipakku.STAG_CONFIG_VALID))
+		}
+		if err = av.setFeildValue(fv, confVal); nil != err {
+			var cerr *convertError
+			if !errors.As(err, &cerr) {
+				return
+			}
+			fieldErr(err.Error())
+			continue
+		}
+		for _, reason := range validateFieldValue(sf.Tag.Get(ipakku.STAG_CONFIG_VALID), confVal, fv) {
+			fieldErr(reason)
 		}
 	}
 
-	if nil == err {
-		// 继续扫描匿名类
-		if err = av.scanAndAutoConfigAnonymous(ptr, cprefix); nil == err {
-			// 继续扫描嵌套的自动配置类
-			err = av.scanAndAutoConfig(ptr, cprefix)
-		}
+	// 继续扫描匿名类
+	if err = collectValidationErr(&verrs, av.scanAndAutoConfigAnonymous(ptr, cprefix, watch)); nil != err {
+		return
 	}
-	return err
+	// 继续扫描嵌套的自动配置类
+	if err = collectValidationErr(&verrs, av.scanAndAutoConfig(ptr, cprefix, watch)); nil != err {
+		return
+	}
+	return newValidationErr(verrs)
+}
+
+// configGetterE 读取配置时返回错误的配置, 如: SecretConfig 解密失败时
+type configGetterE interface {
+	GetConfigE(key string) (utypes.Object, error)
+}
+
+// getConfig 读取配置, 配置实现了 configGetterE 时返回读取失败的错误, 使自动配置失败而不是绑定空值
+func (av *AutoValueOfBeanUtil) getConfig(key string) (utypes.Object, error) {
+	if getter, ok := av.config.(configGetterE); ok {
+		return getter.GetConfigE(key)
+	}
+	return av.config.GetConfig(key), nil
 }
 
 // setFeildValue 设置字段值
 func (av *AutoValueOfBeanUtil) setFeildValue(v reflect.Value, o utypes.Object) error {
-	obj := o.GetVal()
+	return av.bindValue(v, o.GetVal())
+}
+
+// bindValue 将配置值 obj 转换为 v 的类型并赋值, 支持基础类型、指针、切片、数组、map、结构体、
+// time.Duration 和 encoding.TextUnmarshaler(如 time.Time, 格式为RFC3339)
+func (av *AutoValueOfBeanUtil) bindValue(v reflect.Value, obj any) error {
 	if obj == nil {
 		return nil
 	}
-	vKind := v.Type().Kind()
+	vType := v.Type()
+	if vType == objectType {
+		v.Set(reflect.ValueOf(utypes.NewObject(obj)))
+		return nil
+	}
+	if str, ok := obj.(string); ok && reflect.PointerTo(vType).Implements(textUnmarshalerType) {
+		if err := v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(str)); nil != err {
+			return &convertError{val: obj, typ: vType}
+		}
+		return nil
+	}
+
+	vKind := vType.Kind()
 	if vKind == reflect.Int || vKind == reflect.Int8 || vKind == reflect.Int16 || vKind == reflect.Int32 || vKind == reflect.Int64 {
-		v.SetInt(o.ToInt64(0))
+		val, err := toInt64(obj, vType)
+		if nil != err {
+			return err
+		}
+		v.SetInt(val)
 
 	} else if vKind == reflect.Uint || vKind == reflect.Uint8 || vKind == reflect.Uint16 || vKind == reflect.Uint32 || vKind == reflect.Uint64 {
-		v.SetUint(o.ToUint64(0))
+		val, err := toUint64(obj, vType)
+		if nil != err {
+			return err
+		}
+		v.SetUint(val)
 
 	} else if vKind == reflect.Float32 || vKind == reflect.Float64 {
-		v.SetFloat(o.ToFloat64(0))
+		val, err := toFloat64(obj, vType)
+		if nil != err {
+			return err
+		}
+		v.SetFloat(val)
 
 	} else if vKind == reflect.String {
-		v.SetString(o.ToString(""))
+		val, err := toString(obj, vType)
+		if nil != err {
+			return err
+		}
+		v.SetString(val)
 
 	} else if vKind == reflect.Bool {
-		v.SetBool(o.ToBool(false))
+		val, err := toBool(obj, vType)
+		if nil != err {
+			return err
+		}
+		v.SetBool(val)
 
-	} else if vKind == reflect.Map {
-		return newUnsupportedTypeErr(v.Type())
+	} else if vKind == reflect.Ptr {
+		newValue := reflect.New(vType.Elem())
+		if err := av.bindValue(newValue.Elem(), obj); nil != err {
+			return err
+		}
+		v.Set(newValue)
 
-	} else if vKind == reflect.Array {
-		return newUnsupportedTypeErr(v.Type())
+	} else if vKind == reflect.Interface {
+		if val := reflect.ValueOf(obj); val.Type().AssignableTo(vType) {
+			v.Set(val)
+		} else {
+			return &convertError{val: obj, typ: vType}
+		}
 
-	} else if vKind == reflect.Slice {
-		if objType := reflect.TypeOf(obj); objType.Kind() == reflect.Slice {
-			objKind := objType.Elem().Kind()
-			vKind := v.Type().Elem().Kind()
-			if objKind == vKind {
-				v.Set(reflect.ValueOf(obj))
-				return nil
+	} else if vKind == reflect.Slice || vKind == reflect.Array {
+		return av.bindSlice(v, obj)
 
-			} else if objKind == reflect.Interface {
-				return av.setFeildValue4Array(v, obj.([]any))
+	} else if vKind == reflect.Map {
+		return av.bindMap(v, obj)
 
-			}
-		}
 	} else if vKind == reflect.Struct {
-		if v.Type() == reflect.TypeOf(o) {
-			v.Set(reflect.ValueOf(o))
-		} else {
-			return newUnsupportedTypeErr(v.Type())
-		}
+		return av.bindStruct(v, obj)
+
 	} else {
-		return newUnsupportedTypeErr(v.Type())
+		return newUnsupportedTypeErr(vType)
 	}
 	return nil
 }
 
-// setFeildValue4Array 设置字段值-数组类型
-func (av *AutoValueOfBeanUtil) setFeildValue4Array(v reflect.Value, in []any) error {
-	if len(in) == 0 {
-		return nil
+// bindSlice 设置切片或数组, 数组长度不足时返回错误
+func (av *AutoValueOfBeanUtil) bindSlice(v reflect.Value, obj any) error {
+	in := reflect.ValueOf(obj)
+	if in.Kind() != reflect.Slice && in.Kind() != reflect.Array {
+		return &convertError{val: obj, typ: v.Type()}
 	}
-	vType := v.Type().Elem()
-	obj := &utypes.Object{}
-	vKind := vType.Kind()
-	if vKind == reflect.Int {
-		res := make([]int, len(in))
-		for i := 0; i < len(in); i++ {
-			res[i] = obj.SetVal(in[i]).ToInt(0)
-		}
-		v.Set(reflect.ValueOf(res))
-
-	} else if vKind == reflect.Int8 {
-		res := make([]int8, len(in))
-		for i := 0; i < len(in); i++ {
-			res[i] = obj.SetVal(in[i]).ToInt8(0)
-		}
-		v.Set(reflect.ValueOf(res))
-
-	} else if vKind == reflect.Int16 {
-		res := make([]int16, len(in))
-		for i := 0; i < len(in); i++ {
-			res[i] = obj.SetVal(in[i]).ToInt16(0)
-		}
-		v.Set(reflect.ValueOf(res))
-
-	} else if vKind == reflect.Int32 {
-		res := make([]int32, len(in))
-		for i := 0; i < len(in); i++ {
-			res[i] = obj.SetVal(in[i]).ToInt32(0)
-		}
-		v.Set(reflect.ValueOf(res))
-
-	} else if vKind == reflect.Int64 {
-		res := make([]int64, len(in))
-		for i := 0; i < len(in); i++ {
-			res[i] = obj.SetVal(in[i]).ToInt64(0)
-		}
-		v.Set(reflect.ValueOf(res))
-
-	} else if vKind == reflect.Uint {
-		res := make([]uint, len(in))
-		for i := 0; i < len(in); i++ {
-			res[i] = obj.SetVal(in[i]).ToUint(0)
-		}
-		v.Set(reflect.ValueOf(res))
-
-	} else if vKind == reflect.Uint8 {
-		res := make([]uint8, len(in))
-		for i := 0; i < len(in); i++ {
-			res[i] = obj.SetVal(in[i]).ToUint8(0)
-		}
-		v.Set(reflect.ValueOf(res))
-
-	} else if vKind == reflect.Uint16 {
-		res := make([]uint16, len(in))
-		for i := 0; i < len(in); i++ {
-			res[i] = obj.SetVal(in[i]).ToUint16(0)
+	res := v
+	if v.Kind() == reflect.Slice {
+		res = reflect.MakeSlice(v.Type(), in.Len(), in.Len())
+	} else if in.Len() > v.Len() {
+		return &convertError{val: obj, typ: v.Type()}
+	} else {
+		res = reflect.New(v.Type()).Elem()
+	}
+	for i := 0; i < in.Len(); i++ {
+		if err := av.bindValue(res.Index(i), in.Index(i).Interface()); nil != err {
+			return withPath(err, fmt.Sprintf("[%d]", i))
 		}
-		v.Set(reflect.ValueOf(res))
+	}
+	v.Set(res)
+	return nil
+}
 
-	} else if vKind == reflect.Uint32 {
-		res := make([]uint32, len(in))
-		for i := 0; i < len(in); i++ {
-			res[i] = obj.SetVal(in[i]).ToUint32(0)
+// bindMap 设置map, key 可以是字符串或者数字等基础类型
+func (av *AutoValueOfBeanUtil) bindMap(v reflect.Value, obj any) error {
+	in := reflect.ValueOf(obj)
+	if in.Kind() != reflect.Map {
+		return &convertError{val: obj, typ: v.Type()}
+	}
+	vType := v.Type()
+	res := reflect.MakeMapWithSize(vType, in.Len())
+	iter := in.MapRange()
+	for iter.Next() {
+		key := reflect.New(vType.Key()).Elem()
+		if err := av.bindValue(key, iter.Key().Interface()); nil != err {
+			return err
 		}
-		v.Set(reflect.ValueOf(res))
-
-	} else if vKind == reflect.Uint64 {
-		res := make([]uint64, len(in))
-		for i := 0; i < len(in); i++ {
-			res[i] = obj.SetVal(in[i]).ToUint64(0)
+		val := reflect.New(vType.Elem()).Elem()
+		if err := av.bindValue(val, iter.Value().Interface()); nil != err {
+			return withPath(err, fmt.Sprint(iter.Key().Interface()))
 		}
-		v.Set(reflect.ValueOf(res))
+		res.SetMapIndex(key, val)
+	}
+	v.Set(res)
+	return nil
+}
 
-	} else if vKind == reflect.Float32 {
-		res := make([]float32, len(in))
-		for i := 0; i < len(in); i++ {
-			res[i] = obj.SetVal(in[i]).ToFloat32(0)
+// bindStruct 使用 map 设置结构体, 带有@value标签的字段按标签中的路径(含默认值)取值, 其余导出字段按字段名取值(不区分大小写)
+func (av *AutoValueOfBeanUtil) bindStruct(v reflect.Value, obj any) error {
+	in, ok := obj.(map[string]any)
+	if !ok {
+		return &convertError{val: obj, typ: v.Type()}
+	}
+	vType := v.Type()
+	for i := 0; i < vType.NumField(); i++ {
+		configKey, defaultVal, ok := structFieldKey(vType.Field(i))
+		if !ok {
+			continue
 		}
-		v.Set(reflect.ValueOf(res))
 
-	} else if vKind == reflect.Float64 {
-		res := make([]float64, len(in))
-		for i := 0; i < len(in); i++ {
-			res[i] = obj.SetVal(in[i]).ToFloat64(0)
+		val := GetDottedValue(in, configKey)
+		if nil == val {
+			for k, kv := range in {
+				if strings.EqualFold(k, configKey) {
+					val = kv
+					break
+				}
+			}
 		}
-		v.Set(reflect.ValueOf(res))
-
-	} else if vKind == reflect.String {
-		res := make([]string, len(in))
-		for i := 0; i < len(in); i++ {
-			res[i] = obj.SetVal(in[i]).ToString("")
+		if nil == val && len(defaultVal) > 0 {
+			val = defaultVal
 		}
-
-		v.Set(reflect.ValueOf(res))
-
-	} else if vKind == reflect.Bool {
-		res := make([]bool, len(in))
-		for i := 0; i < len(in); i++ {
-			res[i] = obj.SetVal(in[i]).ToBool(false)
+		fv := v.Field(i)
+		if err := av.bindValue(reflect.NewAt(fv.Type(), unsafe.Pointer(fv.UnsafeAddr())).Elem(), val); nil != err {
+			return withPath(err, configKey)
 		}
-
-		v.Set(reflect.ValueOf(res))
-
-	} else if vKind == reflect.Map {
-		return newUnsupportedTypeErr(vType)
-
-	} else if vKind == reflect.Array {
-		return newUnsupportedTypeErr(vType)
-
-	} else if vKind == reflect.Slice {
-		return newUnsupportedTypeErr(vType)
-
-	} else if vKind == reflect.Interface {
-		v.Set(reflect.ValueOf(in))
-
-	} else {
-		return fmt.Errorf("data types that do not support automatic configuration: %s", vType.Name())
 	}
-
 	return nil
 }
 
 // scanAndAutoConfigAnonymous 扫描匿名嵌套类并配置
-func (av *AutoValueOfBeanUtil) scanAndAutoConfigAnonymous(ptr any, cprefix string) (err error) {
+func (av *AutoValueOfBeanUtil) scanAndAutoConfigAnonymous(ptr any, cprefix string, watch bool) (err error) {
 	var fields []reflect.StructField
 	if fields = reflectutil.GetAnonymousOrNoneTypeNameField(ptr); len(fields) == 0 {
 		return
 	}
+	var verrs []ipakku.ConfigFieldError
 	for i := 0; i < len(fields); i++ {
-		if err = av.doConfigField(ptr, cprefix, fields[i].Name); nil != err {
+		if err = collectValidationErr(&verrs, av.doConfigField(ptr, cprefix, fields[i].Name, watch)); nil != err {
 			return
 		}
 	}
-	return
+	return newValidationErr(verrs)
 }
 
 func newUnsupportedTypeErr(k reflect.Type) error {
-	return fmt.Errorf("data types that do not support automatic configuration: %s", k.Name())
+	return fmt.Errorf("data types that do not support automatic configuration: %s", k.String())
 }
+
+var objectType = reflect.TypeOf(utypes.Object{})
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
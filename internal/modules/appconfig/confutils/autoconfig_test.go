@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+package confutils
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type staticPath struct {
+	Path string
+	Dir  string `@value:"dir:./www"`
+}
+
+type bindBean struct {
+	Limits  map[string]int         `@value:"limits"`
+	Groups  map[string]*staticPath `@value:"groups"`
+	Ports   [2]uint16              `@value:"ports"`
+	Static  []staticPath           `@value:"static"`
+	Timeout time.Duration          `@value:"timeout:30s"`
+	Retry   *time.Duration         `@value:"retry"`
+	Expire  time.Time              `@value:"expire"`
+	IP      net.IP                 `@value:"ip"`
+	Name    *string                `@value:"name"`
+}
+
+func TestBindValue(t *testing.T) {
+	config := &mapConfig{data: map[string]any{"app": map[string]any{
+		"limits": map[string]any{"read": json.Number("10"), "write": "5"},
+		"groups": map[string]any{"docs": map[string]any{"path": "/docs", "dir": "./docs"}},
+		"ports":  []any{json.Number("80"), json.Number("443")},
+		"static": []any{
+			map[string]any{"path": "/www"},
+			map[string]any{"Path": "/docs", "dir": "./docs"},
+		},
+		"retry":  "1m30s",
+		"expire": "2024-01-02T03:04:05Z",
+		"ip":     "127.0.0.1",
+		"name":   "pakku",
+	}}}
+	bean := new(bindBean)
+	if err := NewAutoValueOfBeanUtil(config).ScanAndAutoValue("app", bean); nil != err {
+		t.Fatal(err)
+	}
+	if bean.Limits["read"] != 10 || bean.Limits["write"] != 5 {
+		t.Fatalf("limits = %v", bean.Limits)
+	}
+	if g := bean.Groups["docs"]; nil == g || g.Path != "/docs" || g.Dir != "./docs" {
+		t.Fatalf("groups = %v", bean.Groups)
+	}
+	if bean.Ports != [2]uint16{80, 443} {
+		t.Fatalf("ports = %v", bean.Ports)
+	}
+	if len(bean.Static) != 2 || bean.Static[0].Dir != "./www" || bean.Static[1].Path != "/docs" || bean.Static[1].Dir != "./docs" {
+		t.Fatalf("static = %v", bean.Static)
+	}
+	if bean.Timeout != 30*time.Second || nil == bean.Retry || *bean.Retry != 90*time.Second {
+		t.Fatalf("timeout = %v, retry = %v", bean.Timeout, bean.Retry)
+	}
+	if !bean.Expire.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("expire = %v", bean.Expire)
+	}
+	if !bean.IP.Equal(net.IPv4(127, 0, 0, 1)) || nil == bean.Name || *bean.Name != "pakku" {
+		t.Fatalf("ip = %v, name = %v", bean.IP, bean.Name)
+	}
+
+	// 错误中包含值的位置
+	config.data = map[string]any{"app": map[string]any{
+		"static": []any{map[string]any{"path": "/www"}, map[string]any{"path": []any{"x"}}},
+		"ports":  []any{json.Number("1"), json.Number("2"), json.Number("3")},
+	}}
+	err := NewAutoValueOfBeanUtil(config).ScanAndAutoValue("app", new(bindBean))
+	if nil == err || !strings.Contains(err.Error(), "app.static (bindBean.Static): cannot convert '[x]' to string at [1].Path") || !strings.Contains(err.Error(), "app.ports") {
+		t.Fatalf("err = %v", err)
+	}
+}
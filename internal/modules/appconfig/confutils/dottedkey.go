@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 配置工具-a.b.c 形式的key读写
+
+package confutils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ExpandDottedKeys 将 a.b.c 形式的key展开为嵌套map
+func ExpandDottedKeys(in map[string]any) map[string]any {
+	res := make(map[string]any)
+	for key, val := range in {
+		if child, ok := val.(map[string]any); ok {
+			val = ExpandDottedKeys(child)
+		}
+		keys := strings.Split(key, ".")
+		temp := res
+		for i, k := range keys {
+			if i == len(keys)-1 {
+				temp[k] = mergeValue(temp[k], val)
+				break
+			}
+			child, ok := temp[k].(map[string]any)
+			if !ok {
+				child = make(map[string]any)
+				temp[k] = child
+			}
+			temp = child
+		}
+	}
+	return res
+}
+
+// GetDottedValue 按 a.b.c 形式的key读取嵌套map中的值
+func GetDottedValue(in map[string]any, key string) any {
+	if len(in) == 0 || len(key) == 0 {
+		return nil
+	}
+	var temp any = in
+	for _, k := range strings.Split(key, ".") {
+		mval, ok := temp.(map[string]any)
+		if !ok {
+			return nil
+		}
+		if temp, ok = mval[k]; !ok {
+			return nil
+		}
+	}
+	return temp
+}
+
+// SetDottedValue 按 a.b.c 形式的key设置嵌套map中的值, 中间节点不是map时将被覆盖
+func SetDottedValue(in map[string]any, key string, value any) error {
+	if nil == in || len(key) == 0 {
+		return errors.New("map or key is empty")
+	}
+	keys := strings.Split(key, ".")
+	temp := in
+	for i, k := range keys {
+		if i == len(keys)-1 {
+			temp[k] = value
+			break
+		}
+		child, ok := temp[k].(map[string]any)
+		if !ok {
+			child = make(map[string]any)
+			temp[k] = child
+		}
+		temp = child
+	}
+	return nil
+}
+
+// NormalizeValue 将任意值转换为 map[string]any、[]any、json.Number、string、bool、nil 组成的结构
+func NormalizeValue(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if nil != err {
+		return nil, err
+	}
+	var res any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err = decoder.Decode(&res); nil != err {
+		return nil, err
+	}
+	return res, nil
+}
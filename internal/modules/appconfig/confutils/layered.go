@@ -0,0 +1,249 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 配置工具-分层配置
+// 优先级(高->低): 命令行参数(--key=value) > 环境变量(带前缀的优先) > profile配置文件 > 配置文件 > 默认值
+
+package confutils
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/wup364/pakku/ipakku"
+	"github.com/wup364/pakku/pkg/utypes"
+)
+
+// NewLayeredConfig 分层配置, base 为基础配置(写入目标), 默认读取 os.Environ 和 os.Args.
+// 默认仅读取带前缀的环境变量, 未设置前缀(SetEnvPrefix)时不读取环境变量
+func NewLayeredConfig(base ipakku.IConfig) *LayeredConfig {
+	lc := &LayeredConfig{base: base, only: true}
+	lc.SetEnviron(os.Environ())
+	if len(os.Args) > 1 {
+		lc.SetArgs(os.Args[1:])
+	} else {
+		lc.SetArgs(nil)
+	}
+	return lc
+}
+
+// LayeredConfig 分层配置, 按优先级合并多个配置来源
+type LayeredConfig struct {
+	base     ipakku.IConfig
+	profile  ipakku.IConfig
+	defaults map[string]any
+	envs     map[string]string
+	flags    map[string]flagValue
+	prefix   string // 环境变量前缀
+	only     bool   // 仅读取带前缀的环境变量, 默认 true
+}
+
+// flagValue 命令行参数, key 保留原始大小写
+type flagValue struct {
+	key   string
+	value string
+}
+
+// Init 初始化基础配置
+func (lc *LayeredConfig) Init(appName string) error {
+	if nil == lc.base {
+		return errors.New("base config is nil")
+	}
+	return lc.base.Init(appName)
+}
+
+// Base 基础配置, 即写入目标
+func (lc *LayeredConfig) Base() ipakku.IConfig {
+	return lc.base
+}
+
+// SetProfile 设置 profile 配置, 优先级高于基础配置
+func (lc *LayeredConfig) SetProfile(profile ipakku.IConfig) *LayeredConfig {
+	lc.profile = profile
+	return lc
+}
+
+// SetDefaults 设置默认值, 支持 a.b.c 形式的key
+func (lc *LayeredConfig) SetDefaults(defaults map[string]any) *LayeredConfig {
+	lc.defaults = ExpandDottedKeys(defaults)
+	return lc
+}
+
+// SetEnviron 设置环境变量来源, 格式: KEY=VALUE
+func (lc *LayeredConfig) SetEnviron(environ []string) *LayeredConfig {
+	lc.envs = make(map[string]string)
+	for _, kv := range environ {
+		if i := strings.Index(kv, "="); i > 0 {
+			lc.envs[kv[:i]] = kv[i+1:]
+		}
+	}
+	return lc
+}
+
+// SetEnvPrefix 设置环境变量前缀, 如: PAKKU_, 带前缀的环境变量优先于不带前缀的.
+// only 为 true 时仅读取带前缀的环境变量, 避免 PATH、HOME 等系统环境变量覆盖配置, 此时前缀为空则不读取环境变量;
+// only 为 false 时才读取不带前缀的环境变量
+func (lc *LayeredConfig) SetEnvPrefix(prefix string, only bool) *LayeredConfig {
+	lc.prefix, lc.only = prefix, only
+	return lc
+}
+
+// SetArgs 设置命令行参数来源, 仅识别 --key=value 格式, key 不区分大小写
+func (lc *LayeredConfig) SetArgs(args []string) *LayeredConfig {
+	lc.flags = make(map[string]flagValue)
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "--") {
+			continue
+		}
+		if i := strings.Index(arg, "="); i > 2 {
+			key := arg[2:i]
+			lc.flags[strings.ToLower(key)] = flagValue{key: key, value: arg[i+1:]}
+		}
+	}
+	return lc
+}
+
+// GetConfig 读取key的value信息, 返回 Object 对象, 里面的值可能是string或者map
+func (lc *LayeredConfig) GetConfig(key string) (res utypes.Object) {
+	if len(key) == 0 {
+		return
+	}
+	if val, ok := lc.lookupOverride(key); ok {
+		return utypes.NewObject(val)
+	}
+
+	// 从低到高合并文件和默认值
+	var merged any
+	if val := GetDottedValue(lc.defaults, key); nil != val {
+		merged = mergeValue(nil, val)
+	}
+	for _, cfg := range []ipakku.IConfig{lc.base, lc.profile} {
+		if nil == cfg {
+			continue
+		}
+		if val := cfg.GetConfig(key); !val.IsNill() {
+			merged = mergeValue(merged, val.GetVal())
+		}
+	}
+
+	// 环境变量和命令行参数覆盖map的叶子节点
+	if mval, ok := merged.(map[string]any); ok {
+		lc.applyOverrides(key, mval)
+		lc.applyFlagKeys(key, mval)
+	} else if nil == merged {
+		if mval := make(map[string]any); lc.applyFlagKeys(key, mval) {
+			merged = mval
+		}
+	}
+	if nil != merged {
+		res = utypes.NewObject(merged)
+	}
+	return
+}
+
+// SetConfig 设置值, 写入基础配置
+func (lc *LayeredConfig) SetConfig(key string, value any) error {
+	if nil == lc.base {
+		return errors.New("base config is nil")
+	}
+	return lc.base.SetConfig(key, value)
+}
+
+// Reload 重新加载基础配置和 profile 配置, 需实现 ipakku.ConfigReloader
+func (lc *LayeredConfig) Reload() (changed bool, err error) {
+	for _, cfg := range []ipakku.IConfig{lc.base, lc.profile} {
+		if reloader, ok := cfg.(ipakku.ConfigReloader); ok {
+			ok, rerr := reloader.Reload()
+			if changed = changed || ok; nil != rerr && nil == err {
+				err = rerr
+			}
+		}
+	}
+	return
+}
+
+// lookupOverride 从命令行参数和环境变量中查找值
+func (lc *LayeredConfig) lookupOverride(key string) (string, bool) {
+	if fv, ok := lc.flags[strings.ToLower(key)]; ok {
+		return fv.value, true
+	}
+	envKey := EnvKey(key)
+	if len(lc.prefix) > 0 {
+		if val, ok := lc.envs[lc.prefix+envKey]; ok {
+			return val, true
+		}
+	}
+	if !lc.only {
+		if val, ok := lc.envs[envKey]; ok {
+			return val, true
+		}
+	}
+	return "", false
+}
+
+// applyOverrides 使用命令行参数和环境变量覆盖已存在的叶子节点
+func (lc *LayeredConfig) applyOverrides(prefix string, mval map[string]any) {
+	for k, v := range mval {
+		path := prefix + "." + k
+		if child, ok := v.(map[string]any); ok {
+			lc.applyOverrides(path, child)
+		} else if val, ok := lc.lookupOverride(path); ok {
+			mval[k] = val
+		}
+	}
+}
+
+// applyFlagKeys 将以 prefix 开头但配置中不存在的命令行参数加入map
+func (lc *LayeredConfig) applyFlagKeys(prefix string, mval map[string]any) (changed bool) {
+	lprefix := strings.ToLower(prefix) + "."
+	for lkey, fv := range lc.flags {
+		if !strings.HasPrefix(lkey, lprefix) {
+			continue
+		}
+		keys := strings.Split(fv.key[len(lprefix):], ".")
+		temp := mval
+		for i, k := range keys {
+			if i == len(keys)-1 {
+				if _, ok := temp[k]; !ok {
+					temp[k] = fv.value
+					changed = true
+				}
+				break
+			}
+			child, ok := temp[k].(map[string]any)
+			if !ok {
+				if _, exist := temp[k]; exist {
+					break
+				}
+				child = make(map[string]any)
+				temp[k] = child
+			}
+			temp = child
+		}
+	}
+	return
+}
+
+// EnvKey 配置key转换为环境变量名, 如: service.ReadTimeoutSecond -> SERVICE_READTIMEOUTSECOND
+func EnvKey(key string) string {
+	return strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// mergeValue 合并值, 都为map时深度合并(返回新map), 否则 high 覆盖 low
+func mergeValue(low, high any) any {
+	hmap, ok := high.(map[string]any)
+	if !ok {
+		return high
+	}
+	res := make(map[string]any)
+	if lmap, ok := low.(map[string]any); ok {
+		for k, v := range lmap {
+			res[k] = mergeValue(nil, v)
+		}
+	}
+	for k, v := range hmap {
+		res[k] = mergeValue(res[k], v)
+	}
+	return res
+}
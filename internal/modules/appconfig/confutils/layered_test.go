@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+package confutils
+
+import (
+	"testing"
+
+	"github.com/wup364/pakku/pkg/utypes"
+)
+
+// mapConfig 内存配置
+type mapConfig struct {
+	data map[string]any
+}
+
+func (c *mapConfig) Init(appName string) error {
+	return nil
+}
+
+func (c *mapConfig) GetConfig(key string) utypes.Object {
+	if val := GetDottedValue(c.data, key); nil != val {
+		return utypes.NewObject(val)
+	}
+	return utypes.Object{}
+}
+
+func (c *mapConfig) SetConfig(key string, value any) error {
+	c.data = mergeValue(c.data, ExpandDottedKeys(map[string]any{key: value})).(map[string]any)
+	return nil
+}
+
+func TestLayeredConfig(t *testing.T) {
+	base := &mapConfig{data: map[string]any{
+		"service": map[string]any{"ReadTimeoutSecond": 10, "Addr": ":8080"},
+		"name":    "base",
+	}}
+	profile := &mapConfig{data: map[string]any{
+		"service": map[string]any{"Addr": ":9090"},
+	}}
+	lc := NewLayeredConfig(base).
+		SetProfile(profile).
+		SetDefaults(map[string]any{"service.WriteTimeoutSecond": 30, "name": "default"}).
+		SetEnviron([]string{"MYAPP_SERVICE_READTIMEOUTSECOND=60"}).
+		SetEnvPrefix("MYAPP_", true).
+		SetArgs([]string{"--service.addr=:7070", "--service.extra.flag=true", "-v", "--bad"})
+
+	if val := lc.GetConfig("name").ToString(""); val != "base" {
+		t.Fatalf("name = %s", val)
+	}
+	if val := lc.GetConfig("service.WriteTimeoutSecond").ToInt(0); val != 30 {
+		t.Fatalf("service.WriteTimeoutSecond = %d", val)
+	}
+	if val := lc.GetConfig("service.ReadTimeoutSecond").ToInt(0); val != 60 {
+		t.Fatalf("service.ReadTimeoutSecond = %d", val)
+	}
+	if val := lc.GetConfig("service.Addr").ToString(""); val != ":7070" {
+		t.Fatalf("service.Addr = %s", val)
+	}
+
+	service := lc.GetConfig("service").ToStrMap(nil)
+	if service["Addr"] != ":7070" || service["ReadTimeoutSecond"] != "60" || service["WriteTimeoutSecond"] != 30 {
+		t.Fatalf("service = %v", service)
+	}
+	if extra, ok := service["extra"].(map[string]any); !ok || extra["flag"] != "true" {
+		t.Fatalf("service.extra = %v", service["extra"])
+	}
+	// 合并结果不能修改原配置
+	if base.data["service"].(map[string]any)["ReadTimeoutSecond"] != 10 {
+		t.Fatal("base config was modified")
+	}
+
+	// 写入基础配置, profile 优先级更高
+	if err := lc.SetConfig("service.Addr", ":6060"); nil != err {
+		t.Fatal(err)
+	}
+	if val := base.GetConfig("service.Addr").ToString(""); val != ":6060" {
+		t.Fatalf("base service.Addr = %s", val)
+	}
+	if val := lc.SetArgs(nil).GetConfig("service.Addr").ToString(""); val != ":9090" {
+		t.Fatalf("service.Addr = %s", val)
+	}
+}
+
+func TestLayeredConfigEnvPrefix(t *testing.T) {
+	base := &mapConfig{data: map[string]any{"path": "/data", "name": "base"}}
+	lc := NewLayeredConfig(base).
+		SetEnviron([]string{"PATH=/usr/bin", "NAME=env", "MYAPP_NAME=prefixed"}).
+		SetArgs(nil)
+
+	// 默认不读取不带前缀的环境变量
+	if val := lc.GetConfig("path").ToString(""); val != "/data" {
+		t.Fatalf("path = %s", val)
+	}
+	if val := lc.GetConfig("name").ToString(""); val != "base" {
+		t.Fatalf("name = %s", val)
+	}
+
+	// 显式启用不带前缀的环境变量, 带前缀的环境变量优先
+	lc.SetEnvPrefix("MYAPP_", false)
+	if val := lc.GetConfig("name").ToString(""); val != "prefixed" {
+		t.Fatalf("name = %s", val)
+	}
+	if val := lc.GetConfig("path").ToString(""); val != "/usr/bin" {
+		t.Fatalf("path = %s", val)
+	}
+
+	// 仅读取带前缀的环境变量, 系统环境变量不覆盖配置
+	lc.SetEnvPrefix("MYAPP_", true)
+	if val := lc.GetConfig("path").ToString(""); val != "/data" {
+		t.Fatalf("path = %s", val)
+	}
+	if val := lc.GetConfig("name").ToString(""); val != "prefixed" {
+		t.Fatalf("name = %s", val)
+	}
+}
@@ -0,0 +1,320 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 配置工具-配置key记录
+// 记录读取过的配置key, 用于导出 JSON Schema 和示例配置
+
+package confutils
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/wup364/pakku/ipakku"
+)
+
+// NewConfigKeyRecorder 配置key记录器
+func NewConfigKeyRecorder() *ConfigKeyRecorder {
+	return &ConfigKeyRecorder{keys: make(map[string]*configKey), l: new(sync.RWMutex)}
+}
+
+// ConfigKeyRecorder 配置key记录器
+type ConfigKeyRecorder struct {
+	keys map[string]*configKey
+	l    *sync.RWMutex
+}
+
+// configKey 配置key
+type configKey struct {
+	info ipakku.ConfigKeyInfo
+	typ  reflect.Type
+}
+
+// Has 是否已记录
+func (r *ConfigKeyRecorder) Has(key string) bool {
+	r.l.RLock()
+	defer r.l.RUnlock()
+	_, ok := r.keys[key]
+	return ok
+}
+
+// Record 记录配置key, typ 为空表示类型未知, 已记录过类型时不会被覆盖
+func (r *ConfigKeyRecorder) Record(key string, typ reflect.Type, defaultVal, owner, valid string) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	if old, ok := r.keys[key]; ok && (nil == typ || nil != old.typ) {
+		return
+	}
+	info := ipakku.ConfigKeyInfo{Key: key, Default: defaultVal, Owner: owner, Valid: valid}
+	if nil != typ {
+		info.Type = typ.String()
+	}
+	r.keys[key] = &configKey{info: info, typ: typ}
+}
+
+// Keys 已记录的配置key, 按key排序
+func (r *ConfigKeyRecorder) Keys() []ipakku.ConfigKeyInfo {
+	keys := r.sortedKeys()
+	res := make([]ipakku.ConfigKeyInfo, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, k.info)
+	}
+	return res
+}
+
+// JSONSchema 生成 JSON Schema(draft-07), @valid 规则转为对应的约束
+func (r *ConfigKeyRecorder) JSONSchema() map[string]any {
+	root := map[string]any{"$schema": "http://json-schema.org/draft-07/schema#", "type": "object", "properties": map[string]any{}}
+	for _, k := range r.sortedKeys() {
+		keys := strings.Split(k.info.Key, ".")
+		parent := root
+		for _, name := range keys[:len(keys)-1] {
+			parent = schemaProperty(parent, name)
+		}
+
+		schema := typeSchema(k.typ, make(map[reflect.Type]bool))
+		if len(k.info.Owner) > 0 {
+			schema["description"] = k.info.Owner
+		}
+		if len(k.info.Default) > 0 {
+			schema["default"] = parseDefault(k.typ, k.info.Default)
+		}
+		if rules, err := parseValidRules(k.info.Valid); nil == err {
+			for _, rule := range rules {
+				if rule.name == "required" {
+					required, _ := parent["required"].([]string)
+					parent["required"] = append(required, keys[len(keys)-1])
+				}
+			}
+			applyValidRules(schema, rules)
+		}
+		if old, ok := parent["properties"].(map[string]any)[keys[len(keys)-1]].(map[string]any); ok && nil != old["properties"] {
+			// 已有子key时保留其子节点
+			schema["properties"] = old["properties"]
+		}
+		parent["properties"].(map[string]any)[keys[len(keys)-1]] = schema
+	}
+	return root
+}
+
+// SampleConfig 生成示例配置, 值为默认值或类型的零值
+func (r *ConfigKeyRecorder) SampleConfig() map[string]any {
+	res := make(map[string]any)
+	for _, k := range r.sortedKeys() {
+		var val any
+		if len(k.info.Default) > 0 {
+			val = parseDefault(k.typ, k.info.Default)
+		} else {
+			val = sampleValue(k.typ, make(map[reflect.Type]bool))
+		}
+		// 按key排序后上级先写入, 上级不是map时被子key覆盖
+		SetDottedValue(res, k.info.Key, val)
+	}
+	return res
+}
+
+// sortedKeys 按key排序
+func (r *ConfigKeyRecorder) sortedKeys() []*configKey {
+	r.l.RLock()
+	defer r.l.RUnlock()
+	res := make([]*configKey, 0, len(r.keys))
+	for _, k := range r.keys {
+		res = append(res, k)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].info.Key < res[j].info.Key
+	})
+	return res
+}
+
+// schemaProperty 获取或创建 object 类型的子节点
+func schemaProperty(parent map[string]any, name string) map[string]any {
+	props, ok := parent["properties"].(map[string]any)
+	if !ok {
+		props = make(map[string]any)
+		parent["properties"] = props
+		parent["type"] = "object"
+	}
+	child, ok := props[name].(map[string]any)
+	if !ok {
+		child = map[string]any{"type": "object"}
+		props[name] = child
+	}
+	if _, ok := child["properties"].(map[string]any); !ok {
+		child["properties"] = make(map[string]any)
+	}
+	return child
+}
+
+// typeSchema 根据Go类型生成 schema, 类型未知时不做限制. seen 用于避免结构体循环引用
+func typeSchema(typ reflect.Type, seen map[reflect.Type]bool) map[string]any {
+	if nil == typ {
+		return map[string]any{}
+	}
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch {
+	case typ == durationType:
+		return map[string]any{"type": []string{"string", "integer"}}
+	case typ == objectType:
+		return map[string]any{}
+	case reflect.PointerTo(typ).Implements(textUnmarshalerType):
+		return map[string]any{"type": "string"}
+	}
+
+	switch typ.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": typeSchema(typ.Elem(), seen)}
+	case reflect.Array:
+		return map[string]any{"type": "array", "items": typeSchema(typ.Elem(), seen), "maxItems": typ.Len()}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(typ.Elem(), seen)}
+	case reflect.Struct:
+		if seen[typ] {
+			return map[string]any{"type": "object"}
+		}
+		seen[typ] = true
+		defer delete(seen, typ)
+		props := make(map[string]any)
+		for i := 0; i < typ.NumField(); i++ {
+			if name, _, ok := structFieldKey(typ.Field(i)); ok {
+				props[name] = typeSchema(typ.Field(i).Type, seen)
+			}
+		}
+		return map[string]any{"type": "object", "properties": props}
+	}
+	return map[string]any{}
+}
+
+// rangeKeywords 各类型 min/max 对应的 schema 约束
+var rangeKeywords = map[string][2]string{
+	"integer": {"minimum", "maximum"},
+	"number":  {"minimum", "maximum"},
+	"string":  {"minLength", "maxLength"},
+	"array":   {"minItems", "maxItems"},
+	"object":  {"minProperties", "maxProperties"},
+}
+
+// applyValidRules 将 @valid 规则转为 schema 约束
+func applyValidRules(schema map[string]any, rules []validRule) {
+	for _, rule := range rules {
+		switch rule.name {
+		case "min", "max":
+			limit, err := strconv.ParseFloat(rule.arg, 64)
+			if nil != err {
+				continue
+			}
+			// 多个类型(如 time.Duration 可为字符串或整数)时无法对应到同一个约束, 不做转换
+			typ, _ := schema["type"].(string)
+			if keywords, ok := rangeKeywords[typ]; ok {
+				if rule.name == "min" {
+					schema[keywords[0]] = limit
+				} else {
+					schema[keywords[1]] = limit
+				}
+			}
+		case "oneof":
+			schema["enum"] = strings.Split(rule.arg, "|")
+		case "regex":
+			schema["pattern"] = rule.arg
+		}
+	}
+}
+
+// sampleValue 类型的零值, 结构体按字段展开. seen 用于避免结构体循环引用
+func sampleValue(typ reflect.Type, seen map[reflect.Type]bool) any {
+	if nil == typ {
+		return nil
+	}
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch {
+	case typ == durationType:
+		return "0s"
+	case typ == objectType:
+		return nil
+	case reflect.PointerTo(typ).Implements(textUnmarshalerType):
+		return ""
+	}
+	switch typ.Kind() {
+	case reflect.Slice, reflect.Array:
+		return []any{}
+	case reflect.Map:
+		return map[string]any{}
+	case reflect.Struct:
+		if seen[typ] {
+			return nil
+		}
+		seen[typ] = true
+		defer delete(seen, typ)
+		res := make(map[string]any)
+		for i := 0; i < typ.NumField(); i++ {
+			if name, defaultVal, ok := structFieldKey(typ.Field(i)); ok {
+				if len(defaultVal) > 0 {
+					res[name] = parseDefault(typ.Field(i).Type, defaultVal)
+				} else {
+					res[name] = sampleValue(typ.Field(i).Type, seen)
+				}
+			}
+		}
+		return res
+	case reflect.Interface, reflect.Chan, reflect.Func:
+		return nil
+	}
+	return reflect.Zero(typ).Interface()
+}
+
+// parseDefault 按类型转换默认值, 无法转换时返回字符串
+func parseDefault(typ reflect.Type, val string) any {
+	if nil == typ || typ == durationType {
+		return val
+	}
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Bool:
+		if res, err := strconv.ParseBool(val); nil == err {
+			return res
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if res, err := strconv.ParseInt(val, 10, 64); nil == err {
+			return res
+		}
+	case reflect.Float32, reflect.Float64:
+		if res, err := strconv.ParseFloat(val, 64); nil == err {
+			return res
+		}
+	}
+	return val
+}
+
+// structFieldKey 结构体字段对应的配置key, 规则同 bindStruct
+func structFieldKey(field reflect.StructField) (key, defaultVal string, ok bool) {
+	key = field.Name
+	if confPath, tagged := field.Tag.Lookup(ipakku.STAG_CONFIG_VALUE); tagged || string(field.Tag) == ipakku.STAG_CONFIG_VALUE {
+		if dfValIndex := strings.Index(confPath, ":"); dfValIndex > -1 {
+			confPath, defaultVal = confPath[:dfValIndex], strings.TrimSpace(confPath[dfValIndex+1:])
+		}
+		if len(confPath) > 0 {
+			key = confPath
+		}
+		return key, defaultVal, true
+	}
+	return key, "", field.IsExported() && !field.Anonymous
+}
@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+package confutils
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type schemaBean struct {
+	Addr    string        `@value:"addr:127.0.0.1:8080" @valid:"required,max=64"`
+	Mode    string        `@value:"mode" @valid:"oneof=dev|prod"`
+	Workers int           `@value:"workers:4" @valid:"min=1"`
+	Timeout time.Duration `@value:"timeout:30s" @valid:"min=0,max=1m"`
+	Static  []staticPath  `@value:"static"`
+	Tags    map[string]string
+}
+
+type schemaModule struct {
+	service *schemaBean `@autoConfig:"service"`
+}
+
+func TestConfigKeyRecorder(t *testing.T) {
+	recorder := NewConfigKeyRecorder()
+	config := &mapConfig{data: map[string]any{}}
+	if err := NewAutoValueOfBeanUtil(config).SetKeyRecorder(recorder).ScanAndAutoConfig(new(schemaModule)); nil != err {
+		t.Fatal(err)
+	}
+	recorder.Record("debug", nil, "", "main.main", "")
+	recorder.Record("service.workers", nil, "", "main.main", "")
+
+	keys := recorder.Keys()
+	if len(keys) != 6 || keys[0].Key != "debug" || keys[4].Key != "service.timeout" {
+		t.Fatalf("keys = %v", keys)
+	}
+	if k := keys[5]; k.Type != "int" || k.Default != "4" || k.Owner != "confutils.schemaBean.Workers" || k.Valid != "min=1" {
+		t.Fatalf("workers = %v", k)
+	}
+
+	data, err := json.Marshal(recorder.JSONSchema())
+	if nil != err {
+		t.Fatal(err)
+	}
+	var schema map[string]any
+	json.Unmarshal(data, &schema)
+	service := schema["properties"].(map[string]any)["service"].(map[string]any)
+	props := service["properties"].(map[string]any)
+	if !reflect.DeepEqual(service["required"], []any{"addr"}) {
+		t.Fatalf("required = %v", service["required"])
+	}
+	if addr := props["addr"].(map[string]any); addr["type"] != "string" || addr["maxLength"] != 64.0 || addr["default"] != "127.0.0.1:8080" {
+		t.Fatalf("addr = %v", addr)
+	}
+	if mode := props["mode"].(map[string]any); !reflect.DeepEqual(mode["enum"], []any{"dev", "prod"}) {
+		t.Fatalf("mode = %v", mode)
+	}
+	if workers := props["workers"].(map[string]any); workers["type"] != "integer" || workers["minimum"] != 1.0 || workers["default"] != 4.0 {
+		t.Fatalf("workers = %v", workers)
+	}
+	if timeout := props["timeout"].(map[string]any); nil != timeout["minimum"] || nil != timeout["minLength"] {
+		t.Fatalf("timeout = %v", timeout)
+	}
+	if static := props["static"].(map[string]any); static["type"] != "array" || nil == static["items"].(map[string]any)["properties"].(map[string]any)["dir"] {
+		t.Fatalf("static = %v", static)
+	}
+
+	sample := recorder.SampleConfig()
+	expect := map[string]any{"debug": nil, "service": map[string]any{
+		"addr": "127.0.0.1:8080", "mode": "", "workers": int64(4), "timeout": "30s", "static": []any{},
+	}}
+	if !reflect.DeepEqual(sample, expect) {
+		t.Fatalf("sample = %v", sample)
+	}
+}
@@ -0,0 +1,221 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 配置工具-加密配置
+// 配置值为 ENC(base64(nonce+密文)) 形式时, 读取时使用 AES-GCM 解密
+
+package confutils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/wup364/pakku/ipakku"
+	"github.com/wup364/pakku/pkg/fileutil"
+	"github.com/wup364/pakku/pkg/logs"
+	"github.com/wup364/pakku/pkg/utypes"
+)
+
+// ErrNoSecretKey 未配置加密密钥
+var ErrNoSecretKey = errors.New("config secret key is not set, use env " + ipakku.ENV_KEY_CONFIG_KEY + " or a key file")
+
+// LoadSecretKey 加载密钥, 优先读取环境变量 PAKKU_CONFIG_KEY, 其次读取密钥文件. 均不存在时返回 nil
+func LoadSecretKey(keyFile string) ([]byte, error) {
+	if key := os.Getenv(ipakku.ENV_KEY_CONFIG_KEY); len(key) > 0 {
+		return ParseSecretKey(key)
+	}
+	if path := os.Getenv(ipakku.ENV_KEY_CONFIG_KEY_FILE); len(path) > 0 {
+		keyFile = path
+	}
+	if len(keyFile) == 0 || !fileutil.IsFile(keyFile) {
+		return nil, nil
+	}
+	data, err := os.ReadFile(keyFile)
+	if nil != err {
+		return nil, err
+	}
+	return ParseSecretKey(string(data))
+}
+
+// ParseSecretKey 解析base64编码的密钥, 长度需为16/24/32字节
+func ParseSecretKey(key string) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(key))
+	if nil != err {
+		return nil, fmt.Errorf("config secret key is not base64 encoded: %s", err.Error())
+	}
+	if n := len(data); n != 16 && n != 24 && n != 32 {
+		return nil, fmt.Errorf("config secret key must be 16, 24 or 32 bytes, got %d", n)
+	}
+	return data, nil
+}
+
+// NewSecretConfig 解密配置中 ENC(...) 形式的值, key 为空时读取到加密的值将报错
+func NewSecretConfig(config ipakku.IConfig, key []byte) (*SecretConfig, error) {
+	sc := &SecretConfig{config: config}
+	if len(key) > 0 {
+		block, err := aes.NewCipher(key)
+		if nil != err {
+			return nil, err
+		}
+		if sc.aead, err = cipher.NewGCM(block); nil != err {
+			return nil, err
+		}
+	}
+	return sc, nil
+}
+
+// SecretConfig 加密配置
+type SecretConfig struct {
+	config ipakku.IConfig
+	aead   cipher.AEAD
+}
+
+// Init 初始化
+func (sc *SecretConfig) Init(appName string) error {
+	return sc.config.Init(appName)
+}
+
+// Reload 重新加载被包装的配置
+func (sc *SecretConfig) Reload() (bool, error) {
+	if reloader, ok := sc.config.(ipakku.ConfigReloader); ok {
+		return reloader.Reload()
+	}
+	return false, nil
+}
+
+// GetConfig 读取配置, 并解密其中 ENC(...) 形式的值. 解密失败时记录日志并返回空对象, 需要处理错误时使用 GetConfigE
+func (sc *SecretConfig) GetConfig(key string) utypes.Object {
+	res, err := sc.GetConfigE(key)
+	if nil != err {
+		logs.Error(err)
+	}
+	return res
+}
+
+// GetConfigE 读取配置, 并解密其中 ENC(...) 形式的值. 解密失败(如: 缺少密钥、密钥错误、密文损坏)时返回错误
+func (sc *SecretConfig) GetConfigE(key string) (res utypes.Object, err error) {
+	if res = sc.config.GetConfig(key); res.IsNill() {
+		return
+	}
+	var val any
+	if val, err = sc.decryptValue(res.GetVal()); nil != err {
+		return utypes.Object{}, fmt.Errorf("decrypt config '%s' failed: %s", key, err.Error())
+	}
+	return utypes.NewObject(val), nil
+}
+
+// SetConfig 保存配置
+func (sc *SecretConfig) SetConfig(key string, value any) error {
+	return sc.config.SetConfig(key, value)
+}
+
+// Encrypt 加密, 返回 ENC(...) 形式的密文
+func (sc *SecretConfig) Encrypt(plain string) (string, error) {
+	if nil == sc.aead {
+		return "", ErrNoSecretKey
+	}
+	nonce := make([]byte, sc.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); nil != err {
+		return "", err
+	}
+	data := sc.aead.Seal(nonce, nonce, []byte(plain), nil)
+	return "ENC(" + base64.StdEncoding.EncodeToString(data) + ")", nil
+}
+
+// Decrypt 解密 ENC(...) 形式的密文, 非密文原样返回
+func (sc *SecretConfig) Decrypt(val string) (string, error) {
+	if !IsEncrypted(val) {
+		return val, nil
+	}
+	if nil == sc.aead {
+		return "", ErrNoSecretKey
+	}
+	data, err := base64.StdEncoding.DecodeString(val[4 : len(val)-1])
+	if nil != err {
+		return "", err
+	}
+	if len(data) < sc.aead.NonceSize() {
+		return "", errors.New("encrypted value is too short")
+	}
+	nonce, data := data[:sc.aead.NonceSize()], data[sc.aead.NonceSize():]
+	plain, err := sc.aead.Open(nil, nonce, data, nil)
+	if nil != err {
+		return "", err
+	}
+	return string(plain), nil
+}
+
+// baseConfig 由分层配置实现, 返回写入目标的基础配置
+type baseConfig interface {
+	Base() ipakku.IConfig
+}
+
+// EncryptConfig 加密 key 的明文值并回写, 已加密时不做处理.
+// 分层配置时从基础配置读取明文, 值被环境变量、命令行参数或 profile 覆盖时拒绝加密, 避免将覆盖值写入基础配置
+func (sc *SecretConfig) EncryptConfig(key string) error {
+	val := sc.config.GetConfig(key)
+	if layered, ok := sc.config.(baseConfig); ok {
+		base := layered.Base().GetConfig(key)
+		if !val.IsNill() && !reflect.DeepEqual(base.GetVal(), val.GetVal()) {
+			return fmt.Errorf("config '%s' is overridden by env, args or profile, encrypt it in the base config", key)
+		}
+		val = base
+	}
+	if val.IsNill() {
+		return fmt.Errorf("config '%s' does not exist", key)
+	}
+	plain, ok := val.GetVal().(string)
+	if !ok {
+		return fmt.Errorf("config '%s' is not a string", key)
+	}
+	if IsEncrypted(plain) {
+		return nil
+	}
+	enc, err := sc.Encrypt(plain)
+	if nil != err {
+		return err
+	}
+	return sc.config.SetConfig(key, enc)
+}
+
+// decryptValue 解密值, map 和切片中的值逐个解密, 有加密值时返回副本
+func (sc *SecretConfig) decryptValue(val any) (any, error) {
+	switch v := val.(type) {
+	case string:
+		return sc.Decrypt(v)
+	case map[string]any:
+		res := make(map[string]any, len(v))
+		for k, item := range v {
+			dec, err := sc.decryptValue(item)
+			if nil != err {
+				return nil, fmt.Errorf("%s: %s", k, err.Error())
+			}
+			res[k] = dec
+		}
+		return res, nil
+	case []any:
+		res := make([]any, len(v))
+		for i, item := range v {
+			dec, err := sc.decryptValue(item)
+			if nil != err {
+				return nil, fmt.Errorf("[%d]: %s", i, err.Error())
+			}
+			res[i] = dec
+		}
+		return res, nil
+	}
+	return val, nil
+}
+
+// IsEncrypted 是否为 ENC(...) 形式的密文
+func IsEncrypted(val string) bool {
+	return strings.HasPrefix(val, "ENC(") && strings.HasSuffix(val, ")")
+}
@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+package confutils
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wup364/pakku/ipakku"
+)
+
+type secretBean struct {
+	User     string   `@value:"user"`
+	Password string   `@value:"password"`
+	Tokens   []string `@value:"tokens"`
+}
+
+func TestSecretConfig(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "app.key")
+	if err := os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))+"\n"), 0600); nil != err {
+		t.Fatal(err)
+	}
+	t.Setenv(ipakku.ENV_KEY_CONFIG_KEY, "")
+	key, err := LoadSecretKey(keyFile)
+	if nil != err || len(key) != 32 {
+		t.Fatalf("key = %v, err = %v", key, err)
+	}
+
+	base := &mapConfig{data: map[string]any{"db": map[string]any{"user": "root", "password": "123456"}}}
+	config, err := NewSecretConfig(base, key)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if err = config.EncryptConfig("db.password"); nil != err {
+		t.Fatal(err)
+	}
+	enc := base.GetConfig("db.password").ToString("")
+	if !IsEncrypted(enc) {
+		t.Fatalf("db.password = %s", enc)
+	}
+	token, err := config.Encrypt("token")
+	if nil != err {
+		t.Fatal(err)
+	}
+	base.SetConfig("db.tokens", []any{token, "plain"})
+
+	// 读取和自动配置时解密
+	if val := config.GetConfig("db.password").ToString(""); val != "123456" {
+		t.Fatalf("db.password = %s", val)
+	}
+	bean := new(secretBean)
+	if err = NewAutoValueOfBeanUtil(config).ScanAndAutoValue("db", bean); nil != err {
+		t.Fatal(err)
+	}
+	if bean.User != "root" || bean.Password != "123456" || len(bean.Tokens) != 2 || bean.Tokens[0] != "token" || bean.Tokens[1] != "plain" {
+		t.Fatalf("bean = %v", bean)
+	}
+
+	// 没有密钥或密钥错误时无法读取
+	noKey, _ := NewSecretConfig(base, nil)
+	if val := noKey.GetConfig("db.password"); !val.IsNill() {
+		t.Fatalf("db.password = %v", val.GetVal())
+	}
+	otherKey, _ := NewSecretConfig(base, []byte("fedcba9876543210"))
+	if _, err = otherKey.Decrypt(enc); nil == err {
+		t.Fatal("decrypt with another key should fail")
+	}
+
+	// 解密失败时自动配置失败, 不绑定空值
+	for _, sc := range []*SecretConfig{noKey, otherKey} {
+		bean = new(secretBean)
+		if err = NewAutoValueOfBeanUtil(sc).ScanAndAutoValue("db", bean); nil == err || !strings.Contains(err.Error(), "decrypt config 'db.") {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if _, err = noKey.GetConfigE("db"); nil == err || !strings.Contains(err.Error(), ErrNoSecretKey.Error()) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err = ParseSecretKey("c2hvcnQ="); nil == err {
+		t.Fatal("short key should fail")
+	}
+}
+
+func TestSecretConfigLayered(t *testing.T) {
+	base := &mapConfig{data: map[string]any{"db": map[string]any{"user": "root", "password": "123456"}}}
+	profile := &mapConfig{data: map[string]any{"db": map[string]any{"user": "admin"}}}
+	layered := NewLayeredConfig(base).SetProfile(profile).SetEnviron([]string{"MYAPP_DB_TOKEN=env-token"}).SetEnvPrefix("MYAPP_", true).SetArgs(nil)
+	config, err := NewSecretConfig(layered, []byte("0123456789abcdef"))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// 被 profile 或环境变量覆盖的值不能加密回写
+	for _, key := range []string{"db.user", "db.token"} {
+		if err = config.EncryptConfig(key); nil == err {
+			t.Fatalf("%s should not be encrypted", key)
+		}
+	}
+	if val := base.GetConfig("db.user").ToString(""); val != "root" || !base.GetConfig("db.token").IsNill() {
+		t.Fatalf("base config was modified: %v", base.data)
+	}
+
+	// 未被覆盖的值从基础配置读取明文
+	if err = config.EncryptConfig("db.password"); nil != err {
+		t.Fatal(err)
+	}
+	if enc := base.GetConfig("db.password").ToString(""); !IsEncrypted(enc) {
+		t.Fatalf("db.password = %s", enc)
+	}
+	if val := config.GetConfig("db.password").ToString(""); val != "123456" {
+		t.Fatalf("db.password = %s", val)
+	}
+}
@@ -0,0 +1,342 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 配置工具-字段校验
+// 标签格式: @valid:"required,min=1,max=100,oneof=a|b|c,duration,regex=^[a-z]+$"
+// regex 需放在最后, 其后的内容均作为正则表达式
+
+package confutils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/wup364/pakku/ipakku"
+	"github.com/wup364/pakku/pkg/utypes"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// validRule 校验规则
+type validRule struct {
+	name string
+	arg  string
+	reg  *regexp.Regexp
+}
+
+// parseValidRules 解析 @valid 标签
+func parseValidRules(tagval string) (rules []validRule, err error) {
+	for len(tagval) > 0 {
+		var item string
+		if strings.HasPrefix(tagval, "regex=") {
+			item, tagval = tagval, ""
+		} else if index := strings.Index(tagval, ","); index > -1 {
+			item, tagval = tagval[:index], tagval[index+1:]
+		} else {
+			item, tagval = tagval, ""
+		}
+		if item = strings.TrimSpace(item); len(item) == 0 {
+			continue
+		}
+
+		rule := validRule{name: item}
+		if index := strings.Index(item, "="); index > -1 {
+			rule.name, rule.arg = item[:index], item[index+1:]
+		}
+		switch rule.name {
+		case "required", "duration":
+		case "min", "max", "oneof":
+			if len(rule.arg) == 0 {
+				return nil, fmt.Errorf("rule '%s' requires an argument", rule.name)
+			}
+		case "regex":
+			if rule.reg, err = regexp.Compile(rule.arg); nil != err {
+				return nil, fmt.Errorf("rule 'regex' is invalid: %s", err.Error())
+			}
+		default:
+			return nil, fmt.Errorf("unknown rule '%s'", rule.name)
+		}
+		rules = append(rules, rule)
+	}
+	return
+}
+
+// validateFieldValue 校验已赋值的字段, raw 为配置值(含默认值), 返回所有不通过的原因
+func validateFieldValue(tagval string, raw utypes.Object, v reflect.Value) (reasons []string) {
+	rules, err := parseValidRules(tagval)
+	if nil != err {
+		return []string{err.Error()}
+	}
+	for _, rule := range rules {
+		if rule.name == "required" {
+			if raw.IsNill() || (v.Kind() == reflect.String && len(v.String()) == 0) {
+				return []string{"is required"}
+			}
+		}
+	}
+	if raw.IsNill() {
+		return
+	}
+
+	for _, rule := range rules {
+		var reason string
+		switch rule.name {
+		case "min", "max":
+			reason = validateRange(rule, v)
+		case "oneof":
+			val := fmt.Sprint(v.Interface())
+			if opts := strings.Split(rule.arg, "|"); !containsString(opts, val) {
+				reason = fmt.Sprintf("'%s' is not one of [%s]", val, strings.Join(opts, ", "))
+			}
+		case "duration":
+			if str, ok := raw.GetVal().(string); ok {
+				if _, err := time.ParseDuration(str); nil != err {
+					reason = fmt.Sprintf("'%s' is not a valid duration", str)
+				}
+			} else if v.Type() != durationType {
+				reason = fmt.Sprintf("'%v' is not a valid duration", raw.GetVal())
+			}
+		case "regex":
+			if val := fmt.Sprint(v.Interface()); !rule.reg.MatchString(val) {
+				reason = fmt.Sprintf("'%s' does not match '%s'", val, rule.arg)
+			}
+		}
+		if len(reason) > 0 {
+			reasons = append(reasons, reason)
+		}
+	}
+	return
+}
+
+// validateRange 校验 min/max, 数字比较值, 字符串比较长度, 切片/map比较元素个数, time.Duration 比较时长
+func validateRange(rule validRule, v reflect.Value) string {
+	var val, limit float64
+	var err error
+	var what = "value"
+	switch {
+	case v.Type() == durationType:
+		var d time.Duration
+		if d, err = time.ParseDuration(rule.arg); nil == err {
+			val, limit = float64(v.Int()), float64(d)
+		}
+	case v.CanInt():
+		val = float64(v.Int())
+	case v.CanUint():
+		val = float64(v.Uint())
+	case v.CanFloat():
+		val = v.Float()
+	case v.Kind() == reflect.String:
+		val, what = float64(utf8.RuneCountInString(v.String())), "length"
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Map || v.Kind() == reflect.Array:
+		val, what = float64(v.Len()), "length"
+	default:
+		return fmt.Sprintf("rule '%s' is not supported for %s", rule.name, v.Type().String())
+	}
+	if v.Type() != durationType {
+		limit, err = strconv.ParseFloat(rule.arg, 64)
+	}
+	if nil != err {
+		return fmt.Sprintf("rule '%s' has an invalid argument '%s'", rule.name, rule.arg)
+	}
+	if rule.name == "min" && val < limit {
+		return fmt.Sprintf("%s must be >= %s", what, rule.arg)
+	}
+	if rule.name == "max" && val > limit {
+		return fmt.Sprintf("%s must be <= %s", what, rule.arg)
+	}
+	return ""
+}
+
+// convertError 配置值无法转换为字段类型, path 为值在配置中的相对位置, 如: [0].port
+type convertError struct {
+	val  any
+	typ  reflect.Type
+	path string
+}
+
+func (e *convertError) Error() string {
+	if len(e.path) > 0 {
+		return fmt.Sprintf("cannot convert '%v' to %s at %s", e.val, e.typ.String(), e.path)
+	}
+	return fmt.Sprintf("cannot convert '%v' to %s", e.val, e.typ.String())
+}
+
+// withPath 为转换错误添加位置前缀
+func withPath(err error, seg string) error {
+	var cerr *convertError
+	if errors.As(err, &cerr) {
+		if len(cerr.path) > 0 && !strings.HasPrefix(cerr.path, "[") {
+			seg += "."
+		}
+		cerr.path = seg + cerr.path
+	}
+	return err
+}
+
+// toInt64 严格转换为 int64, 无法转换或超出范围时返回错误
+func toInt64(obj any, typ reflect.Type) (int64, error) {
+	if typ == durationType {
+		if str, ok := obj.(string); ok {
+			if _, err := strconv.ParseInt(strings.TrimSpace(str), 10, 64); nil != err {
+				if d, err := time.ParseDuration(strings.TrimSpace(str)); nil == err {
+					return int64(d), nil
+				}
+			}
+		}
+	}
+	var res int64
+	var err error
+	val := reflect.ValueOf(obj)
+	switch {
+	case val.CanInt():
+		res = val.Int()
+	case val.CanUint():
+		if val.Uint() > math.MaxInt64 {
+			err = errors.New("out of range")
+		}
+		res = int64(val.Uint())
+	case val.CanFloat():
+		if f := val.Float(); f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			err = errors.New("not an integer")
+		} else {
+			res = int64(f)
+		}
+	case val.Kind() == reflect.String:
+		res, err = strconv.ParseInt(strings.TrimSpace(val.String()), 10, 64)
+	default:
+		err = errors.New("not a number")
+	}
+	if nil == err && reflect.Zero(typ).OverflowInt(res) {
+		err = errors.New("out of range")
+	}
+	if nil != err {
+		return 0, &convertError{val: obj, typ: typ}
+	}
+	return res, nil
+}
+
+// toUint64 严格转换为 uint64, 无法转换或超出范围时返回错误
+func toUint64(obj any, typ reflect.Type) (uint64, error) {
+	var res uint64
+	var err error
+	val := reflect.ValueOf(obj)
+	switch {
+	case val.CanInt():
+		if val.Int() < 0 {
+			err = errors.New("out of range")
+		}
+		res = uint64(val.Int())
+	case val.CanUint():
+		res = val.Uint()
+	case val.CanFloat():
+		if f := val.Float(); f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+			err = errors.New("not an integer")
+		} else {
+			res = uint64(f)
+		}
+	case val.Kind() == reflect.String:
+		res, err = strconv.ParseUint(strings.TrimSpace(val.String()), 10, 64)
+	default:
+		err = errors.New("not a number")
+	}
+	if nil == err && reflect.Zero(typ).OverflowUint(res) {
+		err = errors.New("out of range")
+	}
+	if nil != err {
+		return 0, &convertError{val: obj, typ: typ}
+	}
+	return res, nil
+}
+
+// toFloat64 严格转换为 float64
+func toFloat64(obj any, typ reflect.Type) (float64, error) {
+	var res float64
+	var err error
+	val := reflect.ValueOf(obj)
+	switch {
+	case val.CanInt():
+		res = float64(val.Int())
+	case val.CanUint():
+		res = float64(val.Uint())
+	case val.CanFloat():
+		res = val.Float()
+	case val.Kind() == reflect.String:
+		res, err = strconv.ParseFloat(strings.TrimSpace(val.String()), 64)
+	default:
+		err = errors.New("not a number")
+	}
+	if nil == err && reflect.Zero(typ).OverflowFloat(res) {
+		err = errors.New("out of range")
+	}
+	if nil != err {
+		return 0, &convertError{val: obj, typ: typ}
+	}
+	return res, nil
+}
+
+// toBool 严格转换为 bool
+func toBool(obj any, typ reflect.Type) (bool, error) {
+	switch val := obj.(type) {
+	case bool:
+		return val, nil
+	case string:
+		if res, err := strconv.ParseBool(strings.TrimSpace(val)); nil == err {
+			return res, nil
+		}
+	}
+	return false, &convertError{val: obj, typ: typ}
+}
+
+// toString 转换为 string, 数字和布尔值转为其字面值
+func toString(obj any, typ reflect.Type) (string, error) {
+	switch val := obj.(type) {
+	case string:
+		return val, nil
+	case json.Number:
+		return val.String(), nil
+	}
+	if val := reflect.ValueOf(obj); val.CanInt() || val.CanUint() || val.CanFloat() || val.Kind() == reflect.Bool {
+		return fmt.Sprint(obj), nil
+	}
+	return "", &convertError{val: obj, typ: typ}
+}
+
+// collectValidationErr 收集校验错误, 其他错误原样返回
+func collectValidationErr(errs *[]ipakku.ConfigFieldError, err error) error {
+	var verr *ipakku.ConfigValidationError
+	if nil != err && errors.As(err, &verr) {
+		*errs = append(*errs, verr.Errors...)
+		return nil
+	}
+	return err
+}
+
+// newValidationErr 有校验错误时返回 *ipakku.ConfigValidationError
+func newValidationErr(errs []ipakku.ConfigFieldError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Key < errs[j].Key
+	})
+	return &ipakku.ConfigValidationError{Errors: errs}
+}
+
+// containsString 切片中是否包含 s
+func containsString(arr []string, s string) bool {
+	for _, v := range arr {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
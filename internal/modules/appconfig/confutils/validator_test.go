@@ -0,0 +1,79 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+package confutils
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wup364/pakku/ipakku"
+)
+
+type validBean struct {
+	Addr    string        `@value:"addr" @valid:"required,regex=^[a-z.]*:[0-9]+$"`
+	Mode    string        `@value:"mode:dev" @valid:"oneof=dev|prod"`
+	Workers int           `@value:"workers:4" @valid:"min=1,max=64"`
+	Timeout time.Duration `@value:"timeout:30s" @valid:"min=1s,max=1m"`
+	Debug   bool          `@value:"debug"`
+}
+
+type validModule struct {
+	service *validBean `@autoConfig:"service"`
+	backup  *validBean `@autoConfig:"backup"`
+}
+
+func TestValidateAutoConfig(t *testing.T) {
+	config := &mapConfig{data: map[string]any{
+		"service": map[string]any{"addr": "localhost:8080", "workers": json.Number("8"), "timeout": "5s"},
+		"backup":  map[string]any{"addr": "8080", "mode": "test", "workers": "many", "timeout": "2m", "debug": "yes"},
+	}}
+	module := new(validModule)
+	err := NewAutoValueOfBeanUtil(config).ScanAndAutoConfig(module)
+
+	var verr *ipakku.ConfigValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("err = %v", err)
+	}
+	keys := make([]string, 0, len(verr.Errors))
+	for _, fe := range verr.Errors {
+		keys = append(keys, fe.Key)
+	}
+	if expect := "backup.addr,backup.debug,backup.mode,backup.timeout,backup.workers"; strings.Join(keys, ",") != expect {
+		t.Fatalf("keys = %v\n%s", keys, err.Error())
+	}
+	if verr.Errors[0].Field != "validBean.Addr" {
+		t.Fatalf("field = %s", verr.Errors[0].Field)
+	}
+
+	// 校验通过的字段正常赋值, 不通过的字段保持原值
+	if module.service.Addr != "localhost:8080" || module.service.Mode != "dev" || module.service.Workers != 8 || module.service.Timeout != 5*time.Second {
+		t.Fatalf("service = %v", module.service)
+	}
+	if nil != module.backup {
+		t.Fatalf("backup = %v", module.backup)
+	}
+
+	// 必填
+	config.data = map[string]any{"service": map[string]any{}, "backup": map[string]any{"addr": "a:1"}}
+	err = NewAutoValueOfBeanUtil(config).ScanAndAutoConfig(new(validModule))
+	if !errors.As(err, &verr) || len(verr.Errors) != 1 || verr.Errors[0].Key != "service.addr" || verr.Errors[0].Reason != "is required" {
+		t.Fatalf("err = %v", err)
+	}
+}
+
+func TestParseValidRules(t *testing.T) {
+	rules, err := parseValidRules("required, min=1,regex=^(a,b)$")
+	if nil != err || len(rules) != 3 || rules[1].arg != "1" || rules[2].arg != "^(a,b)$" {
+		t.Fatalf("rules = %v, err = %v", rules, err)
+	}
+	if _, err = parseValidRules("unknown"); nil == err {
+		t.Fatal("unknown rule should fail")
+	}
+	if _, err = parseValidRules("min"); nil == err {
+		t.Fatal("min without argument should fail")
+	}
+}
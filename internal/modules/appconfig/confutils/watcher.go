@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 配置工具-配置变化监听
+// 定时调用 ipakku.ConfigReloader 重新加载配置, 并通知发生变化的key
+
+package confutils
+
+import (
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/wup364/pakku/ipakku"
+	"github.com/wup364/pakku/pkg/logs"
+	"github.com/wup364/pakku/pkg/utypes"
+)
+
+// NewConfigWatcher 配置变化监听, interval<=0 时不自动检查, 可手动调用 Reload
+func NewConfigWatcher(config ipakku.IConfig, interval time.Duration) *ConfigWatcher {
+	return &ConfigWatcher{
+		config:   config,
+		interval: interval,
+		l:        new(sync.Mutex),
+		rl:       new(sync.Mutex),
+	}
+}
+
+// ConfigWatcher 配置变化监听
+type ConfigWatcher struct {
+	config   ipakku.IConfig
+	interval time.Duration
+	watchers []*keyWatcher
+	stop     chan struct{}
+	l        *sync.Mutex
+	rl       *sync.Mutex
+}
+
+// keyWatcher 监听的key
+type keyWatcher struct {
+	prefix string
+	last   utypes.Object
+	fn     func(old, new utypes.Object)
+}
+
+// Watch 监听 keyPrefix 的值变化, keyPrefix 为空时任意配置变化都会通知(old/new为空)
+// 第一次调用时启动定时检查
+func (cw *ConfigWatcher) Watch(keyPrefix string, fn func(old, new utypes.Object)) {
+	cw.l.Lock()
+	defer cw.l.Unlock()
+	cw.watchers = append(cw.watchers, &keyWatcher{prefix: keyPrefix, last: cw.getConfig(keyPrefix), fn: fn})
+	if nil == cw.stop && cw.interval > 0 {
+		cw.stop = make(chan struct{})
+		go cw.poll(cw.stop)
+	}
+}
+
+// Reload 重新加载配置, 有变化时通知监听者. 部分来源加载失败(如远程配置不可用)但其他来源有变化时, 仍然通知并返回错误
+func (cw *ConfigWatcher) Reload() (bool, error) {
+	reloader, ok := cw.config.(ipakku.ConfigReloader)
+	if !ok {
+		return false, nil
+	}
+	cw.rl.Lock()
+	defer cw.rl.Unlock()
+	changed, err := reloader.Reload()
+	if !changed {
+		return false, err
+	}
+
+	cw.l.Lock()
+	watchers := make([]*keyWatcher, len(cw.watchers))
+	copy(watchers, cw.watchers)
+	cw.l.Unlock()
+	for _, w := range watchers {
+		val := cw.getConfig(w.prefix)
+		if len(w.prefix) > 0 && reflect.DeepEqual(w.last.GetVal(), val.GetVal()) {
+			continue
+		}
+		old := w.last
+		w.last = val
+		cw.notify(w, old, val)
+	}
+	return true, err
+}
+
+// Stop 停止定时检查
+func (cw *ConfigWatcher) Stop() {
+	cw.l.Lock()
+	defer cw.l.Unlock()
+	if nil != cw.stop {
+		close(cw.stop)
+		cw.stop = nil
+	}
+}
+
+// poll 定时检查配置变化
+func (cw *ConfigWatcher) poll(stop chan struct{}) {
+	ticker := time.NewTicker(cw.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if _, err := cw.Reload(); nil != err {
+				logs.Errorf("reload config failed: %s", err.Error())
+			}
+		}
+	}
+}
+
+// notify 通知监听者, 不因监听者异常中断
+func (cw *ConfigWatcher) notify(w *keyWatcher, old, val utypes.Object) {
+	defer func() {
+		if err := recover(); nil != err {
+			logs.Errorf("config watcher of '%s' panic: %v", w.prefix, err)
+		}
+	}()
+	w.fn(old, val)
+}
+
+// getConfig 读取配置, key 为空时返回空对象
+func (cw *ConfigWatcher) getConfig(key string) (res utypes.Object) {
+	if len(key) > 0 {
+		res = cw.config.GetConfig(key)
+	}
+	return
+}
+
+// NewFileWatcher 通过修改时间和大小判断文件是否变化
+func NewFileWatcher(path string) *FileWatcher {
+	fw := &FileWatcher{path: path}
+	fw.Changed()
+	return fw
+}
+
+// FileWatcher 文件变化检查
+type FileWatcher struct {
+	path    string
+	modTime time.Time
+	size    int64
+}
+
+// Changed 文件是否发生变化, 并记录当前的状态
+func (fw *FileWatcher) Changed() (bool, error) {
+	info, err := os.Stat(fw.path)
+	if nil != err {
+		return false, err
+	}
+	if info.ModTime().Equal(fw.modTime) && info.Size() == fw.size {
+		return false, nil
+	}
+	fw.modTime, fw.size = info.ModTime(), info.Size()
+	return true, nil
+}
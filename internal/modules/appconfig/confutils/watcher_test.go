@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+package confutils
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wup364/pakku/ipakku"
+	"github.com/wup364/pakku/pkg/utypes"
+)
+
+// reloadConfig 可重新加载的内存配置
+type reloadConfig struct {
+	mapConfig
+	l    sync.Mutex
+	next map[string]any
+	err  error // 模拟部分来源加载失败
+}
+
+func (c *reloadConfig) Reload() (bool, error) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	if nil == c.next {
+		return false, c.err
+	}
+	c.data, c.next = c.next, nil
+	return true, c.err
+}
+
+// setNext 设置下次重新加载的配置
+func (c *reloadConfig) setNext(next map[string]any) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.next = next
+}
+
+type watchedBean struct {
+	Addr    string `@value:"addr"`
+	Timeout int    `@value:"timeout:10"`
+}
+
+type watchedModule struct {
+	service *watchedBean `@autoConfig:"service,reload"`
+	static  *watchedBean `@autoConfig:"static"`
+}
+
+func TestConfigWatcher(t *testing.T) {
+	config := &reloadConfig{mapConfig: mapConfig{data: map[string]any{
+		"service": map[string]any{"addr": ":8080"},
+		"static":  map[string]any{"addr": "/www"},
+	}}}
+	watcher := NewConfigWatcher(config, 0)
+	module := new(watchedModule)
+	if err := NewAutoValueOfBeanUtil(config).SetConfigWatcher(watcher).ScanAndAutoConfig(module); nil != err {
+		t.Fatal(err)
+	}
+	if module.service.Addr != ":8080" || module.service.Timeout != 10 {
+		t.Fatalf("service = %v", module.service)
+	}
+
+	var changes []string
+	watcher.Watch("service.addr", func(old, new utypes.Object) {
+		changes = append(changes, old.ToString("")+"->"+new.ToString(""))
+	})
+	watcher.Watch("static", func(old, new utypes.Object) {
+		t.Fatal("static is not changed")
+	})
+	if changed, err := watcher.Reload(); nil != err || changed {
+		t.Fatalf("changed = %v, err = %v", changed, err)
+	}
+
+	config.next = map[string]any{
+		"service": map[string]any{"addr": ":9090", "timeout": json.Number("30")},
+		"static":  map[string]any{"addr": "/www"},
+	}
+	if changed, err := watcher.Reload(); nil != err || !changed {
+		t.Fatalf("changed = %v, err = %v", changed, err)
+	}
+	if len(changes) != 1 || changes[0] != ":8080->:9090" {
+		t.Fatalf("changes = %v", changes)
+	}
+	if module.service.Addr != ":9090" || module.service.Timeout != 30 {
+		t.Fatalf("service = %v", module.service)
+	}
+	if module.static.Addr != "/www" {
+		t.Fatalf("static = %v", module.static)
+	}
+}
+
+func TestConfigWatcherConcurrentRead(t *testing.T) {
+	config := &reloadConfig{mapConfig: mapConfig{data: map[string]any{
+		"service": map[string]any{"addr": ":8080"},
+		"static":  map[string]any{"addr": "/www"},
+	}}}
+	watcher := NewConfigWatcher(config, 0)
+	module := new(watchedModule)
+	if err := NewAutoValueOfBeanUtil(config).SetConfigWatcher(watcher).ScanAndAutoConfig(module); nil != err {
+		t.Fatal(err)
+	}
+
+	// 重新配置与读取并发, 使用 -race 检查
+	stop := make(chan struct{})
+	wg := new(sync.WaitGroup)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if service := ipakku.LoadAutoConfig(&module.service); !strings.HasPrefix(service.Addr, ":") {
+					t.Errorf("service = %v", service)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		config.setNext(map[string]any{
+			"service": map[string]any{"addr": ":" + string(rune('0'+i%10))},
+			"static":  map[string]any{"addr": "/www"},
+		})
+		if _, err := watcher.Reload(); nil != err {
+			t.Fatal(err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+	if service := ipakku.LoadAutoConfig(&module.service); service.Addr != ":9" {
+		t.Fatalf("service = %v", service)
+	}
+}
+
+func TestConfigWatcherReloadField(t *testing.T) {
+	config := &mapConfig{data: map[string]any{"service": map[string]any{"addr": ":8080"}}}
+	module := &struct {
+		service watchedBean `@autoConfig:"service,reload"`
+	}{}
+	err := NewAutoValueOfBeanUtil(config).SetConfigWatcher(NewConfigWatcher(config, 0)).ScanAndAutoConfig(module)
+	if nil == err || !strings.Contains(err.Error(), "must be a pointer") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestConfigWatcherPartialError(t *testing.T) {
+	config := &reloadConfig{mapConfig: mapConfig{data: map[string]any{"service": map[string]any{"addr": ":8080"}}}}
+	watcher := NewConfigWatcher(config, 0)
+	var changes []string
+	watcher.Watch("service.addr", func(old, new utypes.Object) {
+		changes = append(changes, new.ToString(""))
+	})
+
+	// 远程配置不可用但本地配置有变化时仍然通知
+	config.err = errors.New("remote is down")
+	config.setNext(map[string]any{"service": map[string]any{"addr": ":9090"}})
+	if changed, err := watcher.Reload(); nil == err || !changed {
+		t.Fatalf("changed = %v, err = %v", changed, err)
+	}
+	if len(changes) != 1 || changes[0] != ":9090" {
+		t.Fatalf("changes = %v", changes)
+	}
+	if changed, err := watcher.Reload(); nil == err || changed || len(changes) != 1 {
+		t.Fatalf("changed = %v, err = %v, changes = %v", changed, err, changes)
+	}
+}
@@ -13,7 +13,9 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/wup364/pakku/internal/modules/appconfig/confutils"
 	"github.com/wup364/pakku/ipakku"
 	"github.com/wup364/pakku/pkg/fileutil"
 	"github.com/wup364/pakku/pkg/strutil"
@@ -25,16 +27,42 @@ func init() {
 	ipakku.PakkuConf.RegisterPakkuModuleImplement(new(Config), "IConfig", "json")
 }
 
+// lockTimeout 等待配置文件锁的超时时间, lockStale 锁文件超过该时间视为已失效
+const lockTimeout, lockStale = 5 * time.Second, 30 * time.Second
+
 // Config json配置器
 type Config struct {
 	jsonObject map[string]any
 	configPath string
+	configDir  string
+	nobackup   bool
+	watcher    *confutils.FileWatcher
+	synced     *confutils.FileWatcher
 	l          *sync.RWMutex
 }
 
+// SetBackup 写入时是否保留上一个版本为 .bak 文件, 默认保留
+func (config *Config) SetBackup(backup bool) *Config {
+	config.nobackup = !backup
+	return config
+}
+
+// SetConfigDir 设置配置文件所在目录, 默认 .conf
+func (config *Config) SetConfigDir(dir string) {
+	config.configDir = dir
+}
+
+// getConfigDir 配置文件所在目录
+func (config *Config) getConfigDir() string {
+	if len(config.configDir) > 0 {
+		return config.configDir
+	}
+	return ipakku.DEFT_VAL_CONFIG_DIR
+}
+
 // Init 初始化解析器
 func (config *Config) Init(appName string) error {
-	path, err := filepath.Abs(".conf/" + appName + ".json")
+	path, err := filepath.Abs(filepath.Join(config.getConfigDir(), appName+".json"))
 	if nil != err {
 		return err
 	}
@@ -68,9 +96,26 @@ func (config *Config) InitConfig(configPath string) error {
 	defer config.l.Unlock()
 	// Json to map
 	config.jsonObject = make(map[string]any)
+	config.watcher = confutils.NewFileWatcher(config.configPath)
+	config.synced = confutils.NewFileWatcher(config.configPath)
 	return config.readFileAsJSON(config.configPath, &config.jsonObject)
 }
 
+// Reload 配置文件发生变化时重新加载
+func (config *Config) Reload() (bool, error) {
+	if changed, err := config.watcher.Changed(); nil != err || !changed {
+		return false, err
+	}
+	jsonObject := make(map[string]any)
+	if err := config.readFileAsJSON(config.configPath, &jsonObject); nil != err {
+		return false, err
+	}
+	config.l.Lock()
+	defer config.l.Unlock()
+	config.jsonObject = jsonObject
+	return true, nil
+}
+
 // GetConfig 读取key的value信息
 // 返回ConfigBody对象, 里面的值可能是string或者map
 func (config *Config) GetConfig(key string) (res utypes.Object) {
@@ -129,6 +174,22 @@ func (config *Config) SetConfig(key string, value any) error {
 	}
 	config.l.Lock()
 	defer config.l.Unlock()
+	// 多个进程共用配置文件时互斥写入, 其他进程修改过文件时先重新读取, 避免覆盖其修改
+	lock, err := fileutil.LockFile(config.configPath+".lock", lockTimeout, lockStale)
+	if nil != err {
+		return err
+	}
+	defer lock.Unlock()
+	if changed, err := config.synced.Changed(); nil != err {
+		return err
+	} else if changed {
+		jsonObject := make(map[string]any)
+		if err := config.readFileAsJSON(config.configPath, &jsonObject); nil != err {
+			return err
+		}
+		config.jsonObject = jsonObject
+	}
+
 	keys := strings.Split(key, ".")
 	keyLength := len(keys)
 	var temp any
@@ -140,7 +201,10 @@ func (config *Config) SetConfig(key string, value any) error {
 			} else if temp != nil {
 				temp.(map[string]any)[keys[i]] = value
 			}
-			err := config.writeFileAsJSON(config.configPath, config.jsonObject)
+			if err := config.writeFileAsJSON(config.configPath, config.jsonObject); nil != err {
+				return err
+			}
+			_, err := config.synced.Changed()
 			return err
 		}
 
@@ -190,25 +254,7 @@ func (config *Config) readFileAsJSON(path string, v any) error {
 	return err
 }
 
-// writeFileAsJSON 写入Json文件
+// writeFileAsJSON 以缩进格式原子写入Json文件
 func (config *Config) writeFileAsJSON(path string, v any) error {
-	if len(path) == 0 {
-		return fileutil.PathNotExist("WriteFileAsJSON", path)
-	}
-	fp, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
-	defer func() {
-		if nil != fp {
-			fp.Close()
-		}
-	}()
-
-	if err == nil {
-		data, err := json.Marshal(v)
-		if err == nil {
-			_, err := fp.Write(data)
-			return err
-		}
-		return err
-	}
-	return err
+	return fileutil.WriteFileAsIndentJSON(path, v, !config.nobackup)
 }
@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+package jsonconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJsonConfigSharedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.json")
+	a, b := new(Config), new(Config)
+	if err := a.InitConfig(path); nil != err {
+		t.Fatal(err)
+	}
+	if err := b.InitConfig(path); nil != err {
+		t.Fatal(err)
+	}
+
+	// 两个实例交替写入, 不覆盖对方的修改
+	if err := a.SetConfig("service.addr", ":8080"); nil != err {
+		t.Fatal(err)
+	}
+	if err := b.SetConfig("service.name", "pakku"); nil != err {
+		t.Fatal(err)
+	}
+	if err := a.SetConfig("debug", true); nil != err {
+		t.Fatal(err)
+	}
+	if err := a.InitConfig(path); nil != err {
+		t.Fatal(err)
+	}
+	if a.GetConfig("service.addr").ToString("") != ":8080" || a.GetConfig("service.name").ToString("") != "pakku" || !a.GetConfig("debug").ToBool(false) {
+		t.Fatalf("config = %v", a.jsonObject)
+	}
+
+	data, err := os.ReadFile(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "\n  \"service\": {\n    \"addr\": \":8080\",") {
+		t.Fatalf("data = %s", data)
+	}
+	if _, err = os.Stat(path + ".bak"); nil != err {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Fatalf("lock file is not removed: %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 配置工具-远程配置实现
+// 从 HTTP 地址获取 JSON 配置, 缓存到本地用于离线启动, 通过 ETag 检查变化.
+// 远程配置支持嵌套对象或 a.b.c 形式的扁平key, 远程配置中不存在的key从本地 JSON 配置文件读取, SetConfig 写入本地配置文件
+// 依赖包: httpclient jsonconfig
+
+package remoteconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/wup364/pakku/internal/modules/appconfig/confutils"
+	"github.com/wup364/pakku/internal/modules/appconfig/jsonconfig"
+	"github.com/wup364/pakku/ipakku"
+	"github.com/wup364/pakku/pkg/constants/httpheaders"
+	"github.com/wup364/pakku/pkg/constants/mediatypes"
+	"github.com/wup364/pakku/pkg/fileutil"
+	"github.com/wup364/pakku/pkg/httpclient"
+	"github.com/wup364/pakku/pkg/logs"
+	"github.com/wup364/pakku/pkg/utypes"
+)
+
+func init() {
+	// 注册实例实现
+	ipakku.PakkuConf.RegisterPakkuModuleImplement(new(Config), "IConfig", "remote")
+}
+
+// DefaultClient 请求远程配置的 http client
+var DefaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// Config 远程配置
+type Config struct {
+	url       string
+	headers   map[string]string
+	cachePath string
+	configDir string
+	etag      string
+	data      map[string]any
+	local     *jsonconfig.Config
+	client    *http.Client
+	l         *sync.RWMutex
+}
+
+// cacheFile 本地缓存文件内容
+type cacheFile struct {
+	URL  string         `json:"url"`
+	ETag string         `json:"etag"`
+	Data map[string]any `json:"data"`
+}
+
+// SetConfigDir 设置本地配置文件和缓存文件所在目录, 默认 .conf
+func (config *Config) SetConfigDir(dir string) {
+	config.configDir = dir
+}
+
+// Init 初始化, 本地配置文件为 {app}.json, 远程配置缓存为 {app}.remote.json.
+// 远程地址读取环境变量 PAKKU_CONFIG_URL 或本地配置 pakku.remote.url
+func (config *Config) Init(appName string) error {
+	dir := config.configDir
+	if len(dir) == 0 {
+		dir = ipakku.DEFT_VAL_CONFIG_DIR
+	}
+	local := new(jsonconfig.Config)
+	local.SetConfigDir(dir)
+	if err := local.Init(appName); nil != err {
+		return err
+	}
+
+	url := os.Getenv(ipakku.ENV_KEY_CONFIG_URL)
+	if len(url) == 0 {
+		url = local.GetConfig(ipakku.CONFKEY_REMOTE_URL).ToString("")
+	}
+	headers := make(map[string]string)
+	for k, v := range local.GetConfig(ipakku.CONFKEY_REMOTE_HEADERS).ToStrMap(nil) {
+		headers[k] = utypes.NewObject(v).ToString("")
+	}
+	cachePath, err := filepath.Abs(filepath.Join(dir, appName+".remote.json"))
+	if nil != err {
+		return err
+	}
+	return config.InitConfig(url, headers, cachePath, local)
+}
+
+// InitConfig 初始化, url 为空时仅使用本地配置
+func (config *Config) InitConfig(url string, headers map[string]string, cachePath string, local *jsonconfig.Config) error {
+	if nil == local {
+		return errors.New("local config is nil")
+	}
+	config.url, config.headers, config.cachePath, config.local = url, headers, cachePath, local
+	config.l = new(sync.RWMutex)
+	if nil == config.client {
+		config.client = DefaultClient
+	}
+	if len(url) == 0 {
+		return nil
+	}
+
+	// 先读取缓存, 远程不可用时使用缓存启动
+	if cache, err := config.readCache(); nil != err {
+		logs.Errorf("read remote config cache failed: %s", err.Error())
+	} else if nil != cache && cache.URL == url {
+		config.data, config.etag = cache.Data, cache.ETag
+	}
+	if _, err := config.fetch(); nil != err {
+		if nil == config.data {
+			logs.Errorf("fetch remote config failed, use local config only: %s", err.Error())
+		} else {
+			logs.Errorf("fetch remote config failed, use cached config: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// SetClient 设置请求远程配置的 http client, 需在 Init 之前设置
+func (config *Config) SetClient(client *http.Client) *Config {
+	config.client = client
+	return config
+}
+
+// Reload 重新获取远程配置(ETag未变化时服务端返回304), 并检查本地配置文件是否变化.
+// 其中一个来源失败时仍返回另一个来源是否变化, 同时返回错误
+func (config *Config) Reload() (bool, error) {
+	localChanged, err := config.local.Reload()
+	if len(config.url) == 0 {
+		return localChanged, err
+	}
+	remoteChanged, rerr := config.fetch()
+	if nil == err {
+		err = rerr
+	}
+	return localChanged || remoteChanged, err
+}
+
+// GetConfig 读取配置, 优先读取远程配置, 不存在时读取本地配置
+func (config *Config) GetConfig(key string) (res utypes.Object) {
+	config.l.RLock()
+	val := confutils.GetDottedValue(config.data, key)
+	config.l.RUnlock()
+	if nil != val {
+		return utypes.NewObject(val)
+	}
+	return config.local.GetConfig(key)
+}
+
+// SetConfig 保存到本地配置文件, 远程配置中存在相同的key时以远程配置为准
+func (config *Config) SetConfig(key string, value any) error {
+	return config.local.SetConfig(key, value)
+}
+
+// fetch 获取远程配置, 返回配置是否发生变化
+func (config *Config) fetch() (bool, error) {
+	config.l.RLock()
+	headers := map[string]string{httpheaders.ACCEPT: mediatypes.APPLICATION_JSON}
+	for k, v := range config.headers {
+		headers[k] = v
+	}
+	if len(config.etag) > 0 {
+		headers[httpheaders.IF_NONE_MATCH] = config.etag
+	}
+	config.l.RUnlock()
+
+	resp, err := httpclient.Request(config.client, http.MethodGet, "", config.url, nil, headers)
+	if nil != err {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("fetch remote config failed, url: %s, status: %s", config.url, resp.Status)
+	}
+
+	data := make(map[string]any)
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err = decoder.Decode(&data); nil != err {
+		return false, fmt.Errorf("remote config is not a json object: %s", err.Error())
+	}
+	// 支持 a.b.c 形式的扁平key
+	data = confutils.ExpandDottedKeys(data)
+	etag := resp.Header.Get(httpheaders.ETAG)
+
+	config.l.Lock()
+	changed := !reflect.DeepEqual(config.data, data)
+	config.data, config.etag = data, etag
+	config.l.Unlock()
+	if err = fileutil.WriteFileAsIndentJSON(config.cachePath, &cacheFile{URL: config.url, ETag: etag, Data: data}, false); nil != err {
+		logs.Errorf("write remote config cache failed: %s", err.Error())
+	}
+	return changed, nil
+}
+
+// readCache 读取本地缓存, 不存在时返回 nil
+func (config *Config) readCache() (*cacheFile, error) {
+	if !fileutil.IsFile(config.cachePath) {
+		return nil, nil
+	}
+	fp, err := os.Open(config.cachePath)
+	if nil != err {
+		return nil, err
+	}
+	defer fp.Close()
+	cache := new(cacheFile)
+	decoder := json.NewDecoder(fp)
+	decoder.UseNumber()
+	if err = decoder.Decode(cache); nil != err {
+		return nil, err
+	}
+	return cache, nil
+}
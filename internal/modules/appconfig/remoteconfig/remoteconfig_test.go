@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+package remoteconfig
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/wup364/pakku/internal/modules/appconfig/jsonconfig"
+)
+
+// remoteServer 模拟配置中心
+type remoteServer struct {
+	body    string
+	etag    string
+	token   string
+	fetched int
+	l       sync.Mutex
+}
+
+func (s *remoteServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if r.Header.Get("Authorization") != s.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	s.fetched++
+	if r.Header.Get("If-None-Match") == s.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("ETag", s.etag)
+	w.Write([]byte(s.body))
+}
+
+func (s *remoteServer) set(body, etag string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.body, s.etag = body, etag
+}
+
+func TestRemoteConfig(t *testing.T) {
+	srv := &remoteServer{token: "Bearer t"}
+	srv.set(`{"service": {"addr": ":8080"}, "db.port": 3306}`, `"v1"`)
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.json"), []byte(`{"pakku": {"remote": {"url": "`+ts.URL+`", "headers": {"Authorization": "Bearer t"}}}, "service": {"addr": ":80", "name": "local"}}`), 0644); nil != err {
+		t.Fatal(err)
+	}
+	config := new(Config)
+	config.SetConfigDir(dir)
+	if err := config.Init("app"); nil != err {
+		t.Fatal(err)
+	}
+
+	// 优先读取远程配置, 远程不存在时读取本地配置, 扁平key被展开
+	if config.GetConfig("service.addr").ToString("") != ":8080" || config.GetConfig("service.name").ToString("") != "local" || config.GetConfig("db.port").ToInt(0) != 3306 {
+		t.Fatalf("data = %v", config.data)
+	}
+
+	// 未变化时返回304
+	if changed, err := config.Reload(); nil != err || changed {
+		t.Fatalf("changed = %v, err = %v", changed, err)
+	}
+	srv.set(`{"service": {"addr": ":9090"}}`, `"v2"`)
+	if changed, err := config.Reload(); nil != err || !changed || config.GetConfig("service.addr").ToString("") != ":9090" {
+		t.Fatalf("changed = %v, err = %v, data = %v", changed, err, config.data)
+	}
+
+	// 写入本地配置
+	if err := config.SetConfig("service.name", "pakku"); nil != err {
+		t.Fatal(err)
+	}
+	if config.GetConfig("service.name").ToString("") != "pakku" {
+		t.Fatalf("local = %v", config.GetConfig("service").GetVal())
+	}
+
+	// 远程不可用时使用缓存启动
+	ts.Close()
+	offline := new(Config)
+	offline.SetConfigDir(dir)
+	if err := offline.Init("app"); nil != err {
+		t.Fatal(err)
+	}
+	if offline.GetConfig("service.addr").ToString("") != ":9090" || offline.etag != `"v2"` {
+		t.Fatalf("data = %v, etag = %s", offline.data, offline.etag)
+	}
+	if _, err := offline.Reload(); nil == err {
+		t.Fatal("reload should fail when remote is down")
+	}
+	if offline.GetConfig("service.addr").ToString("") != ":9090" {
+		t.Fatalf("data = %v", offline.data)
+	}
+}
+
+func TestRemoteConfigLocalFallback(t *testing.T) {
+	dir := t.TempDir()
+	local := new(jsonconfig.Config)
+	if err := local.InitConfig(filepath.Join(dir, "app.json")); nil != err {
+		t.Fatal(err)
+	}
+	if err := local.SetConfig("service.addr", ":80"); nil != err {
+		t.Fatal(err)
+	}
+
+	// 远程不可用且无缓存时仅使用本地配置
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+	config := new(Config)
+	if err := config.InitConfig(ts.URL, nil, filepath.Join(dir, "app.remote.json"), local); nil != err {
+		t.Fatal(err)
+	}
+	if nil != config.data || config.GetConfig("service.addr").ToString("") != ":80" {
+		t.Fatalf("data = %v", config.data)
+	}
+
+	// 未配置远程地址
+	config = new(Config)
+	if err := config.InitConfig("", nil, "", local); nil != err {
+		t.Fatal(err)
+	}
+	// 本地配置已被修改, 先同步一次
+	config.Reload()
+	if changed, err := config.Reload(); nil != err || changed || config.GetConfig("service.addr").ToString("") != ":80" {
+		t.Fatalf("changed = %v, err = %v", changed, err)
+	}
+}
@@ -0,0 +1,336 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 配置工具-TOML文件实现, 回写时保留注释
+// 依赖包: utypes.Object fileutil
+
+package tomlconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/wup364/pakku/internal/modules/appconfig/confutils"
+	"github.com/wup364/pakku/ipakku"
+	"github.com/wup364/pakku/pkg/fileutil"
+	"github.com/wup364/pakku/pkg/strutil"
+	"github.com/wup364/pakku/pkg/utypes"
+)
+
+func init() {
+	// 注册实例实现
+	ipakku.PakkuConf.RegisterPakkuModuleImplement(new(Config), "IConfig", "toml")
+}
+
+// Config toml配置器
+type Config struct {
+	doc        *document
+	configPath string
+	configDir  string
+	watcher    *confutils.FileWatcher
+	l          *sync.RWMutex
+}
+
+// SetConfigDir 设置配置文件所在目录, 默认 .conf
+func (config *Config) SetConfigDir(dir string) {
+	config.configDir = dir
+}
+
+// getConfigDir 配置文件所在目录
+func (config *Config) getConfigDir() string {
+	if len(config.configDir) > 0 {
+		return config.configDir
+	}
+	return ipakku.DEFT_VAL_CONFIG_DIR
+}
+
+// Init 初始化解析器
+func (config *Config) Init(appName string) error {
+	path, err := filepath.Abs(filepath.Join(config.getConfigDir(), appName+".toml"))
+	if nil != err {
+		return err
+	}
+	return config.InitConfig(path)
+}
+
+// InitConfig 初始化解析器
+func (config *Config) InitConfig(configPath string) error {
+	if len(configPath) == 0 {
+		return errors.New("config file path is empty")
+	}
+	// 创建父级目录
+	parent := strutil.GetPathParent(configPath)
+	if !fileutil.IsExist(parent) {
+		err := fileutil.MkdirAll(parent)
+		if nil != err {
+			return err
+		}
+	}
+	config.configPath = configPath
+	// 文件不存在则创建
+	if !fileutil.IsFile(config.configPath) {
+		err := config.writeFile(config.configPath, "")
+		if nil != err {
+			return err
+		}
+	}
+
+	config.l = new(sync.RWMutex)
+	config.l.Lock()
+	defer config.l.Unlock()
+	config.watcher = confutils.NewFileWatcher(config.configPath)
+	data, err := os.ReadFile(config.configPath)
+	if nil != err {
+		return err
+	}
+	config.doc, err = parseDocument(string(data))
+	return err
+}
+
+// Reload 配置文件发生变化时重新加载
+func (config *Config) Reload() (bool, error) {
+	if changed, err := config.watcher.Changed(); nil != err || !changed {
+		return false, err
+	}
+	data, err := os.ReadFile(config.configPath)
+	if nil != err {
+		return false, err
+	}
+	doc, err := parseDocument(string(data))
+	if nil != err {
+		return false, err
+	}
+	config.l.Lock()
+	defer config.l.Unlock()
+	config.doc = doc
+	return true, nil
+}
+
+// GetConfig 读取key的value信息
+// 返回ConfigBody对象, 里面的值可能是string或者map
+func (config *Config) GetConfig(key string) (res utypes.Object) {
+	config.l.RLock()
+	defer config.l.RUnlock()
+	if val := confutils.GetDottedValue(config.doc.data, key); nil != val {
+		res = utypes.NewObject(val)
+	}
+	return
+}
+
+// SetConfig 保存配置
+func (config *Config) SetConfig(key string, value any) error {
+	if len(key) == 0 || nil == value {
+		return errors.New("key or value is empty")
+	}
+	val, err := confutils.NormalizeValue(value)
+	if nil != err {
+		return err
+	}
+	config.l.Lock()
+	defer config.l.Unlock()
+	doc := config.doc
+	if err = config.setValue(strings.Split(key, "."), val); nil != err {
+		config.doc = doc
+		return err
+	}
+	return config.writeFile(config.configPath, config.doc.content())
+}
+
+// setValue 修改文档中的值, 未修改的行及注释保持不变
+func (config *Config) setValue(keys []string, value any) error {
+	if e := config.doc.entry(keys); nil != e {
+		return config.replaceEntry(e, value)
+	}
+	old := confutils.GetDottedValue(config.doc.data, strings.Join(keys, "."))
+	if _, ok := old.(map[string]any); ok {
+		if vmap, ok := value.(map[string]any); ok && len(vmap) > 0 {
+			return config.mergeValue(keys, vmap)
+		}
+	}
+	if nil != old {
+		if err := config.remove(keys); nil != err {
+			return err
+		}
+	}
+	return config.insert(keys, value)
+}
+
+// mergeValue 逐个设置表中的值, 并删除不存在的key, 以保留注释
+func (config *Config) mergeValue(keys []string, value map[string]any) error {
+	for _, k := range sortedKeys(value) {
+		if err := config.setValue(append(keys[:len(keys):len(keys)], k), value[k]); nil != err {
+			return err
+		}
+	}
+	if old, ok := confutils.GetDottedValue(config.doc.data, strings.Join(keys, ".")).(map[string]any); ok {
+		for _, k := range sortedKeys(old) {
+			if _, ok := value[k]; !ok {
+				if err := config.remove(append(keys[:len(keys):len(keys)], k)); nil != err {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// insert 插入不存在的key
+func (config *Config) insert(keys []string, value any) error {
+	doc := config.doc
+	for i := len(keys) - 1; i > 0; i-- {
+		parent := confutils.GetDottedValue(doc.data, strings.Join(keys[:i], "."))
+		if nil == parent {
+			continue
+		}
+		if e := doc.entry(keys[:i]); nil != e {
+			// 上级是 key = value 形式, 整体替换
+			if pmap, ok := parent.(map[string]any); ok {
+				copied, err := confutils.NormalizeValue(pmap)
+				if nil != err {
+					return err
+				}
+				parent = copied
+			} else {
+				parent = make(map[string]any)
+			}
+			if err := confutils.SetDottedValue(parent.(map[string]any), strings.Join(keys[i:], "."), value); nil != err {
+				return err
+			}
+			return config.replaceEntry(e, parent)
+		}
+		if _, ok := parent.(map[string]any); !ok {
+			// 上级是数组表
+			if err := config.remove(keys[:i]); nil != err {
+				return err
+			}
+			return config.insert(keys, value)
+		}
+		return config.insertInto(keys[:i], keys[i:], value)
+	}
+	return config.insertInto(nil, keys, value)
+}
+
+// insertInto 在表 table 中插入 key = value, 非空的表追加到文件末尾
+func (config *Config) insertInto(table, keys []string, value any) error {
+	doc := config.doc
+	if vmap, ok := value.(map[string]any); ok && len(vmap) > 0 {
+		lines, err := renderTable(append(table[:len(table):len(table)], keys...), vmap)
+		if nil != err {
+			return err
+		}
+		if len(strings.TrimSpace(doc.content())) > 0 {
+			lines = append([]string{""}, lines...)
+		}
+		return config.replace(len(doc.lines), len(doc.lines), lines)
+	}
+
+	val, err := formatValue(value)
+	if nil != err {
+		return err
+	}
+	if s := doc.section(table); nil != s {
+		return config.replace(s.end, s.end, []string{formatKey(keys...) + " = " + val})
+	}
+	// 表由 a.b = v 或子表隐式定义时, 插入到最后一个相关的行之后
+	if len(table) > 0 {
+		for i := len(doc.entries) - 1; i >= 0; i-- {
+			e := doc.entries[i]
+			if hasPrefix(e.path, table) && hasPrefix(table, e.table) && !doc.inArray(e.table) {
+				line := formatKey(append(table[len(e.table):len(table):len(table)], keys...)...) + " = " + val
+				return config.replace(e.end, e.end, []string{line})
+			}
+		}
+	}
+	return config.replace(doc.rootEnd, doc.rootEnd, []string{formatKey(append(table[:len(table):len(table)], keys...)...) + " = " + val})
+}
+
+// replaceEntry 替换 key = value 行, 保留 key 的写法和行尾注释
+func (config *Config) replaceEntry(e *entry, value any) error {
+	val, err := formatValue(value)
+	if nil != err {
+		return err
+	}
+	line := e.key + " = " + val + trailingComment(config.doc.lines[e.end-1])
+	return config.replace(e.start, e.end, []string{line})
+}
+
+// remove 删除 keys 及其下所有的行和表
+func (config *Config) remove(keys []string) error {
+	doc := config.doc
+	ranges := make([][2]int, 0)
+	for _, e := range doc.entries {
+		if hasPrefix(e.path, keys) {
+			ranges = append(ranges, [2]int{e.start, e.end})
+		}
+	}
+	for _, s := range doc.sections {
+		if hasPrefix(s.path, keys) {
+			// 表头前的空行一并删除
+			start := s.start
+			for start > 0 && len(strings.TrimSpace(doc.lines[start-1])) == 0 {
+				start--
+			}
+			ranges = append(ranges, [2]int{start, s.end})
+		}
+	}
+	// 合并重叠的范围后从后往前删除
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i][0] < ranges[j][0]
+	})
+	merged := make([][2]int, 0, len(ranges))
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r[0] < merged[n-1][1] {
+			if r[1] > merged[n-1][1] {
+				merged[n-1][1] = r[1]
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	lines := doc.lines
+	for i := len(merged) - 1; i >= 0; i-- {
+		lines = append(lines[:merged[i][0]:merged[i][0]], lines[merged[i][1]:]...)
+	}
+	return config.setLines(lines)
+}
+
+// replace 替换 [start, end) 行并重新解析文档
+func (config *Config) replace(start, end int, lines []string) error {
+	raws := make([]string, 0, len(config.doc.lines)+len(lines))
+	raws = append(raws, config.doc.lines[:start]...)
+	raws = append(raws, lines...)
+	raws = append(raws, config.doc.lines[end:]...)
+	return config.setLines(raws)
+}
+
+// setLines 使用新的行重新解析文档
+func (config *Config) setLines(lines []string) error {
+	doc, err := parseDocument(strings.Join(lines, "\n"))
+	if nil != err {
+		return err
+	}
+	config.doc = doc
+	return nil
+}
+
+// writeFile 写入文件
+func (config *Config) writeFile(path string, content string) error {
+	if len(path) == 0 {
+		return fileutil.PathNotExist("WriteFile", path)
+	}
+	fp, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	defer func() {
+		if nil != fp {
+			fp.Close()
+		}
+	}()
+
+	if err == nil {
+		_, err = fp.WriteString(content)
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+package tomlconfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testTOML = `# 应用配置
+name = "pakku" # 应用名
+debug = true
+log.level = 'info'
+
+# 服务配置
+[service]
+addr = ":8080"
+ReadTimeoutSecond = 10
+cors = [
+  "a.com", # 第一个
+  "b.com",
+]
+limit = { rate = 1_000, burst = 0x10 }
+desc = """
+line1 \
+line2"""
+
+[[service.static]]
+path = "/www"
+dir = "./www"
+
+[[service.static]]
+path = "/docs"
+dir = "./docs"
+`
+
+func TestTomlConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.toml")
+	if err := os.WriteFile(path, []byte(testTOML), 0666); nil != err {
+		t.Fatal(err)
+	}
+	config := new(Config)
+	if err := config.InitConfig(path); nil != err {
+		t.Fatal(err)
+	}
+
+	if val := config.GetConfig("name").ToString(""); val != "pakku" {
+		t.Fatalf("name = %s", val)
+	}
+	if val := config.GetConfig("log.level").ToString(""); val != "info" {
+		t.Fatalf("log.level = %s", val)
+	}
+	if val := config.GetConfig("service.ReadTimeoutSecond").ToInt(0); val != 10 {
+		t.Fatalf("service.ReadTimeoutSecond = %d", val)
+	}
+	if val := config.GetConfig("service.cors").GetVal(); !reflect.DeepEqual(val, []any{"a.com", "b.com"}) {
+		t.Fatalf("service.cors = %v", val)
+	}
+	if rate, burst := config.GetConfig("service.limit.rate").ToInt(0), config.GetConfig("service.limit.burst").ToInt(0); rate != 1000 || burst != 16 {
+		t.Fatalf("service.limit = %d, %d", rate, burst)
+	}
+	if val := config.GetConfig("service.desc").ToString(""); val != "line1 line2" {
+		t.Fatalf("service.desc = %q", val)
+	}
+	static, ok := config.GetConfig("service.static").GetVal().([]any)
+	if !ok || len(static) != 2 || static[1].(map[string]any)["dir"] != "./docs" {
+		t.Fatalf("service.static = %v", static)
+	}
+
+	// 回写保留注释
+	for key, val := range map[string]any{
+		"name":              "app",
+		"service.addr":      ":9090",
+		"service.tls":       map[string]any{"enable": true},
+		"service.limit.max": 5,
+		"log.file":          "app.log",
+		"database.port":     3306,
+	} {
+		if err := config.SetConfig(key, val); nil != err {
+			t.Fatal(key, err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+	content := string(data)
+	for _, expect := range []string{"# 应用配置", `name = "app" # 应用名`, "# 服务配置", `  "a.com", # 第一个`, "[service.tls]\nenable = true", `log.file = "app.log"`, "limit = { burst = 16, max = 5, rate = 1000 }"} {
+		if !strings.Contains(content, expect) {
+			t.Fatalf("%q not found in:\n%s", expect, content)
+		}
+	}
+
+	// 重新读取
+	if err := config.InitConfig(path); nil != err {
+		t.Fatalf("%s\n%s", err.Error(), content)
+	}
+	if val := config.GetConfig("service.addr").ToString(""); val != ":9090" {
+		t.Fatalf("service.addr = %s", val)
+	}
+	if val := config.GetConfig("database.port").ToInt(0); val != 3306 {
+		t.Fatalf("database.port = %d", val)
+	}
+
+	// 替换表, 删除不存在的key和子表
+	if err := config.SetConfig("service", map[string]any{"addr": ":7070"}); nil != err {
+		t.Fatal(err)
+	}
+	if val := config.GetConfig("service").ToStrMap(nil); len(val) != 1 || val["addr"] != ":7070" {
+		t.Fatalf("service = %v", val)
+	}
+}
@@ -0,0 +1,689 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 配置工具-TOML解析
+// 日期时间类型按字符串读取
+
+package tomlconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// errIncomplete 值未结束, 需要继续读取下一行
+	errIncomplete = errors.New("incomplete value")
+	// bareKeyReg 无需引号的key
+	bareKeyReg = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	// intReg 十进制整数
+	intReg = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)$`)
+	// radixIntReg 十六/八/二进制整数
+	radixIntReg = regexp.MustCompile(`^0(x[0-9a-fA-F](_?[0-9a-fA-F])*|o[0-7](_?[0-7])*|b[01](_?[01])*)$`)
+	// floatReg 浮点数
+	floatReg = regexp.MustCompile(`^[+-]?(0|[1-9](_?[0-9])*)(\.[0-9](_?[0-9])*)?([eE][+-]?[0-9](_?[0-9])*)?$`)
+	// lineEndingBackslashReg 多行基本字符串中的行尾反斜杠
+	lineEndingBackslashReg = regexp.MustCompile(`\\[ \t]*\r?\n[ \t\r\n]*`)
+	// datetimeReg 日期时间
+	datetimeReg = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}|\d{2}:\d{2}:\d{2})`)
+)
+
+// document 解析后的toml文档, 保留原始行用于回写
+type document struct {
+	lines    []string
+	data     map[string]any
+	entries  []*entry
+	sections []*section
+	rootEnd  int // 根表最后一个有效行+1
+}
+
+// entry key = value 行
+type entry struct {
+	path  []string // 完整路径
+	table []string // 所在表的路径
+	key   string   // 原始 key 文本, 含缩进
+	start int      // 起始行
+	end   int      // 结束行(不含)
+}
+
+// section [table] 或 [[array]] 表
+type section struct {
+	path  []string
+	array bool
+	start int // 表头所在行
+	end   int // 最后一个有效行+1
+}
+
+// parseDocument 解析toml文档
+func parseDocument(content string) (*document, error) {
+	raws := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if n := len(raws); n > 0 && len(raws[n-1]) == 0 {
+		raws = raws[:n-1]
+	}
+	doc := &document{lines: raws, data: make(map[string]any)}
+	current := doc.data
+	var table []string
+	var sec *section
+	for i := 0; i < len(raws); i++ {
+		text := strings.TrimSpace(stripComment(raws[i]))
+		if len(text) == 0 {
+			continue
+		}
+
+		// [table] 或 [[array]]
+		if text[0] == '[' {
+			array := strings.HasPrefix(text, "[[")
+			open, closing := "[", "]"
+			if array {
+				open, closing = "[[", "]]"
+			}
+			if !strings.HasSuffix(text, closing) {
+				return nil, fmt.Errorf("toml: line %d: invalid table header", i+1)
+			}
+			path, err := parseKey(text[len(open) : len(text)-len(closing)])
+			if nil != err {
+				return nil, fmt.Errorf("toml: line %d: %s", i+1, err.Error())
+			}
+			if current, err = doc.table(path, array); nil != err {
+				return nil, fmt.Errorf("toml: line %d: %s", i+1, err.Error())
+			}
+			table = path
+			sec = &section{path: path, array: array, start: i, end: i + 1}
+			doc.sections = append(doc.sections, sec)
+			continue
+		}
+
+		// key = value
+		eq := indexOutsideQuotes(raws[i], '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("toml: line %d: expected key = value", i+1)
+		}
+		keys, err := parseKey(raws[i][:eq])
+		if nil != err {
+			return nil, fmt.Errorf("toml: line %d: %s", i+1, err.Error())
+		}
+		start := i
+		src := raws[i][eq+1:]
+		vp := &valueParser{s: src}
+		val, err := vp.parseValue(true)
+		for err == errIncomplete && i+1 < len(raws) {
+			i++
+			src += "\n" + raws[i]
+			vp = &valueParser{s: src}
+			val, err = vp.parseValue(true)
+		}
+		if nil == err {
+			if vp.skip(false); vp.i < len(vp.s) && vp.s[vp.i] != '#' {
+				err = fmt.Errorf("unexpected content after value: %s", vp.s[vp.i:])
+			}
+		}
+		if nil != err {
+			return nil, fmt.Errorf("toml: line %d: %s", start+1, err.Error())
+		}
+		if err = setKeyValue(current, keys, val); nil != err {
+			return nil, fmt.Errorf("toml: line %d: %s", start+1, err.Error())
+		}
+		doc.entries = append(doc.entries, &entry{
+			path:  append(table[:len(table):len(table)], keys...),
+			table: table,
+			key:   strings.TrimRight(raws[start][:eq], " \t"),
+			start: start,
+			end:   i + 1,
+		})
+		if nil == sec {
+			doc.rootEnd = i + 1
+		} else {
+			sec.end = i + 1
+		}
+	}
+	return doc, nil
+}
+
+// content 文档内容
+func (doc *document) content() string {
+	if len(doc.lines) == 0 {
+		return ""
+	}
+	return strings.Join(doc.lines, "\n") + "\n"
+}
+
+// table 获取或创建表, array 为 true 时在数组表中追加一个表
+func (doc *document) table(path []string, array bool) (map[string]any, error) {
+	current := doc.data
+	for i, k := range path {
+		last := i == len(path)-1
+		switch v := current[k].(type) {
+		case nil:
+			if last && array {
+				child := make(map[string]any)
+				current[k] = []any{child}
+				return child, nil
+			}
+			child := make(map[string]any)
+			current[k] = child
+			current = child
+		case map[string]any:
+			if last && array {
+				return nil, fmt.Errorf("key %s is already defined as a table", strings.Join(path, "."))
+			}
+			current = v
+		case []any:
+			if len(v) == 0 {
+				return nil, fmt.Errorf("key %s is not a table", strings.Join(path[:i+1], "."))
+			}
+			if last && array {
+				child := make(map[string]any)
+				current[k] = append(v, child)
+				return child, nil
+			}
+			child, ok := v[len(v)-1].(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("key %s is not a table", strings.Join(path[:i+1], "."))
+			}
+			current = child
+		default:
+			return nil, fmt.Errorf("key %s is not a table", strings.Join(path[:i+1], "."))
+		}
+	}
+	return current, nil
+}
+
+// entry 查找 key = value 行, 不包含数组表中的行
+func (doc *document) entry(path []string) *entry {
+	key := strings.Join(path, ".")
+	for _, e := range doc.entries {
+		if strings.Join(e.path, ".") == key && !doc.inArray(e.table) {
+			return e
+		}
+	}
+	return nil
+}
+
+// section 查找 [table] 表头
+func (doc *document) section(path []string) *section {
+	key := strings.Join(path, ".")
+	for _, s := range doc.sections {
+		if !s.array && strings.Join(s.path, ".") == key && !doc.inArray(s.path) {
+			return s
+		}
+	}
+	return nil
+}
+
+// inArray 路径是否在数组表中
+func (doc *document) inArray(path []string) bool {
+	for _, s := range doc.sections {
+		if s.array && hasPrefix(path, s.path) {
+			return true
+		}
+	}
+	return false
+}
+
+// setKeyValue 在表中设置值, key 可以是 a.b.c 形式
+func setKeyValue(table map[string]any, keys []string, val any) error {
+	for i, k := range keys {
+		if i == len(keys)-1 {
+			if _, ok := table[k]; ok {
+				return fmt.Errorf("duplicate key: %s", strings.Join(keys, "."))
+			}
+			table[k] = val
+			break
+		}
+		switch v := table[k].(type) {
+		case nil:
+			child := make(map[string]any)
+			table[k] = child
+			table = child
+		case map[string]any:
+			table = v
+		default:
+			return fmt.Errorf("key %s is not a table", strings.Join(keys[:i+1], "."))
+		}
+	}
+	return nil
+}
+
+// valueParser 值解析器
+type valueParser struct {
+	s string
+	i int
+}
+
+// skip 跳过空白, newline 为 true 时同时跳过换行和注释
+func (vp *valueParser) skip(newline bool) {
+	for vp.i < len(vp.s) {
+		switch c := vp.s[vp.i]; {
+		case c == ' ' || c == '\t':
+			vp.i++
+		case newline && (c == '\n' || c == '\r'):
+			vp.i++
+		case newline && c == '#':
+			if end := strings.IndexByte(vp.s[vp.i:], '\n'); end > 0 {
+				vp.i += end
+			} else {
+				vp.i = len(vp.s)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// parseValue 解析一个值, top 为 true 时表示 key = 之后的值
+func (vp *valueParser) parseValue(top bool) (any, error) {
+	if vp.skip(false); vp.i >= len(vp.s) {
+		if top {
+			return nil, errors.New("missing value")
+		}
+		return nil, errIncomplete
+	}
+	s := vp.s[vp.i:]
+	switch {
+	case strings.HasPrefix(s, `"""`) || strings.HasPrefix(s, "'''"):
+		end := strings.Index(s[3:], s[:3])
+		if end < 0 {
+			return nil, errIncomplete
+		}
+		// 结束符前允许最多两个引号
+		for extra := 0; extra < 2 && 3+end+3 < len(s) && s[3+end+3] == s[0]; extra++ {
+			end++
+		}
+		vp.i += end + 6
+		text := strings.TrimPrefix(strings.TrimPrefix(s[3:3+end], "\r"), "\n")
+		if s[0] == '\'' {
+			return text, nil
+		}
+		return unescape(lineEndingBackslashReg.ReplaceAllString(text, ""))
+
+	case s[0] == '"':
+		for j := 1; j < len(s); j++ {
+			if s[j] == '\\' {
+				j++
+			} else if s[j] == '\n' {
+				break
+			} else if s[j] == '"' {
+				vp.i += j + 1
+				return unescape(s[1:j])
+			}
+		}
+		return nil, errors.New("unterminated string")
+
+	case s[0] == '\'':
+		if end := strings.IndexAny(s[1:], "'\n"); end >= 0 && s[1+end] == '\'' {
+			vp.i += end + 2
+			return s[1 : end+1], nil
+		}
+		return nil, errors.New("unterminated string")
+
+	case s[0] == '[':
+		vp.i++
+		res := make([]any, 0)
+		for {
+			if vp.skip(true); vp.i >= len(vp.s) {
+				return nil, errIncomplete
+			} else if vp.s[vp.i] == ']' {
+				vp.i++
+				return res, nil
+			}
+			val, err := vp.parseValue(false)
+			if nil != err {
+				return nil, err
+			}
+			res = append(res, val)
+			if vp.skip(true); vp.i >= len(vp.s) {
+				return nil, errIncomplete
+			} else if vp.s[vp.i] == ',' {
+				vp.i++
+			} else if vp.s[vp.i] != ']' {
+				return nil, fmt.Errorf("unexpected character '%c' in array", vp.s[vp.i])
+			}
+		}
+
+	case s[0] == '{':
+		vp.i++
+		res := make(map[string]any)
+		for {
+			if vp.skip(true); vp.i >= len(vp.s) {
+				return nil, errIncomplete
+			} else if vp.s[vp.i] == '}' {
+				vp.i++
+				return res, nil
+			}
+			eq := indexOutsideQuotes(vp.s[vp.i:], '=')
+			if eq < 0 {
+				return nil, errIncomplete
+			}
+			keys, err := parseKey(vp.s[vp.i : vp.i+eq])
+			if nil != err {
+				return nil, err
+			}
+			vp.i += eq + 1
+			val, err := vp.parseValue(false)
+			if nil != err {
+				return nil, err
+			}
+			if err = setKeyValue(res, keys, val); nil != err {
+				return nil, err
+			}
+			if vp.skip(true); vp.i >= len(vp.s) {
+				return nil, errIncomplete
+			} else if vp.s[vp.i] == ',' {
+				vp.i++
+			} else if vp.s[vp.i] != '}' {
+				return nil, fmt.Errorf("unexpected character '%c' in inline table", vp.s[vp.i])
+			}
+		}
+	}
+
+	end := strings.IndexAny(s, ",]}#\n")
+	if end < 0 {
+		end = len(s)
+	}
+	vp.i += end
+	return parseScalar(strings.TrimSpace(s[:end]))
+}
+
+// parseScalar 解析布尔、数字和日期时间
+func parseScalar(s string) (any, error) {
+	switch s {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan", "+nan", "-nan":
+		return math.NaN(), nil
+	}
+	if intReg.MatchString(s) || floatReg.MatchString(s) {
+		return json.Number(strings.TrimPrefix(strings.ReplaceAll(s, "_", ""), "+")), nil
+	}
+	if radixIntReg.MatchString(s) {
+		base := map[byte]int{'x': 16, 'o': 8, 'b': 2}[s[1]]
+		v, err := strconv.ParseInt(strings.ReplaceAll(s[2:], "_", ""), base, 64)
+		if nil != err {
+			return nil, err
+		}
+		return json.Number(strconv.FormatInt(v, 10)), nil
+	}
+	if datetimeReg.MatchString(s) {
+		return s, nil
+	}
+	return nil, fmt.Errorf("invalid value: %s", s)
+}
+
+// unescape 处理基本字符串中的转义
+func unescape(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			sb.WriteByte(s[i])
+			continue
+		}
+		if i++; i >= len(s) {
+			return "", errors.New("invalid escape sequence")
+		}
+		switch s[i] {
+		case 'b':
+			sb.WriteByte('\b')
+		case 't':
+			sb.WriteByte('\t')
+		case 'n':
+			sb.WriteByte('\n')
+		case 'f':
+			sb.WriteByte('\f')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'e':
+			sb.WriteByte(0x1b)
+		case '"', '\\':
+			sb.WriteByte(s[i])
+		case 'u', 'U':
+			size := 4
+			if s[i] == 'U' {
+				size = 8
+			}
+			if i+size >= len(s) {
+				return "", errors.New("invalid unicode escape")
+			}
+			r, err := strconv.ParseUint(s[i+1:i+1+size], 16, 32)
+			if nil != err {
+				return "", err
+			}
+			sb.WriteRune(rune(r))
+			i += size
+		default:
+			return "", fmt.Errorf("invalid escape sequence: \\%c", s[i])
+		}
+	}
+	return sb.String(), nil
+}
+
+// parseKey 解析 key, 支持 a."b.c".d 形式
+func parseKey(s string) ([]string, error) {
+	res := make([]string, 0)
+	for s = strings.TrimSpace(s); ; {
+		var key string
+		if len(s) > 0 && (s[0] == '"' || s[0] == '\'') {
+			end := strings.IndexByte(s[1:], s[0])
+			for s[0] == '"' && end > 0 && s[end] == '\\' {
+				if next := strings.IndexByte(s[end+2:], '"'); next >= 0 {
+					end += next + 1
+				} else {
+					end = -1
+				}
+			}
+			if end < 0 {
+				return nil, errors.New("unterminated quoted key")
+			}
+			key = s[1 : end+1]
+			if s[0] == '"' {
+				var err error
+				if key, err = unescape(key); nil != err {
+					return nil, err
+				}
+			}
+			s = strings.TrimSpace(s[end+2:])
+		} else {
+			end := strings.IndexByte(s, '.')
+			if end < 0 {
+				end = len(s)
+			}
+			if key = strings.TrimSpace(s[:end]); !bareKeyReg.MatchString(key) {
+				return nil, fmt.Errorf("invalid key: %s", key)
+			}
+			s = s[end:]
+		}
+		res = append(res, key)
+		if len(s) == 0 {
+			return res, nil
+		} else if s[0] != '.' {
+			return nil, fmt.Errorf("invalid key: %s", s)
+		}
+		s = strings.TrimSpace(s[1:])
+	}
+}
+
+// indexOutsideQuotes 查找引号外的字符
+func indexOutsideQuotes(s string, c byte) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		if quote == 0 {
+			if s[i] == c {
+				return i
+			} else if s[i] == '"' || s[i] == '\'' {
+				quote = s[i]
+			}
+		} else if quote == '"' && s[i] == '\\' {
+			i++
+		} else if s[i] == quote {
+			quote = 0
+		}
+	}
+	return -1
+}
+
+// stripComment 去掉行内注释
+func stripComment(s string) string {
+	if i := indexOutsideQuotes(s, '#'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
+
+// trailingComment 获取行尾注释, 包含前导空格
+func trailingComment(s string) string {
+	if i := indexOutsideQuotes(s, '#'); i > 0 && len(strings.TrimSpace(s[:i])) > 0 {
+		return " " + strings.TrimSpace(s[i:])
+	}
+	return ""
+}
+
+// hasPrefix path 是否以 prefix 开头
+func hasPrefix(path, prefix []string) bool {
+	if len(path) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// formatKey 格式化 key
+func formatKey(keys ...string) string {
+	res := make([]string, len(keys))
+	for i, k := range keys {
+		if bareKeyReg.MatchString(k) {
+			res[i] = k
+		} else {
+			res[i] = quoteString(k)
+		}
+	}
+	return strings.Join(res, ".")
+}
+
+// formatValue 格式化行内的值
+func formatValue(val any) (string, error) {
+	switch v := val.(type) {
+	case nil:
+		return "", errors.New("toml: null values are not supported")
+	case string:
+		return quoteString(v), nil
+	case float64:
+		if math.IsNaN(v) {
+			return "nan", nil
+		} else if math.IsInf(v, 1) {
+			return "inf", nil
+		} else if math.IsInf(v, -1) {
+			return "-inf", nil
+		}
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eE") {
+			s += ".0"
+		}
+		return s, nil
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			s, err := formatValue(item)
+			if nil != err {
+				return "", err
+			}
+			items[i] = s
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case map[string]any:
+		if len(v) == 0 {
+			return "{}", nil
+		}
+		items := make([]string, 0, len(v))
+		for _, k := range sortedKeys(v) {
+			s, err := formatValue(v[k])
+			if nil != err {
+				return "", err
+			}
+			items = append(items, formatKey(k)+" = "+s)
+		}
+		return "{ " + strings.Join(items, ", ") + " }", nil
+	}
+	return fmt.Sprint(val), nil
+}
+
+// renderTable 渲染 [table], 非空的子表渲染为 [table.sub]
+func renderTable(path []string, table map[string]any) ([]string, error) {
+	lines := []string{"[" + formatKey(path...) + "]"}
+	subs := make([]string, 0)
+	for _, k := range sortedKeys(table) {
+		if sub, ok := table[k].(map[string]any); ok && len(sub) > 0 {
+			rendered, err := renderTable(append(path[:len(path):len(path)], k), sub)
+			if nil != err {
+				return nil, err
+			}
+			subs = append(append(subs, ""), rendered...)
+			continue
+		}
+		s, err := formatValue(table[k])
+		if nil != err {
+			return nil, err
+		}
+		lines = append(lines, formatKey(k)+" = "+s)
+	}
+	return append(lines, subs...), nil
+}
+
+// quoteString 格式化为基本字符串
+func quoteString(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			sb.WriteString(`\"`)
+		case '\\':
+			sb.WriteString(`\\`)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\t':
+			sb.WriteString(`\t`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\b':
+			sb.WriteString(`\b`)
+		case '\f':
+			sb.WriteString(`\f`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&sb, `\u%04X`, r)
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// sortedKeys 排序后的key
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
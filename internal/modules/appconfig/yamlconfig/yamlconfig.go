@@ -0,0 +1,236 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 配置工具-YAML文件实现, 回写时保留注释
+// 依赖包: utypes.Object fileutil
+
+package yamlconfig
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/wup364/pakku/internal/modules/appconfig/confutils"
+	"github.com/wup364/pakku/ipakku"
+	"github.com/wup364/pakku/pkg/fileutil"
+	"github.com/wup364/pakku/pkg/strutil"
+	"github.com/wup364/pakku/pkg/utypes"
+)
+
+func init() {
+	// 注册实例实现
+	ipakku.PakkuConf.RegisterPakkuModuleImplement(new(Config), "IConfig", "yaml")
+}
+
+// Config yaml配置器
+type Config struct {
+	doc        *document
+	configPath string
+	configDir  string
+	watcher    *confutils.FileWatcher
+	l          *sync.RWMutex
+}
+
+// SetConfigDir 设置配置文件所在目录, 默认 .conf
+func (config *Config) SetConfigDir(dir string) {
+	config.configDir = dir
+}
+
+// getConfigDir 配置文件所在目录
+func (config *Config) getConfigDir() string {
+	if len(config.configDir) > 0 {
+		return config.configDir
+	}
+	return ipakku.DEFT_VAL_CONFIG_DIR
+}
+
+// Init 初始化解析器, 优先使用已存在的 .yaml 或 .yml 文件
+func (config *Config) Init(appName string) error {
+	path := filepath.Join(config.getConfigDir(), appName+".yaml")
+	if yml := filepath.Join(config.getConfigDir(), appName+".yml"); !fileutil.IsFile(path) && fileutil.IsFile(yml) {
+		path = yml
+	}
+	path, err := filepath.Abs(path)
+	if nil != err {
+		return err
+	}
+	return config.InitConfig(path)
+}
+
+// InitConfig 初始化解析器
+func (config *Config) InitConfig(configPath string) error {
+	if len(configPath) == 0 {
+		return errors.New("config file path is empty")
+	}
+	// 创建父级目录
+	parent := strutil.GetPathParent(configPath)
+	if !fileutil.IsExist(parent) {
+		err := fileutil.MkdirAll(parent)
+		if nil != err {
+			return err
+		}
+	}
+	config.configPath = configPath
+	// 文件不存在则创建
+	if !fileutil.IsFile(config.configPath) {
+		err := config.writeFile(config.configPath, "")
+		if nil != err {
+			return err
+		}
+	}
+
+	config.l = new(sync.RWMutex)
+	config.l.Lock()
+	defer config.l.Unlock()
+	config.watcher = confutils.NewFileWatcher(config.configPath)
+	data, err := os.ReadFile(config.configPath)
+	if nil != err {
+		return err
+	}
+	config.doc, err = parseDocument(string(data))
+	return err
+}
+
+// Reload 配置文件发生变化时重新加载
+func (config *Config) Reload() (bool, error) {
+	if changed, err := config.watcher.Changed(); nil != err || !changed {
+		return false, err
+	}
+	data, err := os.ReadFile(config.configPath)
+	if nil != err {
+		return false, err
+	}
+	doc, err := parseDocument(string(data))
+	if nil != err {
+		return false, err
+	}
+	config.l.Lock()
+	defer config.l.Unlock()
+	config.doc = doc
+	return true, nil
+}
+
+// GetConfig 读取key的value信息
+// 返回ConfigBody对象, 里面的值可能是string或者map
+func (config *Config) GetConfig(key string) (res utypes.Object) {
+	config.l.RLock()
+	defer config.l.RUnlock()
+	if val := confutils.GetDottedValue(config.doc.data, key); nil != val {
+		res = utypes.NewObject(val)
+	}
+	return
+}
+
+// SetConfig 保存配置
+func (config *Config) SetConfig(key string, value any) error {
+	if len(key) == 0 || nil == value {
+		return errors.New("key or value is empty")
+	}
+	val, err := confutils.NormalizeValue(value)
+	if nil != err {
+		return err
+	}
+	config.l.Lock()
+	defer config.l.Unlock()
+	doc := config.doc
+	if err = config.setValue(strings.Split(key, "."), val); nil != err {
+		config.doc = doc
+		return err
+	}
+	return config.writeFile(config.configPath, config.doc.content())
+}
+
+// setValue 修改文档中的值, 未修改的行及注释保持不变
+func (config *Config) setValue(keys []string, value any) error {
+	doc := config.doc
+	if n, ok := doc.nodes[strings.Join(keys, ".")]; ok {
+		if vmap, ok := value.(map[string]any); ok && len(vmap) > 0 && n.child >= 0 {
+			return config.mergeValue(keys, vmap)
+		}
+		lines := renderEntry(keys[len(keys)-1], value, n.indent)
+		lines[0] += trailingComment(doc.lines[n.start])
+		return config.replace(n.start, n.end, lines)
+	}
+
+	// 查找已存在的上级节点
+	for i := len(keys) - 1; i > 0; i-- {
+		n, ok := doc.nodes[strings.Join(keys[:i], ".")]
+		if !ok {
+			continue
+		}
+		if n.child < 0 {
+			// 上级的值不是 mapping, 整体替换
+			lines := renderEntry(keys[i-1], nestValue(keys[i:], value), n.indent)
+			lines[0] += trailingComment(doc.lines[n.start])
+			return config.replace(n.start, n.end, lines)
+		}
+		return config.replace(n.end, n.end, renderEntry(keys[i], nestValue(keys[i+1:], value), n.child))
+	}
+	return config.replace(doc.last, doc.last, renderEntry(keys[0], nestValue(keys[1:], value), doc.indent))
+}
+
+// mergeValue 逐个设置 mapping 的子节点, 并删除不存在的子节点, 以保留子节点上的注释
+func (config *Config) mergeValue(keys []string, value map[string]any) error {
+	for _, k := range sortedKeys(value) {
+		if err := config.setValue(append(keys[:len(keys):len(keys)], k), value[k]); nil != err {
+			return err
+		}
+	}
+	path := strings.Join(keys, ".")
+	if old, ok := confutils.GetDottedValue(config.doc.data, path).(map[string]any); ok {
+		for _, k := range sortedKeys(old) {
+			if _, ok := value[k]; ok {
+				continue
+			}
+			if n, ok := config.doc.nodes[path+"."+k]; ok {
+				if err := config.replace(n.start, n.end, nil); nil != err {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// replace 替换 [start, end) 行并重新解析文档
+func (config *Config) replace(start, end int, lines []string) error {
+	raws := make([]string, 0, len(config.doc.lines)+len(lines))
+	raws = append(raws, config.doc.lines[:start]...)
+	raws = append(raws, lines...)
+	raws = append(raws, config.doc.lines[end:]...)
+	doc, err := parseDocument(strings.Join(raws, "\n"))
+	if nil != err {
+		return err
+	}
+	config.doc = doc
+	return nil
+}
+
+// writeFile 写入文件
+func (config *Config) writeFile(path string, content string) error {
+	if len(path) == 0 {
+		return fileutil.PathNotExist("WriteFile", path)
+	}
+	fp, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	defer func() {
+		if nil != fp {
+			fp.Close()
+		}
+	}()
+
+	if err == nil {
+		_, err = fp.WriteString(content)
+	}
+	return err
+}
+
+// nestValue 按 keys 将 value 包装为嵌套的 map
+func nestValue(keys []string, value any) any {
+	for i := len(keys) - 1; i >= 0; i-- {
+		value = map[string]any{keys[i]: value}
+	}
+	return value
+}
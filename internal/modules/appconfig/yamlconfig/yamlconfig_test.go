@@ -0,0 +1,157 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+package yamlconfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testYAML = `# 服务配置
+service:
+  # 监听地址
+  addr: ":8080"   # 默认端口
+  ReadTimeoutSecond: 10
+  cors: [a.com, "b.com"]
+  static:
+    - path: /www
+      dir: ./www
+    - path: /docs
+      dir: ./docs
+name: 'it''s pakku'
+debug: true
+empty:
+desc: |
+  line1
+  line2
+folded: >-
+  a
+  b
+`
+
+func TestYamlConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(path, []byte(testYAML), 0666); nil != err {
+		t.Fatal(err)
+	}
+	config := new(Config)
+	if err := config.InitConfig(path); nil != err {
+		t.Fatal(err)
+	}
+
+	if val := config.GetConfig("service.addr").ToString(""); val != ":8080" {
+		t.Fatalf("service.addr = %s", val)
+	}
+	if val := config.GetConfig("service.ReadTimeoutSecond").ToInt(0); val != 10 {
+		t.Fatalf("service.ReadTimeoutSecond = %d", val)
+	}
+	if val := config.GetConfig("service.cors").GetVal(); !reflect.DeepEqual(val, []any{"a.com", "b.com"}) {
+		t.Fatalf("service.cors = %v", val)
+	}
+	static, ok := config.GetConfig("service.static").GetVal().([]any)
+	if !ok || len(static) != 2 || static[1].(map[string]any)["dir"] != "./docs" {
+		t.Fatalf("service.static = %v", static)
+	}
+	if val := config.GetConfig("name").ToString(""); val != "it's pakku" {
+		t.Fatalf("name = %s", val)
+	}
+	if val := config.GetConfig("debug").ToBool(false); !val {
+		t.Fatal("debug = false")
+	}
+	if val := config.GetConfig("empty"); !val.IsNill() {
+		t.Fatalf("empty = %v", val.GetVal())
+	}
+	if val := config.GetConfig("desc").ToString(""); val != "line1\nline2\n" {
+		t.Fatalf("desc = %q", val)
+	}
+	if val := config.GetConfig("folded").ToString(""); val != "a b" {
+		t.Fatalf("folded = %q", val)
+	}
+
+	// 回写保留注释
+	if err := config.SetConfig("service.addr", ":9090"); nil != err {
+		t.Fatal(err)
+	}
+	if err := config.SetConfig("service.tls.enable", true); nil != err {
+		t.Fatal(err)
+	}
+	if err := config.SetConfig("empty.key", "value: with colon"); nil != err {
+		t.Fatal(err)
+	}
+	if err := config.SetConfig("log", map[string]any{"level": "debug", "files": []string{"a.log"}}); nil != err {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+	content := string(data)
+	for _, expect := range []string{"# 服务配置", "  # 监听地址", `  addr: ":9090" # 默认端口`, "    enable: true", `  key: "value: with colon"`, "  files:\n    - a.log"} {
+		if !strings.Contains(content, expect) {
+			t.Fatalf("%q not found in:\n%s", expect, content)
+		}
+	}
+
+	// 重新读取
+	if err := config.InitConfig(path); nil != err {
+		t.Fatal(err)
+	}
+	if val := config.GetConfig("service.tls.enable").ToBool(false); !val {
+		t.Fatalf("service.tls.enable = false\n%s", content)
+	}
+	if val := config.GetConfig("service.ReadTimeoutSecond").ToInt(0); val != 10 {
+		t.Fatalf("service.ReadTimeoutSecond = %d", val)
+	}
+	if val := config.GetConfig("log.level").ToString(""); val != "debug" {
+		t.Fatalf("log.level = %s", val)
+	}
+
+	// 替换 mapping, 删除不存在的子节点
+	if err := config.SetConfig("service", map[string]any{"addr": ":7070"}); nil != err {
+		t.Fatal(err)
+	}
+	if val := config.GetConfig("service").ToStrMap(nil); len(val) != 1 || val["addr"] != ":7070" {
+		t.Fatalf("service = %v", val)
+	}
+
+	// 文件变化后重新加载
+	if err := os.WriteFile(path, []byte("service:\n  addr: \":6060\"\n"), 0666); nil != err {
+		t.Fatal(err)
+	}
+	if changed, err := config.Reload(); nil != err || !changed {
+		t.Fatalf("changed = %v, err = %v", changed, err)
+	}
+	if val := config.GetConfig("service.addr").ToString(""); val != ":6060" {
+		t.Fatalf("service.addr = %s", val)
+	}
+	if changed, err := config.Reload(); nil != err || changed {
+		t.Fatalf("changed = %v, err = %v", changed, err)
+	}
+}
+
+func TestYamlUnsupported(t *testing.T) {
+	for content, msg := range map[string]string{
+		"base: &base\n  addr: :80\n":     "anchors are not supported",
+		"service: *base\n":               "aliases are not supported",
+		"service:\n  <<: *base\n":        "aliases are not supported",
+		"list:\n  - *item\n":             "aliases are not supported",
+		"list: [a, *item]\n":             "aliases are not supported",
+		"name: !!str 123\n":              "tags are not supported",
+		"%YAML 1.2\n---\nname: a\n":      "directives are not supported",
+		"name: a\n---\nname: b\n":        "multiple documents",
+		"name: @value\n":                 "reserved indicator",
+		"? complex key\n: value\n":       "expected a mapping key",
+		"---\nname: a\nlist: [\"*a\"]\n": "",
+	} {
+		_, err := parseDocument(content)
+		if len(msg) == 0 && nil != err {
+			t.Fatalf("%q: unexpected error: %v", content, err)
+		} else if len(msg) > 0 && (nil == err || !strings.Contains(err.Error(), msg)) {
+			t.Fatalf("%q: unexpected error: %v", content, err)
+		}
+	}
+}
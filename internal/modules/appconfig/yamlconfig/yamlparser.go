@@ -0,0 +1,659 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 配置工具-YAML解析
+// 支持 mapping、sequence、flow([]、{})、引号字符串、块字符串(|、>), 不支持锚点、别名、标签、指令和多文档, 遇到时返回错误
+
+package yamlconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// numberReg yaml 数字
+	numberReg = regexp.MustCompile(`^[-+]?(\d+(\.\d*)?|\.\d+)([eE][-+]?\d+)?$`)
+	// jsonNumberReg json 数字
+	jsonNumberReg = regexp.MustCompile(`^-?(0|[1-9]\d*)(\.\d+)?([eE][-+]?\d+)?$`)
+)
+
+// document 解析后的yaml文档, 保留原始行用于回写
+type document struct {
+	lines  []string
+	data   map[string]any
+	nodes  map[string]*node
+	indent int // 根节点缩进
+	last   int // 最后一个有效行+1
+}
+
+// node 可寻址(不在 sequence 内)的 mapping 节点, 记录其所在的行范围
+type node struct {
+	indent int // key 的缩进
+	start  int // 起始行
+	end    int // 结束行(不含)
+	child  int // 子节点缩进, -1 表示值不是 mapping
+}
+
+// line 有效行, text 不含缩进和注释
+type line struct {
+	no     int
+	indent int
+	text   string
+}
+
+// parser yaml解析器
+type parser struct {
+	raws  []string
+	lines []line
+	pos   int
+	end   int
+	nodes map[string]*node
+}
+
+// parseDocument 解析yaml文档
+func parseDocument(content string) (*document, error) {
+	raws := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+	if n := len(raws); n > 0 && len(raws[n-1]) == 0 {
+		raws = raws[:n-1]
+	}
+	p := &parser{raws: raws, nodes: make(map[string]*node)}
+	for i, raw := range raws {
+		text := strings.TrimRight(stripComment(raw), " \t")
+		trimmed := strings.TrimSpace(text)
+		if trimmed == "---" || strings.HasPrefix(trimmed, "--- ") {
+			if len(p.lines) > 0 || trimmed != "---" {
+				return nil, fmt.Errorf("yaml: line %d: multiple documents or content after '---' are not supported", i+1)
+			}
+			continue
+		} else if len(trimmed) == 0 || trimmed == "..." {
+			continue
+		} else if trimmed[0] == '%' {
+			return nil, fmt.Errorf("yaml: line %d: directives are not supported", i+1)
+		}
+		indent := len(text) - len(strings.TrimLeft(text, " "))
+		if text[indent] == '\t' {
+			return nil, fmt.Errorf("yaml: line %d: tabs are not allowed for indentation", i+1)
+		}
+		p.lines = append(p.lines, line{no: i, indent: indent, text: text[indent:]})
+	}
+
+	doc := &document{lines: raws, data: make(map[string]any), nodes: p.nodes, last: len(raws)}
+	if len(p.lines) == 0 {
+		return doc, nil
+	}
+	doc.indent = p.lines[0].indent
+	if isSeqItem(p.lines[0].text) {
+		return nil, fmt.Errorf("yaml: line %d: the root node must be a mapping", p.lines[0].no+1)
+	}
+	data, err := p.parseMap(doc.indent, nil, true)
+	if nil != err {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, p.errorf(p.lines[p.pos], "bad indentation")
+	}
+	doc.data = data
+	doc.last = p.end
+	return doc, nil
+}
+
+// content 文档内容
+func (doc *document) content() string {
+	if len(doc.lines) == 0 {
+		return ""
+	}
+	return strings.Join(doc.lines, "\n") + "\n"
+}
+
+// parseMap 解析 mapping, addr 为 true 时记录节点位置
+func (p *parser) parseMap(indent int, prefix []string, addr bool) (map[string]any, error) {
+	res := make(map[string]any)
+	for p.pos < len(p.lines) {
+		ln := p.lines[p.pos]
+		if ln.indent < indent {
+			break
+		} else if ln.indent > indent || isSeqItem(ln.text) {
+			return nil, p.errorf(ln, "bad indentation")
+		}
+		key, rest, ok := splitKey(ln.text)
+		if !ok {
+			return nil, p.errorf(ln, "expected a mapping key")
+		}
+		if _, ok := res[key]; ok {
+			return nil, p.errorf(ln, "duplicate key: "+key)
+		}
+		p.pos++
+		p.end = ln.no + 1
+
+		var err error
+		var val any
+		path := append(prefix[:len(prefix):len(prefix)], key)
+		n := &node{indent: indent, start: ln.no, child: -1}
+		if len(rest) == 0 {
+			val, err = p.parseNested(indent, true, path, addr, n)
+		} else if rest[0] == '|' || rest[0] == '>' {
+			val = p.parseBlockScalar(ln, indent, rest)
+		} else if val, err = parseInline(rest); nil != err {
+			err = p.errorf(ln, err.Error())
+		}
+		if nil != err {
+			return nil, err
+		}
+		res[key] = val
+		if n.end = p.end; addr {
+			p.nodes[strings.Join(path, ".")] = n
+		}
+	}
+	return res, nil
+}
+
+// parseNested 解析下一级的块, seq 为 true 时允许同级缩进的 sequence
+func (p *parser) parseNested(indent int, seq bool, path []string, addr bool, n *node) (any, error) {
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+	next := p.lines[p.pos]
+	if next.indent > indent {
+		if isSeqItem(next.text) {
+			return p.parseSeq(next.indent)
+		}
+		n.child = next.indent
+		return p.parseMap(next.indent, path, addr)
+	} else if seq && next.indent == indent && isSeqItem(next.text) {
+		return p.parseSeq(indent)
+	}
+	return nil, nil
+}
+
+// parseSeq 解析 sequence
+func (p *parser) parseSeq(indent int) ([]any, error) {
+	res := make([]any, 0)
+	for p.pos < len(p.lines) {
+		ln := p.lines[p.pos]
+		if ln.indent < indent || (ln.indent == indent && !isSeqItem(ln.text)) {
+			break
+		} else if ln.indent > indent {
+			return nil, p.errorf(ln, "bad indentation")
+		}
+
+		var err error
+		var val any
+		rest := strings.TrimLeft(ln.text[1:], " ")
+		if len(rest) == 0 {
+			p.pos++
+			p.end = ln.no + 1
+			val, err = p.parseNested(indent, false, nil, false, &node{})
+		} else if rest[0] == '|' || rest[0] == '>' {
+			p.pos++
+			p.end = ln.no + 1
+			val = p.parseBlockScalar(ln, indent, rest)
+		} else if _, _, ok := splitKey(rest); ok || isSeqItem(rest) {
+			// 将 "- " 之后的内容作为新的一行处理
+			p.lines[p.pos] = line{no: ln.no, indent: indent + len(ln.text) - len(rest), text: rest}
+			if ok {
+				val, err = p.parseMap(p.lines[p.pos].indent, nil, false)
+			} else {
+				val, err = p.parseSeq(p.lines[p.pos].indent)
+			}
+		} else {
+			p.pos++
+			p.end = ln.no + 1
+			if val, err = parseInline(rest); nil != err {
+				err = p.errorf(ln, err.Error())
+			}
+		}
+		if nil != err {
+			return nil, err
+		}
+		res = append(res, val)
+	}
+	return res, nil
+}
+
+// parseBlockScalar 解析块字符串, 调用前需已跳过 header 所在行
+func (p *parser) parseBlockScalar(ln line, indent int, header string) string {
+	var chomp rune
+	for _, c := range header[1:] {
+		if c == '-' || c == '+' {
+			chomp = c
+		}
+	}
+	end := ln.no + 1
+	blockIndent := -1
+	content := make([]string, 0)
+	for i := ln.no + 1; i < len(p.raws); i++ {
+		raw := p.raws[i]
+		if len(strings.TrimSpace(raw)) == 0 {
+			content = append(content, "")
+			continue
+		}
+		rawIndent := len(raw) - len(strings.TrimLeft(raw, " "))
+		if blockIndent < 0 {
+			if rawIndent <= indent {
+				break
+			}
+			blockIndent = rawIndent
+		}
+		if rawIndent < blockIndent {
+			break
+		}
+		content = append(content, raw[blockIndent:])
+		end = i + 1
+	}
+	body := content[:end-ln.no-1]
+	trail := len(content) - len(body)
+
+	var text string
+	if header[0] == '|' {
+		text = strings.Join(body, "\n")
+	} else {
+		var sb strings.Builder
+		for i, s := range body {
+			if i > 0 {
+				if len(s) == 0 {
+					sb.WriteByte('\n')
+					continue
+				} else if len(body[i-1]) > 0 {
+					sb.WriteByte(' ')
+				}
+			}
+			sb.WriteString(s)
+		}
+		text = sb.String()
+	}
+	if chomp == '+' {
+		text += strings.Repeat("\n", trail+1)
+	} else if chomp != '-' && len(body) > 0 {
+		text += "\n"
+	}
+
+	// 跳过块内的行
+	for p.pos < len(p.lines) && p.lines[p.pos].no < end {
+		p.pos++
+	}
+	p.end = end
+	return text
+}
+
+// errorf 解析错误
+func (p *parser) errorf(ln line, msg string) error {
+	return fmt.Errorf("yaml: line %d: %s", ln.no+1, msg)
+}
+
+// flowParser flow 风格([]、{})解析器
+type flowParser struct {
+	s string
+	i int
+}
+
+// skip 跳过空白
+func (fp *flowParser) skip() {
+	for fp.i < len(fp.s) && (fp.s[fp.i] == ' ' || fp.s[fp.i] == '\t') {
+		fp.i++
+	}
+}
+
+// parse 解析一个值
+func (fp *flowParser) parse() (any, error) {
+	if fp.skip(); fp.i >= len(fp.s) {
+		return nil, errors.New("unexpected end of flow value")
+	}
+	switch fp.s[fp.i] {
+	case '[':
+		fp.i++
+		res := make([]any, 0)
+		for {
+			if fp.skip(); fp.i < len(fp.s) && fp.s[fp.i] == ']' {
+				fp.i++
+				return res, nil
+			}
+			val, err := fp.parse()
+			if nil != err {
+				return nil, err
+			}
+			res = append(res, val)
+			if err = fp.next(']'); nil != err {
+				return nil, err
+			} else if fp.s[fp.i-1] == ']' {
+				return res, nil
+			}
+		}
+	case '{':
+		fp.i++
+		res := make(map[string]any)
+		for {
+			if fp.skip(); fp.i < len(fp.s) && fp.s[fp.i] == '}' {
+				fp.i++
+				return res, nil
+			}
+			key, err := fp.key()
+			if nil != err {
+				return nil, err
+			}
+			val, err := fp.parse()
+			if nil != err {
+				return nil, err
+			}
+			res[key] = val
+			if err = fp.next('}'); nil != err {
+				return nil, err
+			} else if fp.s[fp.i-1] == '}' {
+				return res, nil
+			}
+		}
+	case '"', '\'':
+		end := closingQuote(fp.s[fp.i:])
+		if end < 0 {
+			return nil, errors.New("unclosed quoted string")
+		}
+		val, err := parseQuoted(fp.s[fp.i : fp.i+end+1])
+		fp.i += end + 1
+		return val, err
+	}
+	if err := checkPlain(fp.s[fp.i:]); nil != err {
+		return nil, err
+	}
+	start := fp.i
+	for fp.i < len(fp.s) && strings.IndexByte(",]}", fp.s[fp.i]) < 0 {
+		fp.i++
+	}
+	return parsePlain(strings.TrimSpace(fp.s[start:fp.i])), nil
+}
+
+// key 解析 flow mapping 的 key, 包含其后的 ':'
+func (fp *flowParser) key() (string, error) {
+	var key string
+	if fp.s[fp.i] == '"' || fp.s[fp.i] == '\'' {
+		end := closingQuote(fp.s[fp.i:])
+		if end < 0 {
+			return "", errors.New("unclosed quoted string")
+		}
+		val, err := parseQuoted(fp.s[fp.i : fp.i+end+1])
+		if nil != err {
+			return "", err
+		}
+		key, fp.i = val, fp.i+end+1
+	} else {
+		start := fp.i
+		for fp.i < len(fp.s) && strings.IndexByte(":,}", fp.s[fp.i]) < 0 {
+			fp.i++
+		}
+		key = strings.TrimSpace(fp.s[start:fp.i])
+	}
+	if fp.skip(); fp.i >= len(fp.s) || fp.s[fp.i] != ':' {
+		return "", fmt.Errorf("missing ':' after flow mapping key: %s", key)
+	}
+	fp.i++
+	return key, nil
+}
+
+// next 跳过分隔符 ',' 或结束符
+func (fp *flowParser) next(closing byte) error {
+	if fp.skip(); fp.i >= len(fp.s) {
+		return errors.New("unexpected end of flow value")
+	}
+	if c := fp.s[fp.i]; c == ',' || c == closing {
+		fp.i++
+		return nil
+	}
+	return fmt.Errorf("unexpected character '%c' in flow value", fp.s[fp.i])
+}
+
+// parseInline 解析行内的值
+func parseInline(s string) (any, error) {
+	if s = strings.TrimSpace(s); len(s) == 0 {
+		return nil, nil
+	}
+	switch s[0] {
+	case '"', '\'':
+		if end := closingQuote(s); end != len(s)-1 {
+			return nil, fmt.Errorf("invalid quoted string: %s", s)
+		}
+		return parseQuoted(s)
+	case '[', '{':
+		fp := &flowParser{s: s}
+		val, err := fp.parse()
+		if fp.skip(); nil == err && fp.i < len(s) {
+			err = fmt.Errorf("unexpected content after flow value: %s", s[fp.i:])
+		}
+		return val, err
+	}
+	if err := checkPlain(s); nil != err {
+		return nil, err
+	}
+	return parsePlain(s), nil
+}
+
+// checkPlain 检查无引号的值, 以锚点(&)、别名(*)、标签(!)或保留字符(@、`)开头时返回错误, 避免被当作字符串读取
+func checkPlain(s string) error {
+	if len(s) == 0 {
+		return nil
+	}
+	switch s[0] {
+	case '&':
+		return fmt.Errorf("anchors are not supported: %s", s)
+	case '*':
+		return fmt.Errorf("aliases are not supported: %s", s)
+	case '!':
+		return fmt.Errorf("tags are not supported: %s", s)
+	case '@', '`':
+		return fmt.Errorf("reserved indicator '%c' is not supported: %s", s[0], s)
+	}
+	return nil
+}
+
+// parsePlain 解析无引号的值
+func parsePlain(s string) any {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if numberReg.MatchString(s) {
+		if s = strings.TrimPrefix(s, "+"); jsonNumberReg.MatchString(s) {
+			return json.Number(s)
+		}
+		if v, err := strconv.ParseInt(s, 10, 64); nil == err {
+			return json.Number(strconv.FormatInt(v, 10))
+		}
+		if v, err := strconv.ParseFloat(s, 64); nil == err {
+			return json.Number(strconv.FormatFloat(v, 'g', -1, 64))
+		}
+	}
+	return s
+}
+
+// parseQuoted 解析带引号的字符串
+func parseQuoted(s string) (string, error) {
+	if s[0] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	return strconv.Unquote(s)
+}
+
+// closingQuote 查找结束引号的位置, s 以引号开头
+func closingQuote(s string) int {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		if quote == '"' && s[i] == '\\' {
+			i++
+		} else if s[i] == quote {
+			if quote == '\'' && i+1 < len(s) && s[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+// stripComment 去掉行内注释
+func stripComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if quote == '"' {
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				quote = 0
+			}
+		} else if quote == '\'' {
+			if c == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					i++
+				} else {
+					quote = 0
+				}
+			}
+		} else if c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t') {
+			return s[:i]
+		} else if (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" \t[{,", s[i-1]) >= 0) {
+			quote = c
+		}
+	}
+	return s
+}
+
+// trailingComment 获取行尾注释, 包含前导空格
+func trailingComment(s string) string {
+	if comment := strings.TrimSpace(s[len(stripComment(s)):]); len(comment) > 0 && len(strings.TrimSpace(stripComment(s))) > 0 {
+		return " " + comment
+	}
+	return ""
+}
+
+// isSeqItem 是否是 sequence 的元素
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitKey 拆分 "key: value" 形式的行
+func splitKey(text string) (key, rest string, ok bool) {
+	if len(text) == 0 {
+		return
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		end := closingQuote(text)
+		if end < 0 {
+			return
+		}
+		var err error
+		if key, err = parseQuoted(text[:end+1]); nil != err {
+			return
+		}
+		if rest = strings.TrimLeft(text[end+1:], " "); !strings.HasPrefix(rest, ":") {
+			return
+		}
+		if rest = rest[1:]; len(rest) > 0 && rest[0] != ' ' && rest[0] != '\t' {
+			return
+		}
+		return key, strings.TrimSpace(rest), true
+	}
+	if strings.IndexByte("[{|>&*!%@`", text[0]) >= 0 {
+		return
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i == len(text)-1 || text[i+1] == ' ' || text[i+1] == '\t') {
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return
+}
+
+// renderEntry 渲染 key: value 节点
+func renderEntry(key string, val any, indent int) []string {
+	prefix := strings.Repeat(" ", indent) + formatString(key) + ":"
+	switch v := val.(type) {
+	case map[string]any:
+		if len(v) > 0 {
+			lines := []string{prefix}
+			for _, k := range sortedKeys(v) {
+				lines = append(lines, renderEntry(k, v[k], indent+2)...)
+			}
+			return lines
+		}
+	case []any:
+		if len(v) > 0 {
+			return append([]string{prefix}, renderItems(v, indent+2)...)
+		}
+	}
+	return []string{prefix + " " + formatScalar(val)}
+}
+
+// renderItems 渲染 sequence 的元素
+func renderItems(items []any, indent int) []string {
+	pad := strings.Repeat(" ", indent)
+	lines := make([]string, 0, len(items))
+	for _, item := range items {
+		var sub []string
+		switch v := item.(type) {
+		case map[string]any:
+			for _, k := range sortedKeys(v) {
+				sub = append(sub, renderEntry(k, v[k], indent+2)...)
+			}
+		case []any:
+			if len(v) > 0 {
+				sub = renderItems(v, indent+2)
+			}
+		}
+		if len(sub) == 0 {
+			lines = append(lines, pad+"- "+formatScalar(item))
+			continue
+		}
+		sub[0] = pad + "- " + sub[0][indent+2:]
+		lines = append(lines, sub...)
+	}
+	return lines
+}
+
+// formatScalar 格式化单个值
+func formatScalar(val any) string {
+	switch v := val.(type) {
+	case nil:
+		return "null"
+	case string:
+		return formatString(v)
+	case map[string]any:
+		return "{}"
+	case []any:
+		return "[]"
+	}
+	return fmt.Sprint(val)
+}
+
+// formatString 格式化字符串, 必要时添加引号
+func formatString(s string) string {
+	if len(s) == 0 || strings.IndexByte("-?:,[]{}#&*!|>'\"%@` \t", s[0]) >= 0 {
+		return strconv.Quote(s)
+	}
+	if _, ok := parsePlain(s).(string); !ok {
+		return strconv.Quote(s)
+	}
+	if strings.HasSuffix(s, ":") || strings.HasSuffix(s, " ") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.ContainsAny(s, "\n\r\t") ||
+		strconv.Quote(s) != `"`+strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), `"`, `\"`)+`"` {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// sortedKeys 排序后的key
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -7,6 +7,11 @@ import (
 	"github.com/wup364/pakku/internal/modules/appevent/localevent"
 )
 
+func init() {
+	// 注册的 IEvent 实现由本模块选用并初始化
+	ipakku.PakkuConf.SetPakkuModuleImplementOwner("IEvent", "AppEvent")
+}
+
 // AppEvent 事件模块
 type AppEvent struct {
 	event  ipakku.AppEvent
@@ -28,6 +33,10 @@ func (ev *AppEvent) AsModule() ipakku.Opts {
 			}
 			ev.event = driver
 			ev.sysevt = localevent.NewAppLocalEvent()
+			ipakku.PakkuConf.SetPakkuModuleImplementInitialized(driver, true)
+		},
+		OnShutdown: func() {
+			ipakku.PakkuConf.SetPakkuModuleImplementInitialized(ev.event, false)
 		},
 	}
 }
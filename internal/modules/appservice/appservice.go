@@ -1,8 +1,11 @@
 package appservice
 
 import (
+	"context"
+	"crypto/tls"
 	"net"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/wup364/pakku/internal/modules/appservice/service"
@@ -14,7 +17,9 @@ import (
 type AppService struct {
 	service.RPCService
 	service.HTTPService
-	conf ipakku.AppConfig `@autowired:""`
+	conf    ipakku.AppConfig      `@autowired:""`
+	servers []ipakku.ServerHandle // 已启动的服务
+	locker  sync.Mutex            // servers 锁
 }
 
 // AsModule 作为一个模块加载
@@ -30,13 +35,41 @@ func (service *AppService) AsModule() ipakku.Opts {
 				service.RPCService.AsModule().OnReady(app)
 			}
 		},
+		OnShutdown: func() {
+			if err := service.Shutdown(context.Background()); nil != err {
+				logs.Error(err)
+			}
+		},
 	}
 }
 
-// StartHTTP 启动服务
+// StartHTTP 启动HTTP服务, 阻塞直到服务停止, 启动失败时 panic
 func (service *AppService) StartHTTP(serviceCfg ipakku.HTTPServiceConfig) {
+	h, err := service.StartHTTPAsync(serviceCfg)
+	if nil == err {
+		err = h.Wait()
+	}
+	if nil != err {
+		logs.Panic(err)
+	}
+}
+
+// StartRPC 启动RPC服务, 阻塞直到服务停止, 启动失败时 panic
+func (service *AppService) StartRPC(serviceCfg ipakku.RPCServiceConfig) {
+	h, err := service.StartRPCAsync(serviceCfg)
+	if nil == err {
+		err = h.Wait()
+	}
+	if nil != err {
+		logs.Panic(err)
+	}
+}
+
+// StartHTTPAsync 启动HTTP服务, 监听成功后立即返回服务句柄
+func (service *AppService) StartHTTPAsync(serviceCfg ipakku.HTTPServiceConfig) (ipakku.ServerHandle, error) {
 	service.HTTPService.SetDebug(serviceCfg.Debug)
 
+	// http.Server 的超时不支持运行时修改, service.* 配置仅在启动时读取, 不随配置变化重新加载
 	s := serviceCfg.Server
 	if nil == s {
 		s = &http.Server{
@@ -55,22 +88,44 @@ func (service *AppService) StartHTTP(serviceCfg ipakku.HTTPServiceConfig) {
 		s.Addr = serviceCfg.ListenAddr
 	}
 
-	var err error
-	if len(serviceCfg.CertFile) == 0 || len(serviceCfg.KeyFile) == 0 {
-		logs.Info("Server(HTTP) listened in: " + s.Addr)
-		err = s.ListenAndServe()
-	} else {
-		logs.Info("Server(HTTPS) listened in: " + s.Addr)
-		err = s.ListenAndServeTLS(serviceCfg.CertFile, serviceCfg.KeyFile)
+	// 证书在监听前加载, 以便直接返回证书错误
+	useTLS := len(serviceCfg.CertFile) > 0 && len(serviceCfg.KeyFile) > 0
+	if useTLS {
+		cert, err := tls.LoadX509KeyPair(serviceCfg.CertFile, serviceCfg.KeyFile)
+		if nil != err {
+			return nil, err
+		}
+		if nil == s.TLSConfig {
+			s.TLSConfig = &tls.Config{}
+		} else {
+			s.TLSConfig = s.TLSConfig.Clone()
+		}
+		s.TLSConfig.Certificates = append(s.TLSConfig.Certificates, cert)
 	}
 
+	addr := s.Addr
+	if len(addr) == 0 {
+		if addr = ":http"; useTLS {
+			addr = ":https"
+		}
+	}
+	l, err := net.Listen("tcp", addr)
 	if nil != err {
-		logs.Panic(err)
+		return nil, err
 	}
+
+	if useTLS {
+		logs.Info("Server(HTTPS) listened in: " + l.Addr().String())
+	} else {
+		logs.Info("Server(HTTP) listened in: " + l.Addr().String())
+	}
+	h := startServer(s, l, useTLS)
+	service.addServer(h)
+	return h, nil
 }
 
-// StartRPC 启动服务
-func (service *AppService) StartRPC(serviceCfg ipakku.RPCServiceConfig) {
+// StartRPCAsync 启动RPC服务, 监听成功后立即返回服务句柄
+func (service *AppService) StartRPCAsync(serviceCfg ipakku.RPCServiceConfig) (ipakku.ServerHandle, error) {
 	service.RPCService.SetDebug(serviceCfg.Debug)
 
 	if len(serviceCfg.Network) == 0 {
@@ -81,12 +136,48 @@ func (service *AppService) StartRPC(serviceCfg ipakku.RPCServiceConfig) {
 	if nil == l {
 		var err error
 		if l, err = net.Listen(serviceCfg.Network, serviceCfg.ListenAddr); nil != err {
-			logs.Panic(err)
+			return nil, err
 		}
 	}
-	s := service.RPCService.GetRPCService()
-	logs.Info("Server(RPC) listened in: " + serviceCfg.ListenAddr)
-	if err := http.Serve(l, s); err != nil {
-		logs.Panic(err)
+	s := &http.Server{
+		Handler:  service.RPCService.GetRPCService(),
+		ErrorLog: logs.ErrorLogger(),
+	}
+	logs.Info("Server(RPC) listened in: " + l.Addr().String())
+	h := startServer(s, l, false)
+	service.addServer(h)
+	return h, nil
+}
+
+// Shutdown 停止所有已启动的 HTTP/RPC 服务, 等待处理中的请求完成或 ctx 结束
+func (service *AppService) Shutdown(ctx context.Context) (err error) {
+	service.locker.Lock()
+	servers := service.servers
+	service.servers = nil
+	service.locker.Unlock()
+
+	for i := 0; i < len(servers); i++ {
+		if serr := servers[i].Stop(ctx); nil != serr && nil == err {
+			err = serr
+		}
 	}
+	return
+}
+
+// addServer 记录已启动的服务, 用于关闭
+func (service *AppService) addServer(h ipakku.ServerHandle) {
+	service.locker.Lock()
+	defer service.locker.Unlock()
+	service.servers = append(service.servers, h)
+}
+
+// startServer 异步启动服务, 服务停止后打印日志
+func startServer(s *http.Server, l net.Listener, useTLS bool) ipakku.ServerHandle {
+	h := service.StartServer(s, l, useTLS)
+	go func() {
+		if err := h.Wait(); nil == err {
+			logs.Info("Server stopped: " + h.Addr().String())
+		}
+	}()
+	return h
 }
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// StartServer 在 l 上异步启动服务 s, 返回服务句柄
+// 需要使用 TLS 时, 调用前应设置好 s.TLSConfig 的证书
+func StartServer(s *http.Server, l net.Listener, useTLS bool) *ServerHandle {
+	h := &ServerHandle{
+		server: s,
+		addr:   l.Addr(),
+		done:   make(chan struct{}),
+		errs:   make(chan error, 1),
+	}
+	go func() {
+		var err error
+		if useTLS {
+			err = s.ServeTLS(l, "", "")
+		} else {
+			err = s.Serve(l)
+		}
+		if nil != err && !errors.Is(err, http.ErrServerClosed) {
+			h.err = err
+			h.errs <- err
+		}
+		close(h.errs)
+		close(h.done)
+	}()
+	return h
+}
+
+// ServerHandle 已启动的服务句柄
+type ServerHandle struct {
+	server *http.Server
+	addr   net.Addr
+	done   chan struct{}
+	errs   chan error
+	err    error
+}
+
+// Addr 实际监听的地址
+func (h *ServerHandle) Addr() net.Addr {
+	return h.addr
+}
+
+// Stop 停止服务, 等待处理中的请求完成或 ctx 结束
+func (h *ServerHandle) Stop(ctx context.Context) error {
+	return h.server.Shutdown(ctx)
+}
+
+// Wait 阻塞直到服务结束, 正常停止时返回 nil
+func (h *ServerHandle) Wait() error {
+	<-h.done
+	return h.err
+}
+
+// Errors 服务异常退出时可从此通道读取错误, 服务结束后通道关闭
+func (h *ServerHandle) Errors() <-chan error {
+	return h.errs
+}
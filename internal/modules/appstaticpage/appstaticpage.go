@@ -1,7 +1,7 @@
 // SPDX-License-Identifier: MIT
 // Copyright (C) 2025 WuPeng <wup364@outlook.com>.
 
-// 静态页面加载器
+// 静态页面加载器, 静态页面及跨域配置在模块加载时读取一次, 不随配置变化重新加载(路由注册后无法撤销), 修改后需重启
 package appstaticpage
 
 import (
@@ -25,7 +25,7 @@ func (staticPage *StaticPageLoader) AsModule() ipakku.Opts {
 		Version:     1.0,
 		Description: "StaticPage module",
 		OnReady: func(app ipakku.Application) {
-			if pageConfig, err := GetStaticPageConfig(); nil != err {
+			if pageConfig, err := GetStaticPageConfigFromDir(ipakku.GetConfigDir(app.Params())); nil != err {
 				logs.Panicf("Failed to load staticPage configuration: %v", err)
 			} else if nil != pageConfig {
 				staticPage.registerStaticPages(*pageConfig)
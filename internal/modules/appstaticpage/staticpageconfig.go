@@ -3,21 +3,34 @@
 
 package appstaticpage
 
-import "github.com/wup364/pakku/pkg/fileutil"
+import (
+	"path/filepath"
+
+	"github.com/wup364/pakku/pkg/fileutil"
+)
 
 const (
 	// DefaultStaticPageConfigPath 默认的WebPage配置文件路径
-	DefaultStaticPageConfigPath = ".conf/pakku-static-pages.json"
+	DefaultStaticPageConfigPath = ".conf/" + StaticPageConfigName
+	// StaticPageConfigName WebPage配置文件名, 位于配置目录下
+	StaticPageConfigName = "pakku-static-pages.json"
 )
 
-// GetStaticPageConfig 获取 WebPage 的配置
+// GetStaticPageConfig 获取 WebPage 的配置, 读取 DefaultStaticPageConfigPath
 // 如果配置文件不存在，则返回 nil
 func GetStaticPageConfig() (*StaticPageConfig, error) {
-	if !fileutil.IsFile(DefaultStaticPageConfigPath) {
+	return GetStaticPageConfigFromDir(filepath.Dir(DefaultStaticPageConfigPath))
+}
+
+// GetStaticPageConfigFromDir 获取配置目录 configDir 下 WebPage 的配置
+// 如果配置文件不存在，则返回 nil
+func GetStaticPageConfigFromDir(configDir string) (*StaticPageConfig, error) {
+	path := filepath.Join(configDir, StaticPageConfigName)
+	if !fileutil.IsFile(path) {
 		return nil, nil
 	}
 	var result StaticPageConfig
-	if err := fileutil.ReadFileAsJSON(DefaultStaticPageConfigPath, &result); nil != err {
+	if err := fileutil.ReadFileAsJSON(path, &result); nil != err {
 		return nil, err
 	} else {
 		return &result, nil
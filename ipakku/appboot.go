@@ -4,7 +4,9 @@
 package ipakku
 
 import (
+	"context"
 	"io"
+	"time"
 
 	"github.com/wup364/pakku/pkg/logs"
 )
@@ -29,6 +31,12 @@ type ApplicationBootBuilder interface {
 
 	// BootStart 加载&启动程序
 	BootStart() PakkuApplication
+
+	// TryBootStart 加载&启动程序, 加载失败时返回 *BootError, 并按逆序卸载已加载的模块
+	TryBootStart() (PakkuApplication, error)
+
+	// PlanUpdates 预演已添加模块的升级, 不加载模块
+	PlanUpdates() ([]UpdatePlan, error)
 }
 
 // PakkuApplication bootBuild实例化后的application
@@ -37,6 +45,9 @@ type PakkuApplication interface {
 
 	// PakkuModules 默认模块Getter
 	PakkuModules() PakkuModulesGetter
+
+	// Shutdown 关闭应用, 先停止 AppService 的 HTTP/RPC 服务, 再按依赖逆序卸载模块
+	Shutdown(ctx context.Context) error
 }
 
 // PakkuModule 应用配置
@@ -57,6 +68,39 @@ type PakkuConfigure interface {
 	CustomModules() CustomModuleBuilder
 }
 
+// PakkuConfigureExt 应用配置扩展, PakkuConfigure 实现可选实现此接口, 如: PakkuConfigure().(PakkuConfigureExt).SetConfigDir(dir)
+type PakkuConfigureExt interface {
+	PakkuConfigure
+
+	// EnableGracefulShutdown 监听 SIGINT/SIGTERM 信号, 收到信号后在 timeout 内关闭应用, timeout<=0 则不限时
+	EnableGracefulShutdown(timeout time.Duration) PakkuConfigureExt
+
+	// SetParallelLoading 并行加载无依赖关系的模块, workers 为最大并发数, 小于等于1时顺序加载. 模块的依赖加载完成后立即开始加载, 事件监听函数串行执行
+	SetParallelLoading(workers int) PakkuConfigureExt
+
+	// RefuseDowngrade 已记录的模块版本比模块版本新时, 拒绝加载该模块
+	RefuseDowngrade() PakkuConfigureExt
+
+	// SetConfigDefaults 设置配置默认值, 优先级最低, 支持 a.b.c 形式的key
+	SetConfigDefaults(defaults map[string]any) PakkuConfigureExt
+
+	// SetConfigReloadInterval 设置配置文件变化检查间隔, 默认5秒, 小于等于0时不检查
+	SetConfigReloadInterval(interval time.Duration) PakkuConfigureExt
+
+	// SetConfigKeyFile 设置配置加密密钥文件, 默认 {配置目录}/{app}.key, 环境变量 PAKKU_CONFIG_KEY 优先
+	SetConfigKeyFile(path string) PakkuConfigureExt
+
+	// SetConfigEnvPrefix 设置环境变量配置的前缀, 默认 {APPNAME}_ 且仅读取带前缀的环境变量.
+	// only 为 false 时同时读取不带前缀的环境变量(带前缀的优先), 此时 PATH、HOME 等系统环境变量也可能覆盖配置
+	SetConfigEnvPrefix(prefix string, only bool) PakkuConfigureExt
+
+	// SetConfigDir 设置配置目录, 默认 .conf(相对于工作目录), 配置文件、banner、模块信息记录、静态页面配置均存放于此
+	SetConfigDir(dir string) PakkuConfigureExt
+
+	// SetProfile 设置配置profile, 启用后额外读取 {app}-{profile} 配置文件, 优先于环境变量 PAKKU_PROFILE
+	SetProfile(profile string) PakkuConfigureExt
+}
+
 // PakkuModule 默认模块启用操作
 type PakkuModuleBuilder interface {
 
@@ -83,6 +127,9 @@ type PakkuModuleBuilder interface {
 
 	// BootStart 加载&启动程序
 	BootStart() PakkuApplication
+
+	// TryBootStart 加载&启动程序, 加载失败时返回 *BootError, 并按逆序卸载已加载的模块
+	TryBootStart() (PakkuApplication, error)
 }
 
 // PakkuModulesGetter 获取默认携带的模块
@@ -110,11 +157,21 @@ type CustomModuleBuilder interface {
 	// AddModules 添加模块
 	AddModules(mts ...Module) CustomModuleBuilder
 
+	// AddProvider 添加构造函数模块, 如: func(conf AppConfig) (MyService, error)
+	// 参数按类型从已加载模块中获取, 返回值作为模块, 模块名为返回值的类型名
+	AddProvider(fn any) CustomModuleBuilder
+
+	// AddProviders 添加构造函数模块
+	AddProviders(fns ...any) CustomModuleBuilder
+
 	// ModuleEvents 模块事件监听器
 	ModuleEvents() ModuleEventBuilder
 
 	// BootStart 加载&启动程序
 	BootStart() PakkuApplication
+
+	// TryBootStart 加载&启动程序, 加载失败时返回 *BootError, 并按逆序卸载已加载的模块
+	TryBootStart() (PakkuApplication, error)
 }
 
 // ModuleEventBuilder 模块事件监听器
@@ -125,4 +182,7 @@ type ModuleEventBuilder interface {
 
 	// BootStart 加载&启动程序
 	BootStart() PakkuApplication
+
+	// TryBootStart 加载&启动程序, 加载失败时返回 *BootError, 并按逆序卸载已加载的模块
+	TryBootStart() (PakkuApplication, error)
 }
@@ -5,6 +5,17 @@ package ipakku
 
 import "errors"
 
+const (
+	// CONFKEY_CACHE_REDIS redis缓存实现的配置前缀, 包含: addr password db poolSize timeout prefix
+	CONFKEY_CACHE_REDIS = "cache.redis"
+	// CONFKEY_CACHE_TIERED 两级缓存实现的配置前缀, 包含: remote nearExpire nearMaxEntries
+	CONFKEY_CACHE_TIERED = "cache.tiered"
+	// EVENT_GROUP_CACHE 缓存事件组
+	EVENT_GROUP_CACHE = "pakku.cache"
+	// EVENT_NAME_CACHE_INVALIDATE 两级缓存中key被修改或删除, 其他实例收到后删除本地缓存
+	EVENT_NAME_CACHE_INVALIDATE = "invalidate"
+)
+
 // ErrCacheLibNotExist 缓存库没有注册
 var ErrCacheLibNotExist = errors.New("cache lib not exist")
 
@@ -23,6 +34,66 @@ var ErrCacheArgsTypeError = errors.New("cache parameter type error")
 // ErrCacheConvertError 缓存参数类型错误
 var ErrCacheConvertError = errors.New("cache parameter type error")
 
+// ErrCacheNotSupported 缓存实现不支持该操作, 如: 按选项注册缓存库、查询统计信息
+var ErrCacheNotSupported = errors.New("cache implement does not support this operation")
+
+// CacheEvictPolicy 缓存库超出容量时的淘汰策略
+type CacheEvictPolicy string
+
+const (
+	// CACHE_EVICT_LRU 淘汰最久未访问的key
+	CACHE_EVICT_LRU CacheEvictPolicy = "lru"
+	// CACHE_EVICT_LFU 淘汰访问次数最少的key, 次数相同时淘汰最久未访问的
+	CACHE_EVICT_LFU CacheEvictPolicy = "lfu"
+)
+
+// CacheLibOptions 缓存库选项
+type CacheLibOptions struct {
+	Expire     int64                     // 默认过期时间, 单位秒, -1为不过期
+	MaxEntries int                       // 最大key数量, 0为不限制
+	MaxBytes   int64                     // 近似最大占用字节数(按key和值估算), 0为不限制
+	Policy     CacheEvictPolicy          // 淘汰策略, 默认LRU
+	OnEvict    func(key string, val any) // key因超出容量被淘汰时回调
+	NearExpire int64                     // 两级缓存中本地缓存的过期时间, 单位秒, 0为使用配置的默认值
+}
+
+// CacheLibStats 缓存库统计信息
+type CacheLibStats struct {
+	Entries   int    // key数量
+	Bytes     int64  // 近似占用字节数, 未设置 MaxBytes 时为0
+	Hits      uint64 // Get命中次数
+	Misses    uint64 // Get未命中次数
+	Evictions uint64 // 因超出容量淘汰的key数量
+}
+
+// CacheLibRegister 支持按选项注册缓存库, ICache 实现可选实现此接口
+type CacheLibRegister interface {
+
+	// RegLibWithOptions 按选项注册缓存库
+	RegLibWithOptions(clib string, opts CacheLibOptions) error
+}
+
+// CacheStatsGetter 支持查询缓存库统计信息, ICache 实现可选实现此接口
+type CacheStatsGetter interface {
+
+	// Stats 获取缓存库统计信息
+	Stats(clib string) (CacheLibStats, error)
+}
+
+// CacheTTLGetter 支持查询key的剩余过期时间, ICache 实现可选实现此接口
+type CacheTTLGetter interface {
+
+	// TTL 获取key的剩余过期时间, 单位秒(向下取整), -1为不过期, key不存在时返回 ErrNoCacheHit
+	TTL(clib string, key string) (int64, error)
+}
+
+// CacheEventSetter 需要通过事件模块与其他实例通信的 ICache 实现可选实现此接口, 在 Init 之前调用
+type CacheEventSetter interface {
+
+	// SetAppEvent 设置事件模块
+	SetAppEvent(event AppEvent)
+}
+
 // AppCache 缓存模块
 type AppCache interface {
 
@@ -33,15 +104,15 @@ type AppCache interface {
 	Exists(clib string, key string) (bool, error)
 
 	// Set 向lib库中设置键为key的值
-	// args[0] 为缓存值 args[2]如果存在, 则覆盖默认过期时间, 单位秒
+	// args[0] 为缓存值 args[1]如果存在, 则覆盖默认过期时间, 单位秒
 	Set(clib string, key string, args ...any) error
 
 	// SetNX 向lib库中设置键为key的值, 当key不存在时设置成功, 并返回true
-	// args[0] 为缓存值 args[2]如果存在, 则覆盖默认过期时间, 单位秒
+	// args[0] 为缓存值 args[1]如果存在, 则覆盖默认过期时间, 单位秒
 	SetNX(clib string, key string, args ...any) (bool, error)
 
 	// Incrby 指定key以increment的值累加, 返回累加后的值
-	// args[0] 为缓存值 args[2]如果存在, 则覆盖默认过期时间, 单位秒
+	// args[0] 为缓存值 args[1]如果存在, 则覆盖默认过期时间, 单位秒
 	Incrby(clib string, key string, args ...any) (int64, error)
 
 	// Get 读取缓存信息
@@ -0,0 +1,165 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 类型化的缓存库, 在 AppCache 接口上封装, 适用于任意 ICache 实现
+// 如: sessions := ipakku.NewCacheLib[Session](app.Modules().GetAppCache(), "sessions")
+
+package ipakku
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// CACHE_EXPIRE_DEFAULT 使用缓存库注册时的过期时间
+	CACHE_EXPIRE_DEFAULT time.Duration = 0
+	// CACHE_EXPIRE_NEVER 不过期
+	CACHE_EXPIRE_NEVER time.Duration = -1
+)
+
+// NewCacheLib 使用已注册的缓存库
+func NewCacheLib[T any](cache AppCache, clib string) *CacheLib[T] {
+	return &CacheLib[T]{cache: cache, clib: clib, loads: make(map[string]*cacheLoad[T]), l: new(sync.Mutex)}
+}
+
+// RegCacheLib 注册缓存库, ttl 为默认过期时间, 小于等于0为不过期
+func RegCacheLib[T any](cache AppCache, clib string, ttl time.Duration) (*CacheLib[T], error) {
+	if ttl == 0 {
+		ttl = CACHE_EXPIRE_NEVER
+	}
+	if err := cache.RegLib(clib, expireSecond(ttl)); nil != err {
+		return nil, err
+	}
+	return NewCacheLib[T](cache, clib), nil
+}
+
+// RegCacheLibWithOptions 按选项注册缓存库, 缓存实现未实现 CacheLibRegister 时返回 ErrCacheNotSupported
+func RegCacheLibWithOptions[T any](cache AppCache, clib string, opts CacheLibOptions) (*CacheLib[T], error) {
+	register, ok := cache.(CacheLibRegister)
+	if !ok {
+		return nil, ErrCacheNotSupported
+	}
+	if err := register.RegLibWithOptions(clib, opts); nil != err {
+		return nil, err
+	}
+	return NewCacheLib[T](cache, clib), nil
+}
+
+// CacheLib 类型化的缓存库, 并发安全
+type CacheLib[T any] struct {
+	cache AppCache
+	clib  string
+	loads map[string]*cacheLoad[T]
+	l     *sync.Mutex
+}
+
+// cacheLoad 正在执行的加载
+type cacheLoad[T any] struct {
+	wg  sync.WaitGroup
+	val T
+	err error
+}
+
+// Name 缓存库名
+func (lib *CacheLib[T]) Name() string {
+	return lib.clib
+}
+
+// Get 读取缓存, 未命中时返回 false 和 nil 错误
+func (lib *CacheLib[T]) Get(key string) (T, bool, error) {
+	var val T
+	if err := lib.cache.Get(lib.clib, key, &val); nil != err {
+		var zero T
+		if err == ErrNoCacheHit {
+			return zero, false, nil
+		}
+		return zero, false, err
+	}
+	return val, true, nil
+}
+
+// Set 设置缓存, ttl 为 CACHE_EXPIRE_DEFAULT 时使用缓存库的过期时间, 不足1秒按1秒计
+func (lib *CacheLib[T]) Set(key string, val T, ttl time.Duration) error {
+	return lib.cache.Set(lib.clib, key, expireArgs(val, ttl)...)
+}
+
+// SetNX key不存在时设置缓存, 设置成功时返回true
+func (lib *CacheLib[T]) SetNX(key string, val T, ttl time.Duration) (bool, error) {
+	return lib.cache.SetNX(lib.clib, key, expireArgs(val, ttl)...)
+}
+
+// GetOrLoad 读取缓存, 未命中时调用 loader 加载并以缓存库的过期时间保存.
+// 同一个 CacheLib 上相同key的并发调用只执行一次 loader. 加载成功但保存失败时返回加载的值和保存的错误.
+// loader panic 时等待中的调用返回错误, 执行 loader 的调用继续 panic
+func (lib *CacheLib[T]) GetOrLoad(key string, loader func(key string) (T, error)) (T, error) {
+	if val, ok, err := lib.Get(key); nil != err || ok {
+		return val, err
+	}
+
+	lib.l.Lock()
+	if load, ok := lib.loads[key]; ok {
+		lib.l.Unlock()
+		load.wg.Wait()
+		return load.val, load.err
+	}
+	load := new(cacheLoad[T])
+	load.wg.Add(1)
+	lib.loads[key] = load
+	lib.l.Unlock()
+
+	defer func() {
+		r := recover()
+		if nil != r {
+			load.err = fmt.Errorf("load cache '%s' panic: %v", key, r)
+		}
+		lib.l.Lock()
+		delete(lib.loads, key)
+		lib.l.Unlock()
+		load.wg.Done()
+		if nil != r {
+			panic(r)
+		}
+	}()
+	if load.val, load.err = loader(key); nil == load.err {
+		load.err = lib.Set(key, load.val, CACHE_EXPIRE_DEFAULT)
+	}
+	return load.val, load.err
+}
+
+// Exists 返回key是否存在
+func (lib *CacheLib[T]) Exists(key string) (bool, error) {
+	return lib.cache.Exists(lib.clib, key)
+}
+
+// Del 删除缓存
+func (lib *CacheLib[T]) Del(key string) error {
+	return lib.cache.Del(lib.clib, key)
+}
+
+// Keys 获取库的所有key
+func (lib *CacheLib[T]) Keys() []string {
+	return lib.cache.Keys(lib.clib)
+}
+
+// Clear 清空库内容
+func (lib *CacheLib[T]) Clear() {
+	lib.cache.Clear(lib.clib)
+}
+
+// expireArgs AppCache.Set 的参数, args[1] 为过期时间
+func expireArgs(val any, ttl time.Duration) []any {
+	if ttl == CACHE_EXPIRE_DEFAULT {
+		return []any{val}
+	}
+	return []any{val, expireSecond(ttl)}
+}
+
+// expireSecond 转换为秒, 小于0为不过期, 不足1秒按1秒计
+func expireSecond(ttl time.Duration) int64 {
+	if ttl < 0 {
+		return -1
+	}
+	return int64((ttl + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,211 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+package ipakku_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wup364/pakku/internal/modules/appcache/localcache"
+	"github.com/wup364/pakku/internal/modules/appcache/rediscache"
+	"github.com/wup364/pakku/ipakku"
+)
+
+type session struct {
+	User  string
+	Roles []string
+}
+
+// newTestCaches 本地缓存和redis缓存实现
+func newTestCaches(t *testing.T) map[string]ipakku.AppCache {
+	local := new(localcache.CacheManager)
+	local.Init(nil, "")
+	t.Cleanup(local.Destroy)
+
+	srv, err := rediscache.NewMemoryServer("", "")
+	if nil != err {
+		t.Fatal(err)
+	}
+	redis := new(rediscache.RedisCache).InitClient(rediscache.NewClient(rediscache.Options{Addr: srv.Addr()}), "app")
+	t.Cleanup(func() {
+		redis.Destroy()
+		srv.Close()
+	})
+	return map[string]ipakku.AppCache{"local": local, "redis": redis}
+}
+
+func TestCacheLib(t *testing.T) {
+	for name, cache := range newTestCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			sessions, err := ipakku.RegCacheLib[session](cache, "sessions", 0)
+			if nil != err {
+				t.Fatal(err)
+			}
+			if _, err = ipakku.RegCacheLib[session](cache, "sessions", time.Minute); err != ipakku.ErrCacheLibIsExist {
+				t.Fatalf("err = %v", err)
+			}
+
+			if _, ok, err := sessions.Get("s1"); nil != err || ok {
+				t.Fatalf("ok = %v, err = %v", ok, err)
+			}
+			if err = sessions.Set("s1", session{User: "u1", Roles: []string{"admin"}}, ipakku.CACHE_EXPIRE_DEFAULT); nil != err {
+				t.Fatal(err)
+			}
+			val, ok, err := sessions.Get("s1")
+			if nil != err || !ok || val.User != "u1" || len(val.Roles) != 1 {
+				t.Fatalf("val = %v, ok = %v, err = %v", val, ok, err)
+			}
+			if ok, err = sessions.SetNX("s1", session{User: "u2"}, time.Minute); nil != err || ok {
+				t.Fatalf("ok = %v, err = %v", ok, err)
+			}
+			if keys := sessions.Keys(); len(keys) != 1 || keys[0] != "s1" {
+				t.Fatalf("keys = %v", keys)
+			}
+			sessions.Del("s1")
+			if ok, _ = sessions.Exists("s1"); ok {
+				t.Fatal("s1 should be deleted")
+			}
+
+			// 同一个缓存库可以用不同的类型读取兼容的值
+			counts := ipakku.NewCacheLib[int64](cache, "sessions")
+			counts.Set("n", 10, ipakku.CACHE_EXPIRE_NEVER)
+			if n, ok, err := counts.Get("n"); nil != err || !ok || n != 10 {
+				t.Fatalf("n = %d, ok = %v, err = %v", n, ok, err)
+			}
+			counts.Clear()
+			if keys := counts.Keys(); len(keys) != 0 {
+				t.Fatalf("keys = %v", keys)
+			}
+
+			none := ipakku.NewCacheLib[string](cache, "none")
+			if _, _, err = none.Get("k"); err != ipakku.ErrCacheLibNotExist {
+				t.Fatalf("err = %v", err)
+			}
+		})
+	}
+}
+
+func TestCacheLibExpire(t *testing.T) {
+	for name, cache := range newTestCaches(t) {
+		cache := cache
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			lib, err := ipakku.RegCacheLib[string](cache, "expire", time.Minute)
+			if nil != err {
+				t.Fatal(err)
+			}
+			// 不足1秒按1秒计, 不会立即过期
+			lib.Set("k1", "v1", 100*time.Millisecond)
+			lib.Set("k2", "v2", ipakku.CACHE_EXPIRE_DEFAULT)
+			if _, ok, _ := lib.Get("k1"); !ok {
+				t.Fatal("k1 should exist")
+			}
+			time.Sleep(1100 * time.Millisecond)
+			if _, ok, _ := lib.Get("k1"); ok {
+				t.Fatal("k1 should be expired")
+			}
+			if val, ok, _ := lib.Get("k2"); !ok || val != "v2" {
+				t.Fatalf("val = %s, ok = %v", val, ok)
+			}
+		})
+	}
+}
+
+func TestCacheLibGetOrLoad(t *testing.T) {
+	for name, cache := range newTestCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			lib, err := ipakku.RegCacheLib[*session](cache, "load", ipakku.CACHE_EXPIRE_NEVER)
+			if nil != err {
+				t.Fatal(err)
+			}
+			var calls int32
+			start := make(chan struct{})
+			loader := func(key string) (*session, error) {
+				atomic.AddInt32(&calls, 1)
+				<-start
+				return &session{User: key}, nil
+			}
+
+			// 并发读取同一个key只加载一次
+			wg := new(sync.WaitGroup)
+			res := make([]*session, 10)
+			for i := 0; i < len(res); i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					res[i], _ = lib.GetOrLoad("u1", loader)
+				}(i)
+			}
+			time.Sleep(50 * time.Millisecond)
+			close(start)
+			wg.Wait()
+			if calls != 1 {
+				t.Fatalf("calls = %d", calls)
+			}
+			for _, val := range res {
+				if nil == val || val.User != "u1" {
+					t.Fatalf("val = %v", val)
+				}
+			}
+			if val, err := lib.GetOrLoad("u1", loader); nil != err || val.User != "u1" || calls != 1 {
+				t.Fatalf("val = %v, err = %v, calls = %d", val, err, calls)
+			}
+
+			// 加载失败时不保存
+			errLoad := errors.New("load failed")
+			if _, err = lib.GetOrLoad("u2", func(key string) (*session, error) { return nil, errLoad }); err != errLoad {
+				t.Fatalf("err = %v", err)
+			}
+			if ok, _ := lib.Exists("u2"); ok {
+				t.Fatal("u2 should not exist")
+			}
+
+			// loader panic 时等待中的调用返回错误, 执行 loader 的调用继续 panic
+			loading := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() { panicked <- recover() }()
+				lib.GetOrLoad("u3", func(key string) (*session, error) {
+					close(loading)
+					time.Sleep(50 * time.Millisecond)
+					panic("boom")
+				})
+			}()
+			<-loading
+			if val, err := lib.GetOrLoad("u3", loader); nil != val || nil == err || !strings.Contains(err.Error(), "boom") {
+				t.Fatalf("val = %v, err = %v", val, err)
+			}
+			if r := <-panicked; r != "boom" {
+				t.Fatalf("recover = %v", r)
+			}
+		})
+	}
+}
+
+func TestRegCacheLibWithOptions(t *testing.T) {
+	cache := newTestCaches(t)["local"]
+	var evicted []string
+	lib, err := ipakku.RegCacheLibWithOptions[string](cache, "bounded", ipakku.CacheLibOptions{
+		Expire:     -1,
+		MaxEntries: 1,
+		OnEvict:    func(key string, val any) { evicted = append(evicted, key) },
+	})
+	if nil != err {
+		t.Fatal(err)
+	}
+	lib.Set("k1", "v1", ipakku.CACHE_EXPIRE_DEFAULT)
+	lib.Set("k2", "v2", ipakku.CACHE_EXPIRE_DEFAULT)
+	if len(evicted) != 1 || evicted[0] != "k1" {
+		t.Fatalf("evicted = %v", evicted)
+	}
+
+	// 未实现 CacheLibRegister 的缓存
+	if _, err = ipakku.RegCacheLibWithOptions[string](struct{ ipakku.AppCache }{cache}, "other", ipakku.CacheLibOptions{}); err != ipakku.ErrCacheNotSupported {
+		t.Fatalf("err = %v", err)
+	}
+}
@@ -3,7 +3,23 @@
 
 package ipakku
 
-import "github.com/wup364/pakku/pkg/utypes"
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/wup364/pakku/pkg/utypes"
+)
+
+const (
+	// CONFKEY_REMOTE_URL 远程配置地址, 写在本地配置文件中, 使用 remote 配置实现时有效, 也可通过环境变量 PAKKU_CONFIG_URL 指定
+	CONFKEY_REMOTE_URL = "pakku.remote.url"
+	// CONFKEY_REMOTE_HEADERS 请求远程配置时附带的请求头, map[string]string, 如: Authorization
+	CONFKEY_REMOTE_HEADERS = "pakku.remote.headers"
+	// ENV_KEY_CONFIG_URL 远程配置地址环境变量, 优先于 CONFKEY_REMOTE_URL
+	ENV_KEY_CONFIG_URL = "PAKKU_CONFIG_URL"
+)
 
 // AppConfig app 配置模块
 type AppConfig interface {
@@ -21,6 +37,45 @@ type AppConfig interface {
 	ScanAndAutoValue(configPrefix string, ptr any) error
 }
 
+// ConfigWatcher 支持监听配置变化, AppConfig 实现可选实现此接口
+type ConfigWatcher interface {
+
+	// Watch 监听 keyPrefix 的值变化, 配置文件重新加载后值发生变化时回调
+	Watch(keyPrefix string, fn func(old, new utypes.Object))
+}
+
+// ConfigEncrypter 支持加密配置值, AppConfig 实现可选实现此接口
+type ConfigEncrypter interface {
+
+	// EncryptValue 加密 value, 返回 ENC(...) 形式的密文, 可直接写入配置文件
+	EncryptValue(value string) (string, error)
+
+	// EncryptConfig 加密基础配置文件中 key 的明文值并回写, 已加密时不做处理, 值被覆盖时返回错误
+	EncryptConfig(key string) error
+}
+
+// ConfigSchemaExporter 支持导出已读取过的配置key, AppConfig 实现可选实现此接口
+type ConfigSchemaExporter interface {
+
+	// GetConfigKeys 获取已读取过的配置key, 包括 @value 标签和 GetConfig 读取的key
+	GetConfigKeys() []ConfigKeyInfo
+
+	// ExportConfigSchema 根据已读取过的配置key导出 JSON Schema
+	ExportConfigSchema() ([]byte, error)
+
+	// ExportSampleConfig 根据已读取过的配置key导出示例配置(JSON), 值为默认值或类型的零值
+	ExportSampleConfig() ([]byte, error)
+}
+
+// ConfigKeyInfo 配置key信息
+type ConfigKeyInfo struct {
+	Key     string `json:"key"`     // 配置路径
+	Type    string `json:"type"`    // Go类型, 通过 GetConfig 读取时为空
+	Default string `json:"default"` // 默认值, 来自 @value:"key:默认值"
+	Owner   string `json:"owner"`   // 所属结构体字段, 如: service.HTTPConfig.Addr, 通过 GetConfig 读取时为调用方函数
+	Valid   string `json:"valid"`   // @valid 校验规则
+}
+
 // IConfig 配置接口
 type IConfig interface {
 
@@ -33,3 +88,36 @@ type IConfig interface {
 	// SetConfig 设置值
 	SetConfig(key string, value any) error
 }
+
+// ConfigReloader IConfig 可选实现, 配置来源发生变化时重新加载
+type ConfigReloader interface {
+
+	// Reload 重新加载配置, 返回配置是否发生变化
+	Reload() (bool, error)
+}
+
+// LoadAutoConfig 读取 @autoConfig:"配置路径,reload" 标注的指针字段, 配置变化时该字段被原子替换为新的对象, 并发读取时使用
+func LoadAutoConfig[T any](field **T) *T {
+	return (*T)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(field))))
+}
+
+// ConfigFieldError 配置字段错误, Key 为配置路径, Field 为字段名(结构体名.字段名)
+type ConfigFieldError struct {
+	Key    string
+	Field  string
+	Reason string
+}
+
+// ConfigValidationError 自动配置时校验不通过的字段列表
+type ConfigValidationError struct {
+	Errors []ConfigFieldError
+}
+
+func (e *ConfigValidationError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("invalid configuration, %d error(s):", len(e.Errors)))
+	for _, fe := range e.Errors {
+		sb.WriteString(fmt.Sprintf("\n  %s (%s): %s", fe.Key, fe.Field, fe.Reason))
+	}
+	return sb.String()
+}
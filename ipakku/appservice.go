@@ -4,12 +4,14 @@
 package ipakku
 
 import (
+	"context"
 	"net"
 	"net/http"
 
 	"github.com/wup364/pakku/pkg/serviceutil"
 )
 
+// service.* 配置在 StartHTTP 时读取, 配置变化不会重新加载, 修改后对已启动的服务不生效, 需重启服务
 const (
 	// CONFKEY_READTIMEOUTSECOND ReadTimeoutSecond
 	CONFKEY_READTIMEOUTSECOND = "service.ReadTimeoutSecond"
@@ -125,10 +127,46 @@ type RPCServiceConfig struct {
 	Listener   net.Listener
 }
 
+// ServerHandle 已启动的服务句柄
+type ServerHandle interface {
+	// Addr 实际监听的地址, 如监听 127.0.0.1:0 时可获得系统分配的端口
+	Addr() net.Addr
+
+	// Stop 停止服务, 等待处理中的请求完成或 ctx 结束
+	Stop(ctx context.Context) error
+
+	// Wait 阻塞直到服务结束, 正常停止时返回 nil
+	Wait() error
+
+	// Errors 服务异常退出时可从此通道读取错误, 服务结束后通道关闭
+	Errors() <-chan error
+}
+
 // AppService web服务即接口
 type AppService interface {
 	HTTPService
 	RPCService
+
+	// StartHTTP 启动HTTP服务, 阻塞直到服务停止, 启动失败时 panic
 	StartHTTP(serviceCfg HTTPServiceConfig)
+
+	// StartRPC 启动RPC服务, 阻塞直到服务停止, 启动失败时 panic
 	StartRPC(serviceCfg RPCServiceConfig)
 }
+
+// AsyncServiceStarter 支持非阻塞启动服务, AppService 实现可选实现此接口
+type AsyncServiceStarter interface {
+
+	// StartHTTPAsync 启动HTTP服务, 监听成功后立即返回服务句柄
+	StartHTTPAsync(serviceCfg HTTPServiceConfig) (ServerHandle, error)
+
+	// StartRPCAsync 启动RPC服务, 监听成功后立即返回服务句柄
+	StartRPCAsync(serviceCfg RPCServiceConfig) (ServerHandle, error)
+}
+
+// ServiceShutdowner 支持停止已启动的服务, AppService 实现可选实现此接口
+type ServiceShutdowner interface {
+
+	// Shutdown 停止所有已启动的 HTTP/RPC 服务, 等待处理中的请求完成或 ctx 结束
+	Shutdown(ctx context.Context) error
+}
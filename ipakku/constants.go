@@ -11,6 +11,9 @@ const (
 
 	// STAG_CONFIG_VALUE struct标签-自动配置-字段配置标签
 	STAG_CONFIG_VALUE = "@value"
+
+	// STAG_CONFIG_VALID struct标签-自动配置-字段校验标签, 与 @value 一起使用
+	STAG_CONFIG_VALID = "@valid"
 )
 
 // ModuleID 模块ID
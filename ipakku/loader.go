@@ -7,6 +7,9 @@
 package ipakku
 
 import (
+	"context"
+	"fmt"
+	"os"
 	"reflect"
 
 	"github.com/wup364/pakku/pkg/utypes"
@@ -17,6 +20,32 @@ const (
 	DEFT_VAL_APPNAME = "app"
 	// PARAMS_KEY_APPNAME 实例名字KEY
 	PARAMS_KEY_APPNAME = "app.name"
+	// PARAMS_KEY_REFUSE_DOWNGRADE 已记录的模块版本比 Opts.Version 新时拒绝加载
+	PARAMS_KEY_REFUSE_DOWNGRADE = "pakku.module.refuse-downgrade"
+	// PARAMS_KEY_PROFILE 配置profile, 启用后额外读取 {app}-{profile} 配置文件, 也可通过环境变量 PAKKU_PROFILE 指定
+	PARAMS_KEY_PROFILE = "app.profile"
+	// PARAMS_KEY_CONFIG_DEFAULTS 配置默认值, map[string]any
+	PARAMS_KEY_CONFIG_DEFAULTS = "pakku.config.defaults"
+	// PARAMS_KEY_CONFIG_RELOAD_INTERVAL 配置文件变化检查间隔, time.Duration
+	PARAMS_KEY_CONFIG_RELOAD_INTERVAL = "pakku.config.reload-interval"
+	// PARAMS_KEY_CONFIG_DIR 配置目录, 存放配置文件、banner、模块信息等, 也可通过环境变量 PAKKU_CONFIG_DIR 指定
+	PARAMS_KEY_CONFIG_DIR = "pakku.config.dir"
+	// DEFT_VAL_CONFIG_DIR 默认配置目录
+	DEFT_VAL_CONFIG_DIR = ".conf"
+	// PARAMS_KEY_CONFIG_KEY_FILE 配置加密密钥文件, 默认 {配置目录}/{app}.key
+	PARAMS_KEY_CONFIG_KEY_FILE = "pakku.config.key-file"
+	// PARAMS_KEY_CONFIG_ENV_PREFIX 环境变量配置的前缀, 如: PAKKU_, 默认 {APPNAME}_(应用名转大写, '.'和'-'替换为'_')
+	PARAMS_KEY_CONFIG_ENV_PREFIX = "pakku.config.env-prefix"
+	// PARAMS_KEY_CONFIG_ENV_PREFIX_ONLY 仅读取带前缀的环境变量配置, bool, 默认 true
+	PARAMS_KEY_CONFIG_ENV_PREFIX_ONLY = "pakku.config.env-prefix-only"
+	// ENV_KEY_PROFILE 配置profile环境变量
+	ENV_KEY_PROFILE = "PAKKU_PROFILE"
+	// ENV_KEY_CONFIG_DIR 配置目录环境变量
+	ENV_KEY_CONFIG_DIR = "PAKKU_CONFIG_DIR"
+	// ENV_KEY_CONFIG_KEY 配置加密密钥环境变量, base64编码的16/24/32字节AES密钥, 优先于密钥文件
+	ENV_KEY_CONFIG_KEY = "PAKKU_CONFIG_KEY"
+	// ENV_KEY_CONFIG_KEY_FILE 配置加密密钥文件环境变量, 优先于 PARAMS_KEY_CONFIG_KEY_FILE
+	ENV_KEY_CONFIG_KEY_FILE = "PAKKU_CONFIG_KEY_FILE"
 	// ERR_MSG_MODULE_NOT_FOUND 模块未找到
 	ERR_MSG_MODULE_NOT_FOUND = "the module was not found, model: %s"
 )
@@ -29,6 +58,65 @@ type Updater interface {
 	Execute(app Application) error
 }
 
+// SemVerUpdater 使用语义化版本号的升级执行器, 实现后优先使用 SemVer 判断是否需要执行
+type SemVerUpdater interface {
+	Updater
+	// SemVer 要升级到的语义化版本号
+	SemVer() string
+}
+
+// NewUpdater 创建一个使用语义化版本号的升级执行器
+func NewUpdater(semver string, execute func(app Application) error) Updater {
+	return &semVerUpdater{semver: semver, execute: execute}
+}
+
+// GetUpdaterSemVer 获取升级执行器的语义化版本号, 未实现 SemVerUpdater 时由 Version 转换
+func GetUpdaterSemVer(updater Updater) (utypes.SemVer, error) {
+	if su, ok := updater.(SemVerUpdater); ok {
+		return utypes.ParseSemVer(su.SemVer())
+	}
+	return utypes.FloatToSemVer(updater.Version()), nil
+}
+
+// semVerUpdater NewUpdater 创建的升级执行器
+type semVerUpdater struct {
+	semver  string
+	execute func(app Application) error
+}
+
+// Version 要升级到的版本号, 由 major.minor 近似转换
+func (u *semVerUpdater) Version() float64 {
+	if ver, err := utypes.ParseSemVer(u.semver); nil == err {
+		return float64(ver.Major) + float64(ver.Minor)/100
+	}
+	return 0
+}
+
+// SemVer 要升级到的语义化版本号
+func (u *semVerUpdater) SemVer() string {
+	return u.semver
+}
+
+// Execute 执行升级
+func (u *semVerUpdater) Execute(app Application) error {
+	return u.execute(app)
+}
+
+// RollbackUpdater 可回滚的升级执行器, 升级失败时逆序执行已执行升级器(包括失败的升级器)的 Rollback
+type RollbackUpdater interface {
+	Updater
+	// Rollback 回滚升级
+	Rollback(app Application) error
+}
+
+// UpdatePlan 升级预演结果
+type UpdatePlan struct {
+	Module      string   // 模块名
+	FromVersion string   // 已记录的版本
+	ToVersion   string   // 要升级到的版本
+	Updaters    []string // 将要执行的升级器版本, 按执行顺序
+}
+
 // Updaters 升级器
 type Updaters []Updater
 
@@ -50,12 +138,56 @@ func (sort Updaters) Swap(i, j int) {
 // Opts 模块配置项
 type Opts struct {
 	Name        string                         // [可选] 模块ID, 不填则为结构体名称
-	Version     float64                        // [必填] 模块版本
+	Version     float64                        // [必填] 模块版本, 保留两位小数, 如: 1.1 => 1.10.0
+	SemVer      string                         // [可选] 语义化模块版本, 如: 1.2.0-rc.1, 设置后优先于 Version. 旧的两位小数版本号记录加载时自动转换, 见 LegacySemVer
 	Description string                         // [可选] 模块描述
 	Updaters    func(app Application) Updaters // [可选] 模块升级执行器, 一个版本执行一次
 	OnReady     func(app Application)          // [可选] 每次加载模块开始之前执行
 	OnSetup     func()                         // [可选] 模块安装, 一个模块只初始化一次
 	OnInit      func()                         // [可选] 每次模块安装、升级后执行一次
+	OnShutdown  func()                         // [可选] 应用关闭时执行, 按模块加载顺序的逆序执行
+
+	// [可选] 将旧的两位小数版本号记录转换为语义化版本号, 如: func(v float64) string { return "1.1.0" }.
+	// 不设置时与 Version 的转换规则相同(如: 1.1 => 1.10.0), 改用 SemVer 且版本号规则不一致时需设置
+	LegacySemVer func(version float64) string
+
+	OnReadyE func(app Application) error // [可选] 同 OnReady, 返回错误时模块加载失败, 在 OnReady 之后执行
+	OnSetupE func() error                // [可选] 同 OnSetup, 返回错误时模块加载失败, 在 OnSetup 之后执行
+	OnInitE  func() error                // [可选] 同 OnInit, 返回错误时模块加载失败, 在 OnInit 之后执行
+}
+
+// GetSemVer 获取模块的语义化版本号, SemVer 为空时由 Version 转换
+func (opts Opts) GetSemVer() (utypes.SemVer, error) {
+	if len(opts.SemVer) > 0 {
+		return utypes.ParseSemVer(opts.SemVer)
+	}
+	return utypes.FloatToSemVer(opts.Version), nil
+}
+
+const (
+	// BootPhaseVersion 模块加载阶段-解析版本号
+	BootPhaseVersion = "Version"
+	// BootPhaseLock 模块加载阶段-获取安装升级锁
+	BootPhaseLock = "Lock"
+	// BootPhaseDependency 模块加载阶段-依赖分析
+	BootPhaseDependency = "Dependency"
+	// BootPhaseProvider 模块加载阶段-执行构造函数
+	BootPhaseProvider = "Provider"
+)
+
+// BootError 模块加载失败, Phase 为失败的阶段: Dependency Provider Version Lock OnReady OnSetup OnUpdate OnInit OnLoaded
+type BootError struct {
+	Module string
+	Phase  string
+	Err    error
+}
+
+func (e *BootError) Error() string {
+	return fmt.Sprintf("module %s failed at %s: %s", e.Module, e.Phase, e.Err.Error())
+}
+
+func (e *BootError) Unwrap() error {
+	return e.Err
 }
 
 // ModuleEvent 模块生命周期事件
@@ -66,9 +198,11 @@ var ModuleEventOnSetup ModuleEvent = "OnSetup"
 var ModuleEventOnUpdate ModuleEvent = "OnUpdate"
 var ModuleEventOnInit ModuleEvent = "OnInit"
 var ModuleEventOnLoaded ModuleEvent = "OnLoaded"
+var ModuleEventOnShutdown ModuleEvent = "OnShutdown"
 
 var ModuleEventOnSetupSucced ModuleEvent = "OnSetupSucced"
 var ModuleEventOnUpdateSucced ModuleEvent = "OnUpdateSucced"
+var ModuleEventOnShutdownSucced ModuleEvent = "OnShutdownSucced"
 
 // OnModuleEvent 模块生命周期事件回调函数
 type OnModuleEvent func(module any, app Application)
@@ -80,6 +214,35 @@ type ModuleInfoRecorder interface {
 	SetValue(key string, value string) error
 }
 
+// ModuleInfoValueGetter [可选] 由 ModuleInfoRecorder 实现, 读取记录失败时返回错误, 避免读取失败的模块被当作未安装
+type ModuleInfoValueGetter interface {
+	GetValueE(key string) (string, error)
+}
+
+// ConfigDirSetter [可选] 由 IConfig 和 ModuleInfoRecorder 实现, 在 Init 之前设置文件所在的配置目录
+type ConfigDirSetter interface {
+	SetConfigDir(dir string)
+}
+
+// GetConfigDir 获取配置目录, 优先级: 参数 PARAMS_KEY_CONFIG_DIR > 环境变量 PAKKU_CONFIG_DIR > .conf
+func GetConfigDir(params ParamGetter) string {
+	if dir := params.GetParam(PARAMS_KEY_CONFIG_DIR).ToString(""); len(dir) > 0 {
+		return dir
+	}
+	if dir := os.Getenv(ENV_KEY_CONFIG_DIR); len(dir) > 0 {
+		return dir
+	}
+	return DEFT_VAL_CONFIG_DIR
+}
+
+// ModuleInfoLocker [可选] 由 ModuleInfoRecorder 实现, 多个实例共用记录时, 用于互斥执行模块安装和升级
+type ModuleInfoLocker interface {
+	// Lock 获取锁, 锁被占用时等待
+	Lock(name string) error
+	// Unlock 释放锁
+	Unlock(name string) error
+}
+
 // Module 实现这个接口可被加载器识别, 用于初始化和模块自动注入功能
 type Module interface {
 	AsModule() Opts
@@ -107,6 +270,30 @@ type Loader interface {
 	Modules // Modules 模块操作
 }
 
+// ModuleTryLoader [可选] 由 Loader 实现, 加载失败时返回错误而不是 panic
+type ModuleTryLoader interface {
+	// TryLoads 同 Loads, 失败时返回 *BootError, 并按逆序卸载本次已加载的模块
+	TryLoads(mts ...Module) error
+}
+
+// ModuleUpdatePlanner [可选] 由 Loader 实现, 预演模块升级
+type ModuleUpdatePlanner interface {
+	// PlanUpdates 预演升级, 返回需要升级的模块及将要执行的升级器, 不执行升级
+	PlanUpdates(mts ...Module) ([]UpdatePlan, error)
+}
+
+// ParallelLoader [可选] 由 Loader 实现, 并行加载无依赖关系的模块
+type ParallelLoader interface {
+	// SetParallelism 设置并行加载的最大并发数, 小于等于1时顺序加载. 需在 Loads 之前设置
+	SetParallelism(workers int)
+}
+
+// ModuleShutdowner [可选] 由 Loader 实现, 应用关闭时卸载模块
+type ModuleShutdowner interface {
+	// Shutdown 卸载模块, 按照加载顺序的逆序执行 OnShutdown. ctx 结束时立即返回, 执行中的 OnShutdown 在后台继续执行直到结束, 尚未开始的模块不再执行
+	Shutdown(ctx context.Context) error
+}
+
 // Application 当前运行中的实例
 type Application interface {
 	// GetInstanceID 获取实例的ID
@@ -155,6 +342,12 @@ type Modules interface {
 	OnModuleEvent(name string, event ModuleEvent, val OnModuleEvent)
 }
 
+// ModulesByInterfaceGetter [可选] 由 Modules 实现, 按接口获取模块, 用于注入接口切片
+type ModulesByInterfaceGetter interface {
+	// GetModulesByInterface 获取所有实现了该接口的已加载模块, 按加载顺序, val 须为接口切片指针, 如: *[]ICache
+	GetModulesByInterface(val any) error
+}
+
 // Utils 工具
 type Utils interface {
 	// AutoWired 自动注入依赖对象
@@ -9,6 +9,7 @@ package ipakku
 import (
 	"errors"
 	"reflect"
+	"sync"
 
 	"github.com/wup364/pakku/pkg/reflectutil"
 	"github.com/wup364/pakku/pkg/utypes"
@@ -33,6 +34,18 @@ var PakkuConf = pakkuConfFuc{
 	// AutowirePakkuModuleImplement 多个相同接口下, 设置自动注入接口的实例名称
 	AutowirePakkuModuleImplement: doAutowirePakkuModuleImplement,
 
+	// SetPakkuModuleImplementInitialized 实现的所有者(如: AppCache模块)初始化或释放实现后标记
+	SetPakkuModuleImplementInitialized: doSetPakkuModuleImplementInitialized,
+
+	// IsPakkuModuleImplementInitialized 实现是否已被所有者初始化
+	IsPakkuModuleImplementInitialized: doIsPakkuModuleImplementInitialized,
+
+	// SetPakkuModuleImplementOwner 设置接口实现的所有者模块(如: ICache => AppCache)
+	SetPakkuModuleImplementOwner: doSetPakkuModuleImplementOwner,
+
+	// GetPakkuModuleImplementOwner 获取接口实现的所有者模块名, 未设置时返回空字符串
+	GetPakkuModuleImplementOwner: doGetPakkuModuleImplementOwner,
+
 	// SetModuleInfoRecorderImplement 模块信息记录实现方法
 	SetModuleInfoRecorderImplement: doSetModuleInfoRecorderImplement,
 
@@ -46,6 +59,12 @@ var moduleInfoImpl ModuleInfoRecorder
 // implements 所有的ixxx.go实现实例, 结构: { ixxx: map[name]implement }
 var implements = utypes.NewSafeMap[string, *utypes.SafeMap[string, any]]()
 
+// initializedImpls 已被所有者初始化的实现实例
+var initializedImpls sync.Map
+
+// implOwners 接口实现的所有者模块, 结构: { ixxx: 模块名 }
+var implOwners = utypes.NewSafeMap[string, string]()
+
 // pakkuConfFuc 重载函数
 type pakkuConfFuc struct {
 	// SetPakkuModuleImplement 设置默认接口实现, 在application实例上
@@ -60,6 +79,20 @@ type pakkuConfFuc struct {
 	// AutowirePakkuModuleImplement 多个相同接口下, 设置自动注入接口的实例名称
 	AutowirePakkuModuleImplement func(param ParamGetter, name any, defaultName string) error
 
+	// SetPakkuModuleImplementInitialized 实现的所有者(如: AppCache模块)初始化或释放实现后标记
+	// 只有已初始化的实现才能通过 @autowired:"接口名#实现名" 注入
+	SetPakkuModuleImplementInitialized func(val any, initialized bool)
+
+	// IsPakkuModuleImplementInitialized 实现是否已被所有者初始化
+	IsPakkuModuleImplementInitialized func(val any) bool
+
+	// SetPakkuModuleImplementOwner 设置接口实现的所有者模块(如: ICache => AppCache)
+	// @autowired:"接口名#实现名" 会依赖所有者模块, 所有者模块加载后才注入
+	SetPakkuModuleImplementOwner func(interfaceName, moduleName string)
+
+	// GetPakkuModuleImplementOwner 获取接口实现的所有者模块名, 未设置时返回空字符串
+	GetPakkuModuleImplementOwner func(interfaceName string) string
+
 	// SetModuleInfoRecorderImplement 模块信息记录实现方法
 	SetModuleInfoRecorderImplement func(val ModuleInfoRecorder)
 
@@ -119,3 +152,37 @@ func doAutowirePakkuModuleImplement(param ParamGetter, name any, defaultName str
 func doSetPakkuModuleImplement(param ParamSetter, interfaceName, name string) {
 	param.SetParam(moduleImplsPrefix+"."+interfaceName, name)
 }
+
+// doSetPakkuModuleImplementInitialized 标记实现是否已被所有者初始化, 实现需要是可比较的类型(如: 指针)
+func doSetPakkuModuleImplementInitialized(val any, initialized bool) {
+	if nil == val || !reflect.TypeOf(val).Comparable() {
+		return
+	}
+	if initialized {
+		initializedImpls.Store(val, true)
+	} else {
+		initializedImpls.Delete(val)
+	}
+}
+
+// doIsPakkuModuleImplementInitialized 实现是否已被所有者初始化
+func doIsPakkuModuleImplementInitialized(val any) bool {
+	if nil == val || !reflect.TypeOf(val).Comparable() {
+		return false
+	}
+	_, ok := initializedImpls.Load(val)
+	return ok
+}
+
+// doSetPakkuModuleImplementOwner 设置接口实现的所有者模块
+func doSetPakkuModuleImplementOwner(interfaceName, moduleName string) {
+	implOwners.Put(interfaceName, moduleName)
+}
+
+// doGetPakkuModuleImplementOwner 获取接口实现的所有者模块名
+func doGetPakkuModuleImplementOwner(interfaceName string) string {
+	if val, ok := implOwners.Get(interfaceName); ok {
+		return val
+	}
+	return ""
+}
@@ -6,11 +6,16 @@
 package pakku
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/wup364/pakku/internal/mloader"
 	"github.com/wup364/pakku/internal/modules/appcache"
@@ -29,7 +34,7 @@ func NewApplication(name string) ipakku.ApplicationBootBuilder {
 	boot := &ApplicationBootBuilder{
 		locker:  new(sync.Mutex),
 		modules: make([]ipakku.Module, 0),
-		loader:  mloader.NewDefault(name),
+		loader:  mloader.NewDefault(name).(bootLoader),
 	}
 	//
 	boot.mevent = &ModuleEventBuilder{boot: boot}
@@ -42,11 +47,20 @@ func NewApplication(name string) ipakku.ApplicationBootBuilder {
 	return boot
 }
 
+// bootLoader 启动使用的加载器, 需实现 Loader 的可选接口
+type bootLoader interface {
+	ipakku.Loader
+	ipakku.ModuleTryLoader
+	ipakku.ModuleUpdatePlanner
+	ipakku.ParallelLoader
+	ipakku.ModuleShutdowner
+}
+
 // ApplicationBootBuilder 程序启动引导
 type ApplicationBootBuilder struct {
 	locker    *sync.Mutex
 	modules   []ipakku.Module
-	loader    ipakku.Loader
+	loader    bootLoader
 	mevent    *ModuleEventBuilder
 	pkModules *PakkuModuleBuilder
 	csModules *CustomModuleBuilder
@@ -82,16 +96,36 @@ func (boot *ApplicationBootBuilder) Application() ipakku.PakkuApplication {
 
 	return &PakkuApplication{
 		Application: boot.loader.GetApplication(),
+		loader:      boot.loader,
 	}
 }
 
 // BootStart 启动程序&加载模块
 func (boot *ApplicationBootBuilder) BootStart() ipakku.PakkuApplication {
+	app, err := boot.bootStart(false)
+	if nil != err {
+		logs.Panic(err)
+	}
+	return app
+}
+
+// TryBootStart 启动程序&加载模块, 加载失败时返回 *ipakku.BootError, 并卸载已加载的模块
+func (boot *ApplicationBootBuilder) TryBootStart() (ipakku.PakkuApplication, error) {
+	return boot.bootStart(true)
+}
+
+// PlanUpdates 预演已添加模块的升级, 不加载模块
+func (boot *ApplicationBootBuilder) PlanUpdates() ([]ipakku.UpdatePlan, error) {
+	return boot.loader.PlanUpdates(boot.modules...)
+}
+
+// bootStart 启动程序&加载模块, rollback 为 true 时加载失败后卸载已加载的模块
+func (boot *ApplicationBootBuilder) bootStart(rollback bool) (ipakku.PakkuApplication, error) {
 	boot.locker.Lock()
 	defer boot.locker.Unlock()
 
 	if boot.pakapp != nil {
-		return boot.pakapp
+		return boot.pakapp, nil
 	}
 
 	if boot.pkconf.showBanner {
@@ -105,13 +139,49 @@ func (boot *ApplicationBootBuilder) BootStart() ipakku.PakkuApplication {
 	fmt.Printf("name: %s\r\n", name)
 	fmt.Printf("instance: %s\r\n", instanceID)
 	fmt.Printf("cwd: %s\r\n", cwd)
-	boot.loader.Loads(boot.modules...)
+	if rollback {
+		if err := boot.loader.TryLoads(boot.modules...); nil != err {
+			return nil, err
+		}
+	} else {
+		boot.loader.Loads(boot.modules...)
+	}
 
 	boot.pakapp = &PakkuApplication{
 		Application: boot.loader.GetApplication(),
+		loader:      boot.loader,
 	}
 
-	return boot.pakapp
+	if boot.pkconf.gracefulShutdown {
+		boot.listenShutdownSignal(boot.pakapp, boot.pkconf.shutdownTimeout)
+	}
+
+	return boot.pakapp, nil
+}
+
+// listenShutdownSignal 监听 SIGINT/SIGTERM 信号, 收到信号后关闭应用
+// 关闭后恢复默认的信号处理, 再次收到信号时进程直接退出
+func (boot *ApplicationBootBuilder) listenShutdownSignal(app ipakku.PakkuApplication, timeout time.Duration) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s := <-sig
+		signal.Stop(sig)
+		logs.Infof("> Received signal %s, shutting down ", s.String())
+
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		if err := app.Shutdown(ctx); nil != err {
+			logs.Error(err)
+		} else {
+			logs.Info("> Shutdown complete")
+		}
+	}()
 }
 
 // addModule 加载模块
@@ -158,8 +228,11 @@ func (boot *ApplicationBootBuilder) getModuleName(mt ipakku.Module) string {
 
 // printBanner 打印一些特殊记号
 func (boot *ApplicationBootBuilder) printBanner() {
-	bannerPath := ".conf/banner.txt"
+	bannerPath := filepath.Join(ipakku.GetConfigDir(boot.loader), "banner.txt")
 	if !fileutil.IsFile(bannerPath) {
+		if err := fileutil.MkdirAll(filepath.Dir(bannerPath)); nil != err {
+			logs.Error(err)
+		}
 		banner := "" +
 			"              _    _             \r\n" +
 			"  _ __   __ _| | _| | ___   _    \r\n" +
@@ -185,6 +258,7 @@ func (boot *ApplicationBootBuilder) printBanner() {
 // PakkuApplication 应用实例
 type PakkuApplication struct {
 	ipakku.Application
+	loader  bootLoader
 	pakgter ipakku.PakkuModulesGetter
 }
 
@@ -196,10 +270,25 @@ func (pa *PakkuApplication) PakkuModules() ipakku.PakkuModulesGetter {
 	return pa.pakgter
 }
 
+// Shutdown 关闭应用, 先停止 AppService 的 HTTP/RPC 服务, 再按依赖逆序卸载模块
+func (pa *PakkuApplication) Shutdown(ctx context.Context) (err error) {
+	if service, ok := pa.PakkuModules().GetAppService().(ipakku.ServiceShutdowner); ok {
+		if err = service.Shutdown(ctx); nil != err {
+			logs.Error(err)
+		}
+	}
+	if lerr := pa.loader.Shutdown(ctx); nil != lerr && nil == err {
+		err = lerr
+	}
+	return
+}
+
 // PakkuConfigureBuilder 应用配置
 type PakkuConfigureBuilder struct {
-	boot       *ApplicationBootBuilder
-	showBanner bool
+	boot             *ApplicationBootBuilder
+	showBanner       bool
+	gracefulShutdown bool
+	shutdownTimeout  time.Duration
 }
 
 // SetLoggerOutput 设置日志输出方式
@@ -220,6 +309,63 @@ func (pkcf *PakkuConfigureBuilder) DisableBanner() ipakku.PakkuConfigure {
 	return pkcf
 }
 
+// EnableGracefulShutdown 监听 SIGINT/SIGTERM 信号, 收到信号后在 timeout 内关闭应用, timeout<=0 则不限时
+func (pkcf *PakkuConfigureBuilder) EnableGracefulShutdown(timeout time.Duration) ipakku.PakkuConfigureExt {
+	pkcf.gracefulShutdown = true
+	pkcf.shutdownTimeout = timeout
+	return pkcf
+}
+
+// SetParallelLoading 并行加载无依赖关系的模块, workers 为最大并发数, 小于等于1时顺序加载. 模块的依赖加载完成后立即开始加载, 事件监听函数串行执行
+func (pkcf *PakkuConfigureBuilder) SetParallelLoading(workers int) ipakku.PakkuConfigureExt {
+	pkcf.boot.loader.SetParallelism(workers)
+	return pkcf
+}
+
+// RefuseDowngrade 已记录的模块版本比模块版本新时, 拒绝加载该模块
+func (pkcf *PakkuConfigureBuilder) RefuseDowngrade() ipakku.PakkuConfigureExt {
+	pkcf.boot.loader.SetParam(ipakku.PARAMS_KEY_REFUSE_DOWNGRADE, true)
+	return pkcf
+}
+
+// SetConfigDefaults 设置配置默认值, 优先级最低, 支持 a.b.c 形式的key
+func (pkcf *PakkuConfigureBuilder) SetConfigDefaults(defaults map[string]any) ipakku.PakkuConfigureExt {
+	pkcf.boot.loader.SetParam(ipakku.PARAMS_KEY_CONFIG_DEFAULTS, defaults)
+	return pkcf
+}
+
+// SetConfigReloadInterval 设置配置文件变化检查间隔, 默认5秒, 小于等于0时不检查
+func (pkcf *PakkuConfigureBuilder) SetConfigReloadInterval(interval time.Duration) ipakku.PakkuConfigureExt {
+	pkcf.boot.loader.SetParam(ipakku.PARAMS_KEY_CONFIG_RELOAD_INTERVAL, interval)
+	return pkcf
+}
+
+// SetConfigKeyFile 设置配置加密密钥文件, 默认 {配置目录}/{app}.key, 环境变量 PAKKU_CONFIG_KEY 优先
+func (pkcf *PakkuConfigureBuilder) SetConfigKeyFile(path string) ipakku.PakkuConfigureExt {
+	pkcf.boot.loader.SetParam(ipakku.PARAMS_KEY_CONFIG_KEY_FILE, path)
+	return pkcf
+}
+
+// SetConfigEnvPrefix 设置环境变量配置的前缀, 默认 {APPNAME}_ 且仅读取带前缀的环境变量.
+// only 为 false 时同时读取不带前缀的环境变量(带前缀的优先), 此时 PATH、HOME 等系统环境变量也可能覆盖配置
+func (pkcf *PakkuConfigureBuilder) SetConfigEnvPrefix(prefix string, only bool) ipakku.PakkuConfigureExt {
+	pkcf.boot.loader.SetParam(ipakku.PARAMS_KEY_CONFIG_ENV_PREFIX, prefix)
+	pkcf.boot.loader.SetParam(ipakku.PARAMS_KEY_CONFIG_ENV_PREFIX_ONLY, only)
+	return pkcf
+}
+
+// SetConfigDir 设置配置目录, 默认 .conf(相对于工作目录), 配置文件、banner、模块信息记录、静态页面配置均存放于此
+func (pkcf *PakkuConfigureBuilder) SetConfigDir(dir string) ipakku.PakkuConfigureExt {
+	pkcf.boot.loader.SetParam(ipakku.PARAMS_KEY_CONFIG_DIR, dir)
+	return pkcf
+}
+
+// SetProfile 设置配置profile, 启用后额外读取 {app}-{profile} 配置文件, 优先于环境变量 PAKKU_PROFILE
+func (pkcf *PakkuConfigureBuilder) SetProfile(profile string) ipakku.PakkuConfigureExt {
+	pkcf.boot.loader.SetParam(ipakku.PARAMS_KEY_PROFILE, profile)
+	return pkcf
+}
+
 // PakkuModules 默认携带的模块
 func (pkcf *PakkuConfigureBuilder) PakkuModules() ipakku.PakkuModuleBuilder {
 	return pkcf.boot.pkModules
@@ -281,6 +427,11 @@ func (pkm *PakkuModuleBuilder) BootStart() ipakku.PakkuApplication {
 	return pkm.boot.BootStart()
 }
 
+// TryBootStart 启动程序&加载模块, 加载失败时返回错误
+func (pkm *PakkuModuleBuilder) TryBootStart() (ipakku.PakkuApplication, error) {
+	return pkm.boot.TryBootStart()
+}
+
 // PakkuModulesGetter 获取默认携带的模块
 type PakkuModulesGetter struct {
 	app ipakku.Application
@@ -339,6 +490,23 @@ func (cms *CustomModuleBuilder) AddModules(mts ...ipakku.Module) ipakku.CustomMo
 	return cms
 }
 
+// AddProvider 添加构造函数模块
+func (cms *CustomModuleBuilder) AddProvider(fn any) ipakku.CustomModuleBuilder {
+	return cms.AddProviders(fn)
+}
+
+// AddProviders 添加构造函数模块
+func (cms *CustomModuleBuilder) AddProviders(fns ...any) ipakku.CustomModuleBuilder {
+	for i := 0; i < len(fns); i++ {
+		if mt, err := mloader.NewProviderModule(fns[i]); nil != err {
+			logs.Panic(err)
+		} else {
+			cms.boot.addModule(mt)
+		}
+	}
+	return cms
+}
+
 // ModuleEvents 模块事件监听器
 func (csm *CustomModuleBuilder) ModuleEvents() ipakku.ModuleEventBuilder {
 	return csm.boot.mevent
@@ -349,6 +517,11 @@ func (csm *CustomModuleBuilder) BootStart() ipakku.PakkuApplication {
 	return csm.boot.BootStart()
 }
 
+// TryBootStart 启动程序&加载模块, 加载失败时返回错误
+func (csm *CustomModuleBuilder) TryBootStart() (ipakku.PakkuApplication, error) {
+	return csm.boot.TryBootStart()
+}
+
 // ModuleEventBuilder 模块事件监听器
 type ModuleEventBuilder struct {
 	boot *ApplicationBootBuilder
@@ -364,3 +537,8 @@ func (meb ModuleEventBuilder) Listen(name string, event ipakku.ModuleEvent, val
 func (meb ModuleEventBuilder) BootStart() ipakku.PakkuApplication {
 	return meb.boot.BootStart()
 }
+
+// TryBootStart 启动程序&加载模块, 加载失败时返回错误
+func (meb ModuleEventBuilder) TryBootStart() (ipakku.PakkuApplication, error) {
+	return meb.boot.TryBootStart()
+}
@@ -6,6 +6,8 @@
 package pakku
 
 import (
+	"context"
+	"io"
 	"net/http"
 	"testing"
 
@@ -52,6 +54,41 @@ func TestNewApplication(t *testing.T) {
 
 }
 
+// TestStartHTTPAsync 非阻塞启动服务, 使用随机端口并优雅关闭
+func TestStartHTTPAsync(t *testing.T) {
+	app := NewApplication("app-test-starthttpasync").
+		PakkuConfigure().(ipakku.PakkuConfigureExt).SetConfigDir(t.TempDir()).
+		PakkuModules().EnableAppConfig().EnableAppService().
+		BootStart()
+
+	service := app.PakkuModules().GetAppService()
+	checkError(service.Get("/hello", func(rw http.ResponseWriter, _ *http.Request) {
+		rw.Write([]byte("hello!"))
+	}))
+
+	h, err := service.(ipakku.AsyncServiceStarter).StartHTTPAsync(ipakku.HTTPServiceConfig{ListenAddr: "127.0.0.1:0"})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Get("http://" + h.Addr().String() + "/hello")
+	if nil != err {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello!" {
+		t.Fatalf("unexpected body: %s", body)
+	}
+
+	if err := app.Shutdown(context.Background()); nil != err {
+		t.Fatal(err)
+	}
+	if err := h.Wait(); nil != err {
+		t.Fatal(err)
+	}
+}
+
 func checkError(err error) {
 	if nil != err {
 		panic(err)
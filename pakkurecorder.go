@@ -0,0 +1,19 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2024 WuPeng <wup364@outlook.com>.
+
+// 模块信息记录器
+
+package pakku
+
+import (
+	"github.com/wup364/pakku/internal/mloader/mutils"
+	"github.com/wup364/pakku/ipakku"
+	"github.com/wup364/pakku/pkg/sqlutil/sqlexecutor"
+)
+
+// NewSqlModuleInfoRecorder 数据库模块信息记录器, 记录在 pakku_module_info 表中(不存在时自动创建),
+// 多个实例共用一个数据库时, 通过 pakku_module_lock 表互斥执行模块安装和升级.
+// 需在 NewApplication 之前设置: ipakku.PakkuConf.SetModuleInfoRecorderImplement(NewSqlModuleInfoRecorder(provider))
+func NewSqlModuleInfoRecorder(provider sqlexecutor.SqlExecutorProvider) ipakku.ModuleInfoRecorder {
+	return mutils.NewSqlInfoRecorder(provider)
+}
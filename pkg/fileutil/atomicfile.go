@@ -0,0 +1,188 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+// 文件工具-原子写入和文件锁
+
+package fileutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// ErrLockTimeout 获取文件锁超时
+var ErrLockTimeout = errors.New("timeout waiting for file lock")
+
+// WriteFileAtomic 原子写入文件: 先写入同目录下的临时文件并fsync, 再重命名为目标文件.
+// backup 为 true 时保留上一个版本为 path.bak. 写入过程中崩溃不会破坏原文件.
+// 目标文件已存在时保留其权限, 否则新文件权限为 0600
+func WriteFileAtomic(path string, data []byte, backup bool) (err error) {
+	if len(path) == 0 {
+		return PathNotExist("WriteFileAtomic", path)
+	}
+	dir, name := filepath.Split(path)
+	if len(dir) == 0 {
+		dir = "."
+	}
+	// 临时文件权限为 0600, 目标文件已存在时改为其权限
+	var perm os.FileMode
+	if info, err := os.Stat(path); nil == err {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+name+".tmp*")
+	if nil != err {
+		return err
+	}
+	defer func() {
+		if nil != err {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(data); nil != err {
+		return err
+	}
+	if err = tmp.Sync(); nil != err {
+		return err
+	}
+	if err = tmp.Close(); nil != err {
+		return err
+	}
+	if perm != 0 {
+		if err = os.Chmod(tmp.Name(), perm); nil != err {
+			return err
+		}
+	}
+
+	if backup && IsFile(path) {
+		bak := path + ".bak"
+		if err = os.Remove(bak); nil != err && !os.IsNotExist(err) {
+			return err
+		}
+		// 优先使用硬链接, 不支持时复制
+		if err = os.Link(path, bak); nil != err {
+			if err = CopyFile(path, bak, true, false); nil != err {
+				return err
+			}
+		}
+	}
+	if err = os.Rename(tmp.Name(), path); nil != err {
+		return err
+	}
+	// 同步目录, 确保重命名已落盘. 部分平台不支持, 忽略错误
+	if d, derr := os.Open(dir); nil == derr {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// WriteFileAsIndentJSON 以缩进格式原子写入Json文件
+func WriteFileAsIndentJSON(path string, v any, backup bool) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if nil != err {
+		return err
+	}
+	return WriteFileAtomic(path, append(data, '\n'), backup)
+}
+
+// LockFile 通过独占创建 path 获取跨进程的文件锁, 等待超过 timeout 时返回 ErrLockTimeout.
+// 锁文件修改时间超过 stale 时视为持有者已异常退出, 将被清除. 持有锁期间定时刷新锁文件的修改时间
+func LockFile(path string, timeout, stale time.Duration) (*FileLock, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		fp, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+		if nil == err {
+			_, err = fp.WriteString(strconv.Itoa(os.Getpid()))
+			var info os.FileInfo
+			if nil == err {
+				info, err = fp.Stat()
+			}
+			fp.Close()
+			if nil != err {
+				os.Remove(path)
+				return nil, err
+			}
+			lock := &FileLock{path: path, info: info}
+			lock.keepAlive(stale)
+			return lock, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(path); nil == err && stale > 0 && time.Since(info.ModTime()) > stale {
+			breakStaleLock(path, info)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: %s", ErrLockTimeout, path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// breakStaleLock 清除过期的锁. 先原子重命名为唯一的文件名, 再确认重命名的是判断为过期的锁文件,
+// 若期间锁已被其他进程重新创建(不是同一个文件), 则放回原处
+func breakStaleLock(path string, stale os.FileInfo) {
+	broken := path + ".stale." + strconv.Itoa(os.Getpid()) + "." + strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := os.Rename(path, broken); nil != err {
+		return
+	}
+	if info, err := os.Stat(broken); nil == err && !os.SameFile(stale, info) {
+		// 硬链接在 path 已存在时失败, 不会覆盖其他进程新创建的锁
+		os.Link(broken, path)
+	}
+	os.Remove(broken)
+}
+
+// FileLock 文件锁
+type FileLock struct {
+	path string
+	info os.FileInfo   // 创建的锁文件, 用于确认锁文件未被替换
+	stop chan struct{} // 停止刷新修改时间
+}
+
+// keepAlive 每隔 stale/3 刷新锁文件的修改时间, 避免持有时间较长时被其他进程视为过期
+func (lock *FileLock) keepAlive(stale time.Duration) {
+	if stale <= 0 {
+		return
+	}
+	stop := make(chan struct{})
+	lock.stop = stop
+	go func() {
+		ticker := time.NewTicker(stale / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if info, err := os.Stat(lock.path); nil == err && os.SameFile(lock.info, info) {
+					now := time.Now()
+					os.Chtimes(lock.path, now, now)
+				}
+			}
+		}
+	}()
+}
+
+// Unlock 释放锁, 锁文件已被其他进程作为过期的锁清除并重新创建时不删除
+func (lock *FileLock) Unlock() error {
+	if nil != lock.stop {
+		close(lock.stop)
+		lock.stop = nil
+	}
+	if info, err := os.Stat(lock.path); nil == err && !os.SameFile(lock.info, info) {
+		return fmt.Errorf("lock file %s has been replaced by another process", lock.path)
+	}
+	if err := os.Remove(lock.path); nil != err && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2019 WuPeng <wup364@outlook.com>.
+
+package fileutil
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.json")
+	if err := WriteFileAsIndentJSON(path, map[string]any{"a": 1}, true); nil != err {
+		t.Fatal(err)
+	}
+	if err := WriteFileAsIndentJSON(path, map[string]any{"a": 2}, true); nil != err {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "{\n  \"a\": 2\n}\n" {
+		t.Fatalf("data = %q", data)
+	}
+	if data, _ := os.ReadFile(path + ".bak"); string(data) != "{\n  \"a\": 1\n}\n" {
+		t.Fatalf("backup = %q", data)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Fatalf("temp file is not removed: %v", entries)
+	}
+}
+
+func TestWriteFileAtomicPerm(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file mode is not supported")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret.json")
+	if err := WriteFileAtomic(path, []byte("{}"), false); nil != err {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Fatalf("perm = %v", info.Mode().Perm())
+	}
+
+	// 已存在的文件保留权限
+	os.Chmod(path, 0640)
+	if err := WriteFileAtomic(path, []byte("{}"), false); nil != err {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0640 {
+		t.Fatalf("perm = %v", info.Mode().Perm())
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.lock")
+	lock, err := LockFile(path, time.Second, time.Minute)
+	if nil != err {
+		t.Fatal(err)
+	}
+	if _, err = LockFile(path, 50*time.Millisecond, time.Minute); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("err = %v", err)
+	}
+	if err = lock.Unlock(); nil != err {
+		t.Fatal(err)
+	}
+
+	// 失效的锁被清除
+	if err = os.WriteFile(path, []byte("1"), 0666); nil != err {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(path, old, old)
+	if lock, err = LockFile(path, 50*time.Millisecond, time.Minute); nil != err {
+		t.Fatal(err)
+	}
+	lock.Unlock()
+}
+
+func TestLockFileKeepAlive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.lock")
+	lock, err := LockFile(path, time.Second, 60*time.Millisecond)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// 持有期间刷新修改时间, 不会被视为过期
+	time.Sleep(150 * time.Millisecond)
+	if _, err = LockFile(path, 20*time.Millisecond, 60*time.Millisecond); !errors.Is(err, ErrLockTimeout) {
+		t.Fatalf("err = %v", err)
+	}
+	if err = lock.Unlock(); nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestBreakStaleLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.lock")
+	os.WriteFile(path, []byte("1"), 0666)
+	stale, _ := os.Stat(path)
+
+	// 判断过期后锁已被其他进程重新创建, 不能清除. 保留旧文件的硬链接, 避免新文件复用其inode
+	os.Link(path, path+".old")
+	os.Remove(path)
+	os.WriteFile(path, []byte("2"), 0666)
+	breakStaleLock(path, stale)
+	if data, err := os.ReadFile(path); nil != err || string(data) != "2" {
+		t.Fatalf("data = %q, err = %v", data, err)
+	}
+	os.Remove(path + ".old")
+
+	stale, _ = os.Stat(path)
+	breakStaleLock(path, stale)
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 0 {
+		t.Fatalf("stale lock is not removed: %v", entries)
+	}
+}
@@ -5,28 +5,89 @@
 
 package strutil
 
+import (
+	"fmt"
+	"strings"
+)
+
 // DS_M DependencySorter 依赖排序入参
 type DS_M struct {
 	Name         string
 	Dependencies []string
+	Requesters   map[string]string // [可选] 依赖名 => 声明该依赖的位置(如结构体字段), 用于错误提示
+}
+
+// DependencyCycleError 存在循环依赖
+type DependencyCycleError struct {
+	Path       []string // 循环路径, 首尾相同, 如: A B C A
+	Requesters []string // Path[i] -> Path[i+1] 的声明位置
+}
+
+func (e *DependencyCycleError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("dependency cycle detected: ")
+	for i := 0; i < len(e.Path); i++ {
+		if i > 0 {
+			if i-1 < len(e.Requesters) && len(e.Requesters[i-1]) > 0 {
+				sb.WriteString(" -(" + e.Requesters[i-1] + ")-> ")
+			} else {
+				sb.WriteString(" -> ")
+			}
+		}
+		sb.WriteString(e.Path[i])
+	}
+	return sb.String()
+}
+
+// DependencyMissingError 依赖不存在
+type DependencyMissingError struct {
+	Name       string // 模块名
+	Dependency string // 缺失的依赖名
+	Requester  string // 声明该依赖的位置
 }
 
-// DependencySorter 依赖排序(计算依赖排序)
+func (e *DependencyMissingError) Error() string {
+	if len(e.Requester) > 0 {
+		return fmt.Sprintf("module '%s' depends on '%s' (requested by %s), but it is not found", e.Name, e.Dependency, e.Requester)
+	}
+	return fmt.Sprintf("module '%s' depends on '%s', but it is not found", e.Name, e.Dependency)
+}
+
+// DependencySorter 依赖排序(计算依赖排序), 忽略循环依赖和不存在的依赖
 func DependencySorter(modules ...DS_M) []string {
 	dps := new(dependencySorter)
 	dps.modules = modules
 	return dps.dependencyOrder()
 }
 
+// SortDependencies 依赖排序(计算依赖排序), 存在循环依赖或依赖不存在时返回错误
+// external 判断不在 modules 中的依赖是否已存在, 为 nil 时视为不存在
+func SortDependencies(external func(name string) bool, modules ...DS_M) (stack []string, err error) {
+	dps := new(dependencySorter)
+	dps.modules = modules
+	dps.strict = true
+	dps.external = external
+	if stack = dps.dependencyOrder(); nil != dps.err {
+		return nil, dps.err
+	}
+	return
+}
+
 // dependencySorter 依赖排序器
 type dependencySorter struct {
 	modules     []DS_M
 	moduleIndex map[string]DS_M
 	visited     map[string]bool
+	strict      bool                   // 是否检查循环依赖和依赖不存在
+	external    func(name string) bool // 判断外部依赖是否存在
+	path        []string               // 当前递归路径
+	onPath      map[string]int         // 当前递归路径中的模块 => path 下标
+	err         error
 }
 
 func (sd *dependencySorter) init() {
 	sd.visited = make(map[string]bool)
+	sd.onPath = make(map[string]int)
 	sd.moduleIndex = make(map[string]DS_M)
 
 	if lm := len(sd.modules); lm > 0 {
@@ -38,17 +99,37 @@ func (sd *dependencySorter) init() {
 
 func (sd *dependencySorter) topologicalSort(module DS_M, stack *[]string) {
 	sd.visited[module.Name] = true
+	sd.onPath[module.Name] = len(sd.path)
+	sd.path = append(sd.path, module.Name)
 	for _, dependency := range module.Dependencies {
+		if nil != sd.err {
+			return
+		}
 		if !sd.visited[dependency] {
 			if val, ok := sd.moduleIndex[dependency]; ok {
 				sd.topologicalSort(val, stack)
+			} else if sd.strict && (nil == sd.external || !sd.external(dependency)) {
+				sd.err = &DependencyMissingError{Name: module.Name, Dependency: dependency, Requester: module.Requesters[dependency]}
 			}
+		} else if start, ok := sd.onPath[dependency]; ok && sd.strict {
+			sd.err = sd.cycleError(start, dependency)
 		}
 	}
+	sd.path = sd.path[:len(sd.path)-1]
+	delete(sd.onPath, module.Name)
 
 	*stack = append(*stack, module.Name)
 }
 
+// cycleError 根据当前递归路径生成循环依赖错误
+func (sd *dependencySorter) cycleError(start int, dependency string) error {
+	cycle := &DependencyCycleError{Path: append(append([]string{}, sd.path[start:]...), dependency)}
+	for i := 0; i < len(cycle.Path)-1; i++ {
+		cycle.Requesters = append(cycle.Requesters, sd.moduleIndex[cycle.Path[i]].Requesters[cycle.Path[i+1]])
+	}
+	return cycle
+}
+
 func (sd *dependencySorter) dependencyOrder() (stack []string) {
 	if len(sd.modules) == 0 {
 		return
@@ -60,6 +141,9 @@ func (sd *dependencySorter) dependencyOrder() (stack []string) {
 		if !sd.visited[module.Name] {
 			sd.topologicalSort(module, &stack)
 		}
+		if nil != sd.err {
+			return nil
+		}
 	}
 	return stack
 }
@@ -6,8 +6,10 @@
 package strutil
 
 import (
+	"errors"
 	"fmt"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -42,3 +44,37 @@ func TestDependencySorter(t *testing.T) {
 		fmt.Println(module)
 	}
 }
+
+func TestSortDependencies(t *testing.T) {
+	order, err := SortDependencies(func(name string) bool { return name == "X" },
+		DS_M{Name: "A", Dependencies: []string{"B", "X"}},
+		DS_M{Name: "B", Dependencies: []string{"C"}},
+		DS_M{Name: "C"},
+	)
+	if nil != err || strings.Join(order, ",") != "C,B,A" {
+		t.Fatal(order, err)
+	}
+
+	// 循环依赖
+	_, err = SortDependencies(nil,
+		DS_M{Name: "A", Dependencies: []string{"B"}, Requesters: map[string]string{"B": "A.b"}},
+		DS_M{Name: "B", Dependencies: []string{"C"}},
+		DS_M{Name: "C", Dependencies: []string{"A"}, Requesters: map[string]string{"A": "C.a"}},
+	)
+	var cycle *DependencyCycleError
+	if !errors.As(err, &cycle) || strings.Join(cycle.Path, ",") != "A,B,C,A" {
+		t.Fatal(err)
+	}
+	if err.Error() != "dependency cycle detected: A -(A.b)-> B -> C -(C.a)-> A" {
+		t.Fatal(err)
+	}
+
+	// 依赖不存在
+	_, err = SortDependencies(nil,
+		DS_M{Name: "A", Dependencies: []string{"Y"}, Requesters: map[string]string{"Y": "A.y"}},
+	)
+	var missing *DependencyMissingError
+	if !errors.As(err, &missing) || missing.Dependency != "Y" || missing.Requester != "A.y" {
+		t.Fatal(err)
+	}
+}
@@ -132,6 +132,17 @@ func (m *SafeMap[K, V]) Delete(k K) {
 	delete(m.cmap, k)
 }
 
+// DeleteIf 当key存在且 fun 返回true时删除, 返回被删除的值
+func (m *SafeMap[K, V]) DeleteIf(k K, fun func(val V) bool) (res V, deleted bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if val, ok := m.cmap[k]; ok && fun(val) {
+		delete(m.cmap, k)
+		return val, true
+	}
+	return
+}
+
 // Clear 清空
 func (m *SafeMap[K, V]) Clear() {
 	m.lock.Lock()
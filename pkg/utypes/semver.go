@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2024 WuPeng <wup364@outlook.com>.
+
+// 语义化版本号
+
+package utypes
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SemVer 语义化版本号, 格式: major.minor.patch[-prerelease][+build]
+type SemVer struct {
+	Major      int
+	Minor      int
+	Patch      int
+	PreRelease string // 先行版本号, 如: alpha.1
+	Build      string // 编译信息, 不参与比较
+}
+
+// ParseSemVer 解析版本号, 允许 'v' 前缀
+func ParseSemVer(version string) (ver SemVer, err error) {
+	s := strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if idx := strings.Index(s, "+"); idx > -1 {
+		s, ver.Build = s[:idx], s[idx+1:]
+	}
+	if idx := strings.Index(s, "-"); idx > -1 {
+		if s, ver.PreRelease = s[:idx], s[idx+1:]; len(ver.PreRelease) == 0 {
+			return ver, fmt.Errorf("invalid semver '%s': empty pre-release", version)
+		}
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return ver, fmt.Errorf("invalid semver '%s': must be major.minor.patch", version)
+	}
+	nums := []*int{&ver.Major, &ver.Minor, &ver.Patch}
+	for i := 0; i < len(parts); i++ {
+		if *nums[i], err = strconv.Atoi(parts[i]); nil != err || *nums[i] < 0 {
+			return ver, fmt.Errorf("invalid semver '%s': '%s' is not a non-negative number", version, parts[i])
+		}
+	}
+	return
+}
+
+// MustParseSemVer 解析版本号, 失败时 panic
+func MustParseSemVer(version string) SemVer {
+	ver, err := ParseSemVer(version)
+	if nil != err {
+		panic(err)
+	}
+	return ver
+}
+
+// FloatToSemVer 将两位小数的浮点版本号转换为语义化版本号, 如: 1.1 => 1.10.0, 2.05 => 2.5.0
+func FloatToSemVer(version float64) SemVer {
+	s := strconv.FormatFloat(version, 'f', 2, 64)
+	idx := strings.Index(s, ".")
+	major, _ := strconv.Atoi(s[:idx])
+	minor, _ := strconv.Atoi(s[idx+1:])
+	return SemVer{Major: major, Minor: minor}
+}
+
+// String 版本号字符串
+func (ver SemVer) String() string {
+	s := strconv.Itoa(ver.Major) + "." + strconv.Itoa(ver.Minor) + "." + strconv.Itoa(ver.Patch)
+	if len(ver.PreRelease) > 0 {
+		s += "-" + ver.PreRelease
+	}
+	if len(ver.Build) > 0 {
+		s += "+" + ver.Build
+	}
+	return s
+}
+
+// Compare 比较版本号, 小于返回-1, 等于返回0, 大于返回1. 先行版本低于正式版本, Build 不参与比较
+func (ver SemVer) Compare(other SemVer) int {
+	if c := compareInt(ver.Major, other.Major); c != 0 {
+		return c
+	}
+	if c := compareInt(ver.Minor, other.Minor); c != 0 {
+		return c
+	}
+	if c := compareInt(ver.Patch, other.Patch); c != 0 {
+		return c
+	}
+	return comparePreRelease(ver.PreRelease, other.PreRelease)
+}
+
+// compareInt 比较数字
+func compareInt(a, b int) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// comparePreRelease 比较先行版本号, 逐段比较, 数字段按数值比较且低于字母段
+func comparePreRelease(a, b string) int {
+	if a == b {
+		return 0
+	} else if len(a) == 0 {
+		return 1
+	} else if len(b) == 0 {
+		return -1
+	}
+
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aerr := strconv.Atoi(as[i])
+		bn, berr := strconv.Atoi(bs[i])
+		switch {
+		case nil == aerr && nil == berr:
+			if c := compareInt(an, bn); c != 0 {
+				return c
+			}
+		case nil == aerr:
+			return -1
+		case nil == berr:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInt(len(as), len(bs))
+}
+
+// SemVerRange 版本范围, 由空格分隔的多个条件组成, 需同时满足, 如: ">1.0.0 <=1.2.0"
+// 支持的操作符: > >= < <= =, 无操作符时等同于 =
+type SemVerRange struct {
+	constraints []semVerConstraint
+}
+
+// semVerConstraint 版本范围条件
+type semVerConstraint struct {
+	op  string
+	ver SemVer
+}
+
+// ParseSemVerRange 解析版本范围
+func ParseSemVerRange(expr string) (res SemVerRange, err error) {
+	for _, item := range strings.Fields(expr) {
+		var c semVerConstraint
+		for _, op := range []string{">=", "<=", ">", "<", "="} {
+			if strings.HasPrefix(item, op) {
+				c.op, item = op, item[len(op):]
+				break
+			}
+		}
+		if len(c.op) == 0 {
+			c.op = "="
+		}
+		if c.ver, err = ParseSemVer(item); nil != err {
+			return
+		}
+		res.constraints = append(res.constraints, c)
+	}
+	return
+}
+
+// Contains 版本号是否在范围内
+func (r SemVerRange) Contains(ver SemVer) bool {
+	for _, c := range r.constraints {
+		cmp := ver.Compare(c.ver)
+		switch c.op {
+		case ">":
+			if cmp <= 0 {
+				return false
+			}
+		case ">=":
+			if cmp < 0 {
+				return false
+			}
+		case "<":
+			if cmp >= 0 {
+				return false
+			}
+		case "<=":
+			if cmp > 0 {
+				return false
+			}
+		default:
+			if cmp != 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+// SPDX-License-Identifier: MIT
+// Copyright (C) 2024 WuPeng <wup364@outlook.com>.
+
+package utypes
+
+import "testing"
+
+func TestSemVerCompare(t *testing.T) {
+	order := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.1.0", "1.10.0", "2.0.0"}
+	for i := 0; i < len(order)-1; i++ {
+		if MustParseSemVer(order[i]).Compare(MustParseSemVer(order[i+1])) != -1 {
+			t.Fatalf("%s should be less than %s", order[i], order[i+1])
+		}
+	}
+	if MustParseSemVer("v1.2.3+build.5").Compare(MustParseSemVer("1.2.3")) != 0 {
+		t.Fatal("build metadata should be ignored")
+	}
+	if _, err := ParseSemVer("1.2"); nil == err {
+		t.Fatal("1.2 should be invalid")
+	}
+	if ver := FloatToSemVer(1.1); ver.String() != "1.10.0" {
+		t.Fatalf("unexpected float version: %s", ver)
+	}
+}
+
+func TestSemVerRange(t *testing.T) {
+	r, err := ParseSemVerRange(">1.0.0 <=1.2.0")
+	if nil != err {
+		t.Fatal(err)
+	}
+	for ver, expected := range map[string]bool{"1.0.0": false, "1.0.1": true, "1.2.0-rc.1": true, "1.2.0": true, "1.2.1": false} {
+		if r.Contains(MustParseSemVer(ver)) != expected {
+			t.Fatalf("%s in range should be %v", ver, expected)
+		}
+	}
+}
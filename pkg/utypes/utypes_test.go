@@ -42,3 +42,17 @@ func TestSafeMap(t *testing.T) {
 	fmt.Println(cm.CutR())
 	fmt.Println(dm.CutR())
 }
+
+func TestSafeMapDeleteIf(t *testing.T) {
+	m := NewSafeMap[string, int]()
+	m.Put("a", 1)
+	if _, ok := m.DeleteIf("a", func(val int) bool { return val == 2 }); ok || !m.ContainsKey("a") {
+		t.Fatal("a should not be deleted")
+	}
+	if val, ok := m.DeleteIf("a", func(val int) bool { return val == 1 }); !ok || val != 1 || m.ContainsKey("a") {
+		t.Fatal("a should be deleted")
+	}
+	if _, ok := m.DeleteIf("b", func(val int) bool { return true }); ok {
+		t.Fatal("b does not exist")
+	}
+}